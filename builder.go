@@ -0,0 +1,78 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// GenerateBuilder 为 struct 生成 XxxBuilder，每个成员对应一个链式设置方法，Build 返回构建的结果。fields 为空时为所有成员生成
+//
+// 生成的声明带有 //astutil:gen builder Xxx 标记，成员变化后再次执行会原位更新，已删除成员的方法会被删除
+//
+// 测试数据：
+//
+// type Stu struct {
+//	name string
+// }
+//
+// 执行：GenerateBuilder(f, "Stu")
+//
+// 结果为：
+//
+// // StuBuilder 用于构建 Stu
+// //
+// //astutil:gen builder Stu
+// type StuBuilder struct {
+//	v Stu
+// }
+//
+// // NewStuBuilder 创建 StuBuilder
+// //
+// //astutil:gen builder Stu
+// func NewStuBuilder() *StuBuilder {
+//	return &StuBuilder{}
+// }
+//
+// // Name 设置 name
+// //
+// //astutil:gen builder Stu
+// func (b *StuBuilder) Name(name string) *StuBuilder {
+//	b.v.name = name
+//	return b
+// }
+//
+// // Build 返回构建的 Stu
+// //
+// //astutil:gen builder Stu
+// func (b *StuBuilder) Build() *Stu {
+//	v := b.v
+//	return &v
+// }
+func GenerateBuilder(f *ast.File, structName string, fields ...string) bool {
+	list, ok := findStructFields(f, structName, fields...)
+	if !ok {
+		return false
+	}
+	builder := structName + "Builder"
+	srcs := []string{
+		genDoc("builder", structName, fmt.Sprintf("%s 用于构建 %s", builder, structName)) +
+			fmt.Sprintf("type %s struct {\nv %s\n}\n", builder, structName),
+		genDoc("builder", structName, fmt.Sprintf("New%s 创建 %s", builder, builder)) +
+			fmt.Sprintf("func New%s() *%s {\nreturn &%s{}\n}\n", builder, builder, builder),
+	}
+	for _, field := range list {
+		name := exportedName(field.name)
+		if name == "Build" {
+			name = "WithBuild"
+		}
+		param := paramName(field.name, "b")
+		src := genDoc("builder", structName, fmt.Sprintf("%s 设置 %s", name, field.name))
+		src += fmt.Sprintf("func (b *%s) %s(%s %s) *%s {\nb.v.%s = %s\nreturn b\n}\n",
+			builder, name, param, exprString(field.typ), builder, field.name, param)
+		srcs = append(srcs, src)
+	}
+	srcs = append(srcs, genDoc("builder", structName, fmt.Sprintf("Build 返回构建的 %s", structName))+
+		fmt.Sprintf("func (b *%s) Build() *%s {\nv := b.v\nreturn &v\n}\n", builder, structName))
+	index := getInsertIndex(f, &AstInsertPos{AfterMethods: true}, structName, "")
+	return applyGen(f, "builder", structName, srcs, index)
+}
@@ -0,0 +1,31 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGenerateBuilder(t *testing.T) {
+	fst, f := InitEnv("./test_demo/builder_demo.go")
+
+	ret := GenerateBuilder(f, "Plain")
+	assert.True(t, ret)
+	ret = GenerateBuilder(f, "Tags")
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "type Plain struct {\n\tID   int\n\tName string\n}\n\n// PlainBuilder 用于构建 Plain\n//\n//astutil:gen builder Plain\ntype PlainBuilder struct {\n\tv Plain\n}\n\n// NewPlainBuilder 创建 PlainBuilder\n")
+	assert.Contains(t, string(src), "func (b *PlainBuilder) ID(id int) *PlainBuilder {\n\tb.v.ID = id\n\treturn b\n}")
+	assert.Contains(t, string(src), "func (b *PlainBuilder) Build() *Plain {\n\tv := b.v\n\treturn &v\n}\n\nfunc (n *Node) String()")
+
+	// 成员变化后原位更新
+	AddKVToStruct(f, "Plain", "b", "bool")
+	ret = GenerateBuilder(f, "Plain", "Name", "b")
+	assert.True(t, ret)
+	src, err = formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(src), "func (b *PlainBuilder) ID(")
+	assert.Contains(t, string(src), "func (b *PlainBuilder) Name(name string) *PlainBuilder {\n\tb.v.Name = name\n\treturn b\n}\n\n// B 设置 b\n//\n//astutil:gen builder Plain\nfunc (b *PlainBuilder) B(b_ bool) *PlainBuilder {\n\tb.v.b = b_\n\treturn b\n}\n\n// Build 返回构建的 Plain\n")
+	PrintResult(fst, f)
+}
@@ -0,0 +1,159 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+)
+
+// 类型检查
+//
+// AddValueToMap、AddValueToSlice 等 API 只在单个文件中检查值的类型，引用 import 的包的值要到 go build 时才能发现类型错误。
+// 修改完成后可以用 CheckFiles 对修改后的源码做类型检查，import 的包从源码加载；
+// 通过 Session.Apply 修改时，Session.Check 还会找出引入错误节点的修改。
+
+// TypeError 类型检查发现的错误
+type TypeError struct {
+	// Pos 错误在修改后源码中的位置
+	Pos token.Position
+	Msg string
+	// Soft 为 true 时表示不影响生成代码的错误，如未使用的变量或 import
+	Soft bool
+	// Edit 引入错误节点的修改，无法确定时为 nil
+	Edit *LogEntry
+
+	pos token.Pos
+}
+
+func (e TypeError) Error() string {
+	if e.Edit != nil {
+		return fmt.Sprintf("%s: %s (introduced by %s)", e.Pos, e.Msg, e.Edit.Step.Op)
+	}
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// CheckFiles 对同一个包中修改后的文件做类型检查，返回发现的所有错误，源码无法输出或解析时返回 error
+//
+// 测试数据：var handlers = map[string]int{"a": 1}
+//
+// 执行：
+//
+// AddValueToMap(f, "handlers", AddQuote("b"), "fmt.Sprint(1)")
+//
+// CheckFiles(fset, f)
+//
+// 结果为：cannot use fmt.Sprint(1) (value of type string) as int value in map literal
+func CheckFiles(fset *token.FileSet, files ...*ast.File) ([]TypeError, error) {
+	errs, _, err := checkFiles(fset, files)
+	return errs, err
+}
+
+// checkFiles 输出文件的源码后重新解析并做类型检查，同时返回重新解析得到的文件
+func checkFiles(fset *token.FileSet, files []*ast.File) ([]TypeError, []*ast.File, error) {
+	if len(files) == 0 {
+		return nil, nil, nil
+	}
+	checkFset := token.NewFileSet()
+	parsed := make([]*ast.File, 0, len(files))
+	for _, f := range files {
+		src, err := formatFile(fset, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		nf, err := parser.ParseFile(checkFset, fset.Position(f.Package).Filename, src, parser.ParseComments)
+		if err != nil {
+			return nil, nil, err
+		}
+		parsed = append(parsed, nf)
+	}
+	errs := make([]TypeError, 0)
+	conf := types.Config{
+		Importer: importer.ForCompiler(checkFset, "source", nil),
+		Error: func(err error) {
+			if te, ok := err.(types.Error); ok {
+				errs = append(errs, TypeError{Pos: te.Fset.Position(te.Pos), Msg: te.Msg, Soft: te.Soft, pos: te.Pos})
+				return
+			}
+			errs = append(errs, TypeError{Msg: err.Error()})
+		},
+	}
+	conf.Check(parsed[0].Name.Name, checkFset, parsed, nil)
+	return errs, parsed, nil
+}
+
+// Check 对会话中的所有文件做类型检查，错误位于某次修改写入的节点（见 LogEntry.Node）内时记录该修改，
+// 多个修改的节点都包含错误位置时选择范围最小的一个。Target 查询到的已有节点中的错误不记录到修改上
+//
+// 修改写入的节点仍在文件中时按它在声明中的位置找到类型检查的源码中对应的节点，
+// 撤销、重做后文件中的节点被替换为快照的副本，此时按修改前后的源码比较找到写入的节点（见 changedMatches）
+func (s *Session) Check() ([]TypeError, error) {
+	errs, parsed, err := checkFiles(s.fset, s.files)
+	if err != nil {
+		return nil, err
+	}
+	type target struct {
+		entry    *LogEntry
+		from, to token.Pos
+	}
+	targets := make([]target, 0)
+	for _, entry := range s.log {
+		if entry.Target == "" {
+			continue
+		}
+		for i, f := range s.files {
+			if s.fset.Position(f.Package).Filename != entry.Step.File {
+				continue
+			}
+			if node := entryNode(f, parsed[i], entry.Node); node != nil {
+				targets = append(targets, target{entry: entry, from: node.Pos(), to: node.End()})
+				continue
+			}
+			matches, err := Query(parsed[i], entry.Target)
+			if err != nil {
+				continue
+			}
+			for _, m := range entry.changedMatches(matches) {
+				targets = append(targets, target{entry: entry, from: m.Node.Pos(), to: m.Node.End()})
+			}
+		}
+	}
+	for i := range errs {
+		best := -1
+		for j, t := range targets {
+			if errs[i].pos < t.from || errs[i].pos >= t.to {
+				continue
+			}
+			if best == -1 || t.to-t.from <= targets[best].to-targets[best].from {
+				best = j
+			}
+		}
+		if best != -1 {
+			errs[i].Edit = targets[best].entry
+		}
+	}
+	return errs, nil
+}
+
+// entryNode 返回 node 在重新解析的文件 parsed 中对应的节点，node 已不在文件 f 中时返回 nil
+func entryNode(f, parsed *ast.File, node ast.Node) ast.Node {
+	if node == nil {
+		return nil
+	}
+	di := ownerDecl(f, node)
+	if di == -1 || di >= len(parsed.Decls) {
+		return nil
+	}
+	path, ok := nodePath(f.Decls[di], node)
+	if !ok {
+		return nil
+	}
+	found := followPath(parsed.Decls[di], path)
+	if found == nil || reflect.TypeOf(found) != reflect.TypeOf(node) {
+		return nil
+	}
+	return found
+}
@@ -0,0 +1,89 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCheckFiles(t *testing.T) {
+	fst, f := InitEnv("./test_demo/edit_demo.go")
+	errs, err := CheckFiles(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(errs))
+
+	// 引用 import 的包的值只能由类型检查确定
+	assert.True(t, AddValueToMap(f, "handlers", AddQuote("b"), "fmt.Sprint(1)"))
+	errs, err = CheckFiles(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(errs))
+	assert.Contains(t, errs[0].Msg, "fmt.Sprint")
+	assert.Equal(t, 19, errs[0].Pos.Line)
+	assert.Nil(t, errs[0].Edit)
+}
+
+func TestSessionCheck(t *testing.T) {
+	s, err := LoadSession("./test_demo/edit_demo.go")
+	assert.NoError(t, err)
+	s.Apply(RecipeStep{Op: "add_struct_field", Struct: "Stu", Name: "Age", Type: "int"})
+	s.Apply(RecipeStep{Op: "add_value_to_map", Var: "handlers", Key: `"b"`, Value: "fmt.Sprint(1)"})
+	s.Apply(RecipeStep{Op: "add_value_to_slice", Var: "routes", Value: "fmt.Println"})
+	s.Apply(RecipeStep{Op: "add_func", Name: "Hello", Body: "var n int = \"n\"\n_ = n"})
+	s.Apply(RecipeStep{Op: "add_import", Path: "strings"})
+
+	errs, err := s.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(errs))
+	ops := make([]string, 0)
+	for _, e := range errs {
+		assert.NotNil(t, e.Edit, e.Error())
+		ops = append(ops, e.Edit.Step.Op)
+	}
+	assert.Equal(t, "add_value_to_slice,add_value_to_map,add_func,add_import", strings.Join(ops, ","))
+	assert.True(t, errs[3].Soft)
+	assert.Contains(t, errs[0].Error(), "(introduced by add_value_to_slice)")
+
+	// 撤销后错误消失
+	assert.NoError(t, s.Undo())
+	assert.NoError(t, s.Undo())
+	assert.NoError(t, s.Undo())
+	assert.NoError(t, s.Undo())
+	errs, err = s.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestSessionCheckInserted(t *testing.T) {
+	s, err := LoadSession("./test_demo/edit_demo.go")
+	assert.NoError(t, err)
+	defer s.Close()
+	f := s.Files()[0]
+	// 不经过会话修改，目标选择器同样能查询到的已有调用中包含错误
+	assert.True(t, AddCallBlockToFunc(f, "Setup", []AstCallExpr{{FunName: "fmt", FunSel: "Println", Args: []string{"missing"}}}, ""))
+
+	call := RecipeStep{Op: "add_call_block", Func: "Setup", Calls: []RecipeCall{{Fun: "fmt", Sel: "Println", Args: []string{"a"}}}}
+	assert.Equal(t, EditApplied, s.Apply(call).Result)
+	wrong := RecipeStep{Op: "add_call_block", Func: "Setup", Calls: []RecipeCall{{Fun: "fmt", Sel: "Println", Args: []string{"other"}}}}
+	assert.Equal(t, EditApplied, s.Apply(wrong).Result)
+
+	check := func() map[string]string {
+		errs, err := s.Check()
+		assert.NoError(t, err)
+		ops := make(map[string]string)
+		for _, e := range errs {
+			op := ""
+			if e.Edit != nil {
+				op = e.Edit.Step.Calls[0].Args[0]
+			}
+			ops[e.Msg] = op
+		}
+		return ops
+	}
+	// 已有节点中的错误不记录到修改上
+	assert.Equal(t, map[string]string{"undefined: missing": "", "undefined: other": "other"}, check())
+
+	// 撤销、重做后文件中的节点被替换，按源码找到写入的节点
+	assert.NoError(t, s.Undo())
+	assert.NoError(t, s.Redo())
+	assert.Equal(t, map[string]string{"undefined: missing": "", "undefined: other": "other"}, check())
+}
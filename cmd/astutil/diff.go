@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext hunk 前后保留的上下文行数
+const diffContext = 3
+
+// diffLine diff 中的一行，kind 为 ' '、'-' 或 '+'，a、b 为该行之前两边已输出的行数
+type diffLine struct {
+	kind byte
+	text string
+	a, b int
+}
+
+// unifiedDiff 返回两份源码的 unified diff，内容相同时返回空字符串
+func unifiedDiff(name string, old, new []byte) string {
+	if string(old) == string(new) {
+		return ""
+	}
+	lines := diffLines(splitLines(string(old)), splitLines(string(new)))
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s.orig\n+++ %s\n", name, name)
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		// 相邻修改之间的相同行不超过两倍上下文时合并为一个 hunk
+		start, end := i-diffContext, i
+		if start < 0 {
+			start = 0
+		}
+		for j := i; j < len(lines) && j-end <= 2*diffContext; j++ {
+			if lines[j].kind != ' ' {
+				end = j
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+		writeHunk(&buf, lines[start:stop])
+		i = stop
+	}
+	return buf.String()
+}
+
+func writeHunk(buf *strings.Builder, lines []diffLine) {
+	aStart, bStart := lines[0].a+1, lines[0].b+1
+	aCount, bCount := 0, 0
+	for _, l := range lines {
+		if l.kind != '+' {
+			aCount++
+		}
+		if l.kind != '-' {
+			bCount++
+		}
+	}
+	if aCount == 0 {
+		aStart--
+	}
+	if bCount == 0 {
+		bStart--
+	}
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+	for _, l := range lines {
+		buf.WriteByte(l.kind)
+		buf.WriteString(l.text)
+		buf.WriteByte('\n')
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines 按最长公共子序列计算逐行的差异，先去掉相同的开头及结尾以减少计算量
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] 为 ma[i:] 与 mb[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	ai, bi := 0, 0
+	add := func(kind byte, text string) {
+		lines = append(lines, diffLine{kind: kind, text: text, a: ai, b: bi})
+		if kind != '+' {
+			ai++
+		}
+		if kind != '-' {
+			bi++
+		}
+	}
+	for _, l := range a[:prefix] {
+		add(' ', l)
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			add(' ', ma[i])
+			i++
+			j++
+		case j < len(mb) && (i == len(ma) || lcs[i][j+1] > lcs[i+1][j]):
+			add('+', mb[j])
+			j++
+		default:
+			add('-', ma[i])
+			i++
+		}
+	}
+	for _, l := range a[len(a)-suffix:] {
+		add(' ', l)
+	}
+	return lines
+}
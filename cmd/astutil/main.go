@@ -0,0 +1,338 @@
+// astutil 命令行工具，子命令与库中的修改类 API 对应，以幂等模式修改目标文件
+//
+// 用法：astutil <command> [flags] file.go...
+//
+// astutil recipe [-w] recipe.yaml 执行 JSON 或 YAML 格式的 recipe 文件
+//
+// 不指定 -w 及 -d 时将修改后的源码输出到标准输出，-w 写回原文件，-d 输出 diff
+//
+// 退出码：0 已修改，1 出错，2 参数错误，3 修改已存在，文件没有变化
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	ozastutil "github.com/ouzhou0110/astutil"
+)
+
+const (
+	exitApplied   = 0
+	exitError     = 1
+	exitUsage     = 2
+	exitUnchanged = 3
+)
+
+// command 一个子命令，setup 注册参数并返回参数解析后填充步骤的函数
+type command struct {
+	op       string
+	usage    string
+	required []string
+	setup    func(fs *flag.FlagSet, s *ozastutil.RecipeStep) func() error
+}
+
+var commands = map[string]*command{
+	"add-import": {
+		op:       "add_import",
+		usage:    "添加 import，如 -path github.com/gin-gonic/gin",
+		required: []string{"path"},
+		setup: func(fs *flag.FlagSet, s *ozastutil.RecipeStep) func() error {
+			fs.StringVar(&s.Name, "name", "", "import 的别名")
+			fs.StringVar(&s.Path, "path", "", "import 的路径")
+			return nil
+		},
+	},
+	"add-field": {
+		op:       "add_struct_field",
+		usage:    "为 struct 添加成员，如 -struct Stu -name Age -type int",
+		required: []string{"struct", "name", "type"},
+		setup: func(fs *flag.FlagSet, s *ozastutil.RecipeStep) func() error {
+			fs.StringVar(&s.Struct, "struct", "", "struct 名称")
+			fs.StringVar(&s.Name, "name", "", "成员名称")
+			fs.StringVar(&s.Type, "type", "", "成员类型")
+			fs.StringVar(&s.Marker, "marker", "", "插入到 struct 内的标记注释之前")
+			return nil
+		},
+	},
+	"add-func": {
+		op:       "add_func",
+		usage:    "添加函数，如 -name Hello -recv '*Stu' -params 'name string' -results error -body 'return nil'",
+		required: []string{"name"},
+		setup: func(fs *flag.FlagSet, s *ozastutil.RecipeStep) func() error {
+			var params, results, doc string
+			fs.StringVar(&s.Name, "name", "", "函数名称")
+			fs.StringVar(&s.Recv, "recv", "", "接收者类型，如 *Stu")
+			fs.StringVar(&params, "params", "", "参数列表，如 'a, b int, c string'")
+			fs.StringVar(&results, "results", "", "返回值列表，如 'string, error'")
+			fs.StringVar(&s.Body, "body", "", "函数体的源码")
+			fs.StringVar(&doc, "doc", "", "文档注释，多行以 \\n 分隔")
+			fs.StringVar(&s.After, "after", "", "插入到该声明之后")
+			fs.StringVar(&s.Before, "before", "", "插入到该声明之前")
+			fs.StringVar(&s.Marker, "marker", "", "插入到文件级别的标记注释之前")
+			return func() (err error) {
+				if doc != "" {
+					s.Doc = strings.Split(strings.ReplaceAll(doc, `\n`, "\n"), "\n")
+				}
+				if s.Params, err = parseFields(params); err != nil {
+					return err
+				}
+				s.Results, err = parseFields(results)
+				return err
+			}
+		},
+	},
+	"add-map-value": {
+		op:       "add_value_to_map",
+		usage:    "为 map 变量添加键值对，如 -var handlers -key '\"b\"' -value 2",
+		required: []string{"var", "key", "value"},
+		setup: func(fs *flag.FlagSet, s *ozastutil.RecipeStep) func() error {
+			fs.StringVar(&s.Var, "var", "", "map 变量名称")
+			fs.StringVar(&s.Key, "key", "", "键的源码")
+			fs.StringVar(&s.Value, "value", "", "值的源码")
+			fs.StringVar(&s.Marker, "marker", "", "插入到字面量内的标记注释之前")
+			return nil
+		},
+	},
+	"add-param": {
+		op:       "add_param",
+		usage:    "为函数添加参数，如 -func Setup -name ctx -type context.Context",
+		required: []string{"func", "name", "type"},
+		setup: func(fs *flag.FlagSet, s *ozastutil.RecipeStep) func() error {
+			fs.StringVar(&s.Func, "func", "", "函数名称，如 Setup 或 (*Stu).Hello")
+			fs.StringVar(&s.Name, "name", "", "参数名称")
+			fs.StringVar(&s.Type, "type", "", "参数类型")
+			return nil
+		},
+	},
+	"add-route": {
+		op:       "add_call_block",
+		usage:    "在函数中注册路由，如 -func Register -path /demo -handler demo.Get 生成 r.GET(\"/demo\", demo.Get)",
+		required: []string{"func", "path", "handler"},
+		setup: func(fs *flag.FlagSet, s *ozastutil.RecipeStep) func() error {
+			var router, method, path, handler string
+			fs.StringVar(&s.Func, "func", "", "注册路由的函数名称")
+			fs.StringVar(&router, "router", "r", "路由变量名称")
+			fs.StringVar(&method, "method", "GET", "路由方法")
+			fs.StringVar(&path, "path", "", "路由路径")
+			fs.StringVar(&handler, "handler", "", "处理函数")
+			fs.StringVar(&s.After, "after", "", "插入到该变量的声明之后")
+			return func() error {
+				s.Calls = []ozastutil.RecipeCall{{Fun: router, Sel: method, Args: []string{strconv.Quote(path), handler}}}
+				return nil
+			}
+		},
+	},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run 执行子命令，返回退出码
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	name := args[0]
+	switch name {
+	case "inspect":
+		return runInspect(args[1:], stdout, stderr)
+	case "recipe":
+		return runRecipe(args[1:], stdout, stderr)
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "astutil: unknown command %q\n", name)
+		usage(stderr)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	write := fs.Bool("w", false, "将结果写回原文件")
+	diff := fs.Bool("d", false, "输出 diff 而不是修改后的源码")
+	step := ozastutil.RecipeStep{Op: cmd.op}
+	finish := cmd.setup(fs, &step)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: astutil %s [flags] file.go...\n  %s\n", name, cmd.usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	for _, flagName := range cmd.required {
+		if fs.Lookup(flagName).Value.String() == "" {
+			fmt.Fprintf(stderr, "astutil %s: -%s is required\n", name, flagName)
+			return exitUsage
+		}
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if finish != nil {
+		if err := finish(); err != nil {
+			fmt.Fprintf(stderr, "astutil %s: %v\n", name, err)
+			return exitUsage
+		}
+	}
+
+	code := exitUnchanged
+	for _, path := range fs.Args() {
+		applied, err := editFile(path, step, *write, *diff, stdout)
+		if err != nil {
+			fmt.Fprintf(stderr, "astutil %s: %s: %v\n", name, path, err)
+			code = exitError
+			continue
+		}
+		if applied && code == exitUnchanged {
+			code = exitApplied
+		}
+	}
+	return code
+}
+
+// editFile 对一个文件执行步骤并按参数输出结果，返回文件是否被修改
+func editFile(path string, step ozastutil.RecipeStep, write, diff bool, stdout io.Writer) (bool, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return false, err
+	}
+	ozastutil.BindFileSet(fset, f)
+	ozastutil.BindSource(fset, f, src)
+	defer ozastutil.ReleaseFile(f)
+
+	recipe := &ozastutil.Recipe{File: path, Idempotent: true, Steps: []ozastutil.RecipeStep{step}}
+	result := ozastutil.ApplyRecipe(fset, map[string]*ast.File{path: f}, recipe)[0]
+	if result.Error != "" {
+		return false, errors.New(result.Error)
+	}
+	applied := result.Result == ozastutil.EditApplied
+	out := src
+	if applied {
+		if out, err = ozastutil.FormatFile(fset, f); err != nil {
+			return false, err
+		}
+	}
+
+	switch {
+	case diff:
+		fmt.Fprint(stdout, unifiedDiff(path, src, out))
+	case !write:
+		stdout.Write(out)
+	}
+	if write && applied {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		if err := ioutil.WriteFile(path, out, info.Mode()); err != nil {
+			return false, err
+		}
+	}
+	return applied, nil
+}
+
+// parseFields 解析参数或返回值列表，如 "a, b int, c string" 或 "string, error"
+func parseFields(list string) ([]ozastutil.RecipeKv, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	expr, err := parser.ParseExpr("func(" + list + ")")
+	if err != nil {
+		return nil, fmt.Errorf("invalid field list %q", list)
+	}
+	var kvs []ozastutil.RecipeKv
+	for _, field := range expr.(*ast.FuncType).Params.List {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, token.NewFileSet(), field.Type); err != nil {
+			return nil, err
+		}
+		if len(field.Names) == 0 {
+			kvs = append(kvs, ozastutil.RecipeKv{Type: buf.String()})
+		}
+		for _, name := range field.Names {
+			kvs = append(kvs, ozastutil.RecipeKv{Name: name.Name, Type: buf.String()})
+		}
+	}
+	return kvs, nil
+}
+
+// runInspect 以 JSON 输出文件的描述，指定 -func 时输出函数的局部变量
+func runInspect(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	funcName := fs.String("func", "", "输出该函数的参数及局部变量")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: astutil inspect [-func name] file.go...")
+		return exitUsage
+	}
+	code := exitApplied
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	for _, path := range fs.Args() {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			fmt.Fprintf(stderr, "astutil inspect: %v\n", err)
+			code = exitError
+			continue
+		}
+		ozastutil.BindFileSet(fset, f)
+		var v interface{} = ozastutil.Inspect(f)
+		ozastutil.ReleaseFile(f)
+		if *funcName != "" {
+			locals, ok := ozastutil.FuncLocals(f, *funcName)
+			if !ok {
+				fmt.Fprintf(stderr, "astutil inspect: %s: func %s not found\n", path, *funcName)
+				code = exitError
+				continue
+			}
+			v = locals
+		}
+		if err := enc.Encode(v); err != nil {
+			fmt.Fprintf(stderr, "astutil inspect: %v\n", err)
+			return exitError
+		}
+	}
+	return code
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: astutil <command> [flags] file.go...")
+	fmt.Fprintln(w, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-14s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(w, "  %-14s %s\n", "inspect", "以 JSON 输出文件中的 import、类型、变量、常量及函数")
+	fmt.Fprintf(w, "  %-14s %s\n", "recipe", "执行 JSON 或 YAML 格式的 recipe 文件，如 astutil recipe -w recipe.yaml")
+	fmt.Fprintln(w, "\nflags:\n  -w  将结果写回原文件\n  -d  输出 diff")
+	fmt.Fprintln(w, "\nexit status: 0 已修改，1 出错，2 参数错误，3 修改已存在")
+}
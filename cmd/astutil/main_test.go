@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	ozastutil "github.com/ouzhou0110/astutil"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// copyDemo 将测试数据复制到临时目录，避免 -w 修改原文件
+func copyDemo(t *testing.T) string {
+	src, err := ioutil.ReadFile("../../test_demo/edit_demo.go")
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "edit_demo.go")
+	assert.NoError(t, ioutil.WriteFile(path, src, 0644))
+	return path
+}
+
+func TestRun(t *testing.T) {
+	path := copyDemo(t)
+	var stdout, stderr bytes.Buffer
+
+	// 输出到标准输出，不修改文件
+	code := run([]string{"add-field", "-struct", "Stu", "-name", "Age", "-type", "int", path}, &stdout, &stderr)
+	assert.Equal(t, exitApplied, code)
+	assert.Contains(t, stdout.String(), "\tAge  int\n")
+	src, _ := ioutil.ReadFile(path)
+	assert.NotContains(t, string(src), "Age")
+
+	// 写回原文件，再次执行时修改已存在
+	stdout.Reset()
+	code = run([]string{"add-route", "-w", "-func", "Setup", "-path", "/demo", "-handler", "demo", path}, &stdout, &stderr)
+	assert.Equal(t, exitApplied, code)
+	assert.Equal(t, "", stdout.String())
+	src, _ = ioutil.ReadFile(path)
+	assert.Contains(t, string(src), "r.GET(\"/demo\", demo)")
+	code = run([]string{"add-route", "-w", "-func", "Setup", "-path", "/demo", "-handler", "demo", path}, &stdout, &stderr)
+	assert.Equal(t, exitUnchanged, code)
+
+	// 输出 diff
+	code = run([]string{"add-func", "-d", "-name", "Hello", "-recv", "*Stu", "-params", "a, b int", "-results", "error", "-body", "return nil", path}, &stdout, &stderr)
+	assert.Equal(t, exitApplied, code)
+	assert.Contains(t, stdout.String(), "+++ "+path+"\n")
+	assert.Contains(t, stdout.String(), "+func (s *Stu) Hello(a int, b int) error {\n+\treturn nil\n+}\n")
+
+	// 出错及参数错误
+	assert.Equal(t, exitError, run([]string{"add-param", "-func", "NotFound", "-name", "n", "-type", "int", path}, &stdout, &stderr))
+	assert.Equal(t, exitUsage, run([]string{"add-import", path}, &stdout, &stderr))
+	assert.Equal(t, exitUsage, run([]string{"unknown"}, &stdout, &stderr))
+
+	stdout.Reset()
+	assert.Equal(t, exitApplied, run([]string{"inspect", path}, &stdout, &stderr))
+	info := ozastutil.FileInfo{}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &info))
+	assert.Equal(t, path, info.File)
+	assert.Equal(t, "Stu", info.Types[0].Name)
+
+	stdout.Reset()
+	assert.Equal(t, exitApplied, run([]string{"inspect", "-func", "Setup", path}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), `"name": "stu"`)
+	assert.Equal(t, exitError, run([]string{"inspect", "-func", "NotFound", path}, &stdout, &stderr))
+}
+
+func TestRunRecipe(t *testing.T) {
+	path := copyDemo(t)
+	dir := filepath.Dir(path)
+	recipe := filepath.Join(dir, "recipe.yaml")
+	assert.NoError(t, ioutil.WriteFile(recipe, []byte(`file: edit_demo.go
+idempotent: true
+steps:
+  - op: add_struct_field
+    struct: Stu
+    name: Age
+    type: int
+`), 0644))
+	var stdout, stderr bytes.Buffer
+
+	// YAML 在命令行中解析，-w 写回目标文件，再次执行时修改已存在
+	assert.Equal(t, exitApplied, run([]string{"recipe", "-w", recipe}, &stdout, &stderr))
+	results := []ozastutil.StepResult{}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &results))
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, ozastutil.EditApplied, results[0].Result)
+	src, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(src), "\tAge  int\n")
+	stdout.Reset()
+	assert.Equal(t, exitUnchanged, run([]string{"recipe", "-w", recipe}, &stdout, &stderr))
+
+	// 未知字段报错
+	assert.NoError(t, ioutil.WriteFile(recipe, []byte("file: edit_demo.go\nsetps: []\n"), 0644))
+	assert.Equal(t, exitError, run([]string{"recipe", recipe}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "setps")
+	assert.Equal(t, exitUsage, run([]string{"recipe"}, &stdout, &stderr))
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	new := "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n"
+	assert.Equal(t, "--- x.orig\n+++ x\n@@ -2,9 +2,10 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n i\n j\n+k\n", unifiedDiff("x", []byte(old), []byte(new)))
+	assert.Equal(t, "", unifiedDiff("x", []byte(old), []byte(old)))
+}
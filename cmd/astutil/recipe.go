@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	ozastutil "github.com/ouzhou0110/astutil"
+	"gopkg.in/yaml.v3"
+)
+
+// runRecipe 执行 JSON 或 YAML 格式的 recipe 文件，以 JSON 输出每个步骤的结果
+//  -w 时所有步骤都成功才写回目标文件
+func runRecipe(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("recipe", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	write := fs.Bool("w", false, "所有步骤都成功时将结果写回目标文件")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: astutil recipe [-w] recipe.yaml")
+		return exitUsage
+	}
+	path := fs.Arg(0)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "astutil recipe: %v\n", err)
+		return exitError
+	}
+	recipe, err := parseRecipe(data)
+	if err != nil {
+		fmt.Fprintf(stderr, "astutil recipe: %s: %v\n", path, err)
+		return exitError
+	}
+	results, err := ozastutil.ExecRecipe(recipe, filepath.Dir(path), *write)
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if results != nil {
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(stderr, "astutil recipe: %v\n", err)
+			return exitError
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "astutil recipe: %v\n", err)
+		return exitError
+	}
+	for _, result := range results {
+		if result.Result == ozastutil.EditApplied {
+			return exitApplied
+		}
+	}
+	return exitUnchanged
+}
+
+// parseRecipe 解析 recipe，以 { 开头时交给 ozastutil.ParseRecipe 按 JSON 解析，否则按 YAML 解析
+//  库只依赖标准库，YAML 只在命令行中解析
+func parseRecipe(data []byte) (*ozastutil.Recipe, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		return ozastutil.ParseRecipe(data)
+	}
+	recipe := &ozastutil.Recipe{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(recipe); err != nil {
+		return nil, err
+	}
+	if err := recipe.Validate(); err != nil {
+		return nil, err
+	}
+	return recipe, nil
+}
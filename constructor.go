@@ -0,0 +1,161 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// GenerateConstructor 为 struct 生成构造函数 NewXxx，参数为 fields 中的成员，fields 为空时为所有成员
+//
+// 生成的函数带有 //astutil:gen constructor Xxx 标记，成员变化后再次执行会原位更新
+//
+// 测试数据：
+//
+// type Stu struct {
+//	name string
+//	Age  int
+// }
+//
+// 执行：GenerateConstructor(f, "Stu")
+//
+// 结果为：
+//
+// // NewStu 创建 Stu
+// //
+// //astutil:gen constructor Stu
+// func NewStu(name string, age int) *Stu {
+//	return &Stu{
+//		name: name,
+//		Age:  age,
+//	}
+// }
+func GenerateConstructor(f *ast.File, structName string, fields ...string) bool {
+	list, ok := findStructFields(f, structName, fields...)
+	if !ok {
+		return false
+	}
+	params := make([]string, 0, len(list))
+	values := make([]string, 0, len(list))
+	used := make([]string, 0, len(list))
+	for _, field := range list {
+		name := paramName(field.name, used...)
+		used = append(used, name)
+		params = append(params, name+" "+exprString(field.typ))
+		values = append(values, field.name+": "+name+",")
+	}
+	src := genDoc("constructor", structName, fmt.Sprintf("New%s 创建 %s", structName, structName))
+	src += fmt.Sprintf("func New%s(%s) *%s {\nreturn &%s{\n%s}\n}\n",
+		structName, strings.Join(params, ", "), structName, structName, joinLines(values))
+	return applyGen(f, "constructor", structName, []string{src}, getInsertIndex(f, &AstInsertPos{After: structName}, "", ""))
+}
+
+// GenerateAccessors 为 struct 的成员生成 GetXxx 及 SetXxx 方法，fields 为空时为所有成员生成
+//
+// 生成的方法带有 //astutil:gen accessor Xxx 标记，成员变化后再次执行会原位更新，已删除成员的方法会被删除。
+// 已存在不带标记的同名方法时不会覆盖
+//
+// 测试数据：
+//
+// type Stu struct {
+//	name string
+// }
+//
+// 执行：GenerateAccessors(f, "Stu")
+//
+// 结果为：
+//
+// // GetName 返回 name
+// //
+// //astutil:gen accessor Stu
+// func (s *Stu) GetName() string {
+//	return s.name
+// }
+//
+// // SetName 设置 name
+// //
+// //astutil:gen accessor Stu
+// func (s *Stu) SetName(name string) {
+//	s.name = name
+// }
+func GenerateAccessors(f *ast.File, structName string, fields ...string) bool {
+	list, ok := findStructFields(f, structName, fields...)
+	if !ok {
+		return false
+	}
+	recv := recvNameOf(typeMethodList([]*ast.File{f}, structName), structName)
+	srcs := make([]string, 0, len(list)*2)
+	for _, field := range list {
+		name := exportedName(field.name)
+		typ := exprString(field.typ)
+		param := paramName(field.name, recv)
+		src := genDoc("accessor", structName, fmt.Sprintf("Get%s 返回 %s", name, field.name))
+		src += fmt.Sprintf("func (%s *%s) Get%s() %s {\nreturn %s.%s\n}\n", recv, structName, name, typ, recv, field.name)
+		srcs = append(srcs, src)
+		src = genDoc("accessor", structName, fmt.Sprintf("Set%s 设置 %s", name, field.name))
+		src += fmt.Sprintf("func (%s *%s) Set%s(%s %s) {\n%s.%s = %s\n}\n", recv, structName, name, param, typ, recv, field.name, param)
+		srcs = append(srcs, src)
+	}
+	index := getInsertIndex(f, &AstInsertPos{AfterMethods: true}, structName, "")
+	return applyGen(f, "accessor", structName, srcs, index)
+}
+
+// GenerateOptions 为 struct 生成函数式选项，optionName 为选项类型名称，为空时为 struct 名称加 Option，如 StuOption
+//
+// 生成的声明带有 //astutil:gen option Xxx 标记，成员变化后再次执行会原位更新，已删除成员的选项会被删除。
+// 选项类型或 WithXxx 函数与文件中不是为该 struct 生成的声明（如另一个 struct 的选项）同名时返回 false
+//
+// 测试数据：
+//
+// type Stu struct {
+//	name string
+// }
+//
+// 执行：GenerateOptions(f, "Stu", "")
+//
+// 结果为：
+//
+// // StuOption 为 Stu 的可选配置
+// //
+// //astutil:gen option Stu
+// type StuOption func(*Stu)
+//
+// // WithName 设置 name
+// //
+// //astutil:gen option Stu
+// func WithName(name string) StuOption {
+//	return func(s *Stu) {
+//		s.name = name
+//	}
+// }
+func GenerateOptions(f *ast.File, structName, optionName string, fields ...string) bool {
+	if optionName == "" {
+		optionName = structName + "Option"
+	}
+	list, ok := findStructFields(f, structName, fields...)
+	if !ok {
+		return false
+	}
+	names := []string{optionName}
+	for _, field := range list {
+		names = append(names, "With"+exportedName(field.name))
+	}
+	for _, name := range names {
+		if i := findDeclKey(f, name); i != -1 && !hasGenMarker(f.Decls[i], genMarker+" option "+structName) {
+			return false
+		}
+	}
+	recv := recvNameOf(typeMethodList([]*ast.File{f}, structName), structName)
+	src := genDoc("option", structName, fmt.Sprintf("%s 为 %s 的可选配置", optionName, structName))
+	src += fmt.Sprintf("type %s func(*%s)\n", optionName, structName)
+	srcs := []string{src}
+	for _, field := range list {
+		name := exportedName(field.name)
+		param := paramName(field.name, recv)
+		src := genDoc("option", structName, fmt.Sprintf("With%s 设置 %s", name, field.name))
+		src += fmt.Sprintf("func With%s(%s %s) %s {\nreturn func(%s *%s) {\n%s.%s = %s\n}\n}\n",
+			name, param, exprString(field.typ), optionName, recv, structName, recv, field.name, param)
+		srcs = append(srcs, src)
+	}
+	return applyGen(f, "option", structName, srcs, getInsertIndex(f, &AstInsertPos{After: structName}, "", ""))
+}
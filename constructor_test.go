@@ -0,0 +1,90 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"testing"
+)
+
+func TestGenerateConstructor(t *testing.T) {
+	fst, f := InitEnv("./test_demo/constructor_demo.go")
+
+	ret := GenerateConstructor(f, "User")
+	assert.True(t, ret)
+	ret = GenerateConstructor(f, "NotFound")
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "\tu    bool\n}\n\n// NewUser 创建 User\n//\n//astutil:gen constructor User\nfunc NewUser(base *Base, name string, age int, tags []string, u bool) *User {\n\treturn &User{\n\t\tBase: base,\n\t\tname: name,\n\t\tAge:  age,\n\t\ttags: tags,\n\t\tu:    u,\n\t}\n}\n\nfunc (u *User) String()")
+
+	// 新增成员后原位更新
+	AddKVToStruct(f, "User", "Type", "string")
+	ret = GenerateConstructor(f, "User", "name", "Type")
+	assert.True(t, ret)
+	src, err = formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "}\n\n// NewUser 创建 User\n//\n//astutil:gen constructor User\nfunc NewUser(name string, type_ string) *User {\n\treturn &User{\n\t\tname: name,\n\t\tType: type_,\n\t}\n}\n\nfunc (u *User) String()")
+	PrintResult(fst, f)
+}
+
+func TestGenerateAccessors(t *testing.T) {
+	fst, f := InitEnv("./test_demo/constructor_demo.go")
+
+	ret := GenerateAccessors(f, "User", "name", "Age", "tags", "u")
+	assert.True(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	// 手写的 GetAge 不覆盖，与接收者同名的参数需要改名
+	assert.Contains(t, string(src), "func (u *User) GetAge() int {\n\treturn u.Age\n}\n\n// GetName 返回 name\n//\n//astutil:gen accessor User\nfunc (u *User) GetName() string {\n\treturn u.name\n}\n\n// SetName 设置 name\n")
+	assert.Contains(t, string(src), "func (u *User) SetAge(age int) {\n\tu.Age = age\n}")
+	assert.Contains(t, string(src), "func (u *User) SetU(u_ bool) {\n\tu.u = u_\n}")
+
+	// 删除成员后再次生成，已删除成员的方法随之删除，其他方法原位更新
+	spec := findTypeSpec(f, "User")
+	fields := spec.Type.(*ast.StructType).Fields
+	fields.List = append(fields.List[:3], fields.List[4:]...)
+	AddKVToStruct(f, "User", "email", "string")
+	ret = GenerateAccessors(f, "User")
+	assert.True(t, ret)
+	src, err = formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(src), "GetTags")
+	assert.Contains(t, string(src), "func (u *User) SetU(u_ bool) {\n\tu.u = u_\n}\n\n// GetBase 返回 Base\n")
+	assert.Contains(t, string(src), "// SetEmail 设置 email\n//\n//astutil:gen accessor User\nfunc (u *User) SetEmail(email string) {\n\tu.email = email\n}\n")
+	PrintResult(fst, f)
+}
+
+func TestGenerateOptions(t *testing.T) {
+	fst, f := InitEnv("./test_demo/constructor_demo.go")
+
+	ret := GenerateOptions(f, "User", "", "name", "tags")
+	assert.True(t, ret)
+	ret = GenerateOptions(f, "User", "", "name")
+	assert.True(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "\tu    bool\n}\n\n// UserOption 为 User 的可选配置\n//\n//astutil:gen option User\ntype UserOption func(*User)\n\n// WithName 设置 name\n//\n//astutil:gen option User\nfunc WithName(name string) UserOption {\n\treturn func(u *User) {\n\t\tu.name = name\n\t}\n}\n\nfunc (u *User) String()")
+	assert.NotContains(t, string(src), "WithTags")
+	PrintResult(fst, f)
+}
+
+func TestGenerateOptionsTwoStructs(t *testing.T) {
+	fst, f := InitEnv("./test_demo/constructor_demo.go")
+
+	assert.True(t, GenerateOptions(f, "User", "", "name"))
+	// 同一个文件中的第二个 struct 使用自己的选项类型
+	assert.True(t, GenerateOptions(f, "Base", ""))
+	// 选项类型已属于其他 struct
+	assert.False(t, GenerateOptions(f, "Base", "UserOption"))
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "type UserOption func(*User)")
+	assert.Contains(t, string(src), "func WithName(name string) UserOption {")
+	assert.Contains(t, string(src), "type BaseOption func(*Base)")
+	assert.Contains(t, string(src), "func WithID(id int) BaseOption {\n\treturn func(b *Base) {\n\t\tb.ID = id\n\t}\n}")
+	PrintResult(fst, f)
+}
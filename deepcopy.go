@@ -0,0 +1,178 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// GenerateDeepCopy 为 struct 生成 DeepCopy 方法，复制指针、slice、map 指向的数据，
+// 同一文件中需要深拷贝的 struct 成员会一并生成 DeepCopy 方法。interface、func、chan 及其他包的类型只复制值
+//
+// 生成的方法带有 //astutil:gen deepcopy Xxx 标记，成员变化后再次执行会原位更新
+//
+// 测试数据：
+//
+// type Stu struct {
+//	name string
+//	tags []string
+//	next *Stu
+// }
+//
+// 执行：GenerateDeepCopy(f, "Stu")
+//
+// 结果为：
+//
+// // DeepCopy 返回 Stu 的深拷贝
+// //
+// //astutil:gen deepcopy Stu
+// func (s *Stu) DeepCopy() *Stu {
+//	if s == nil {
+//		return nil
+//	}
+//	out := new(Stu)
+//	*out = *s
+//	if s.tags != nil {
+//		out.tags = make([]string, len(s.tags))
+//		copy(out.tags, s.tags)
+//	}
+//	out.next = s.next.DeepCopy()
+//	return out
+// }
+func GenerateDeepCopy(f *ast.File, structName string) bool {
+	g := &deepCopier{f: f, done: make(map[string]bool)}
+	return g.generate(structName)
+}
+
+// deepCopier 生成 DeepCopy 方法，记录已生成的 struct
+type deepCopier struct {
+	f    *ast.File
+	done map[string]bool
+	// pending 需要一并生成 DeepCopy 的 struct
+	pending []string
+}
+
+// generate 为 struct 及其依赖的 struct 生成 DeepCopy 方法
+func (g *deepCopier) generate(structName string) bool {
+	g.pending = append(g.pending, structName)
+	for len(g.pending) > 0 {
+		name := g.pending[0]
+		g.pending = g.pending[1:]
+		if g.done[name] {
+			continue
+		}
+		g.done[name] = true
+		list, ok := findStructFields(g.f, name)
+		if !ok {
+			return false
+		}
+		recv := recvNameOf(typeMethodList([]*ast.File{g.f}, name), name)
+		if recv == "out" {
+			recv = "in"
+		}
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "func (%s *%s) DeepCopy() *%s {\nif %s == nil {\nreturn nil\n}\n", recv, name, name, recv)
+		fmt.Fprintf(&buf, "out := new(%s)\n*out = *%s\n", name, recv)
+		for _, field := range list {
+			if g.needDeep(field.typ, nil) {
+				g.copy(&buf, "out."+field.name, recv+"."+field.name, field.typ, 1)
+			}
+		}
+		buf.WriteString("return out\n}\n")
+		src := genDoc("deepcopy", name, fmt.Sprintf("DeepCopy 返回 %s 的深拷贝", name)) + buf.String()
+		index := getInsertIndex(g.f, &AstInsertPos{AfterMethods: true}, name, "")
+		if !applyGen(g.f, "deepcopy", name, []string{src}, index) {
+			return false
+		}
+	}
+	return true
+}
+
+// needDeep 判断类型是否需要深拷贝，visiting 记录正在判断的 struct，避免循环引用
+func (g *deepCopier) needDeep(typ ast.Expr, visiting map[string]bool) bool {
+	switch t := typ.(type) {
+	case *ast.ParenExpr:
+		return g.needDeep(t.X, visiting)
+	case *ast.StarExpr, *ast.MapType:
+		return true
+	case *ast.ArrayType:
+		return t.Len == nil || g.needDeep(t.Elt, visiting)
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if g.needDeep(field.Type, visiting) {
+				return true
+			}
+		}
+	case *ast.Ident:
+		spec := findLocalType(g.f, t)
+		if spec == nil || visiting[t.Name] {
+			return false
+		}
+		if visiting == nil {
+			visiting = make(map[string]bool)
+		}
+		visiting[t.Name] = true
+		return g.needDeep(spec.Type, visiting)
+	}
+	return false
+}
+
+// copy 生成将 src 深拷贝到 dst 的语句，dst 已经是 src 的浅拷贝。depth 用于生成不冲突的循环变量名称
+func (g *deepCopier) copy(buf *strings.Builder, dst, src string, typ ast.Expr, depth int) {
+	underlying := typ
+	if spec := findLocalType(g.f, typ); spec != nil {
+		if _, ok := spec.Type.(*ast.StructType); ok {
+			g.pending = append(g.pending, spec.Name.Name)
+			fmt.Fprintf(buf, "%s = *%s.DeepCopy()\n", dst, src)
+			return
+		}
+		underlying = spec.Type
+	}
+	switch t := underlying.(type) {
+	case *ast.ParenExpr:
+		g.copy(buf, dst, src, t.X, depth)
+	case *ast.StarExpr:
+		if typ == underlying && isLocalStruct(g.f, t.X) {
+			g.pending = append(g.pending, t.X.(*ast.Ident).Name)
+			fmt.Fprintf(buf, "%s = %s.DeepCopy()\n", dst, src)
+			return
+		}
+		fmt.Fprintf(buf, "if %s != nil {\n%s = new(%s)\n*%s = *%s\n", src, dst, exprString(t.X), dst, src)
+		if g.needDeep(t.X, nil) {
+			g.copy(buf, "(*"+dst+")", "(*"+src+")", t.X, depth+1)
+		}
+		buf.WriteString("}\n")
+	case *ast.ArrayType:
+		i := fmt.Sprintf("i%d", depth)
+		if t.Len == nil {
+			fmt.Fprintf(buf, "if %s != nil {\n%s = make(%s, len(%s))\ncopy(%s, %s)\n", src, dst, exprString(typ), src, dst, src)
+		}
+		if g.needDeep(t.Elt, nil) {
+			fmt.Fprintf(buf, "for %s := range %s {\n", i, src)
+			g.copy(buf, dst+"["+i+"]", src+"["+i+"]", t.Elt, depth+1)
+			buf.WriteString("}\n")
+		}
+		if t.Len == nil {
+			buf.WriteString("}\n")
+		}
+	case *ast.MapType:
+		k, v, c := fmt.Sprintf("k%d", depth), fmt.Sprintf("v%d", depth), fmt.Sprintf("c%d", depth)
+		fmt.Fprintf(buf, "if %s != nil {\n%s = make(%s, len(%s))\nfor %s, %s := range %s {\n", src, dst, exprString(typ), src, k, v, src)
+		if g.needDeep(t.Value, nil) {
+			// map 的元素不可寻址，先复制到变量中
+			fmt.Fprintf(buf, "%s := %s\n", c, v)
+			g.copy(buf, c, v, t.Value, depth+1)
+			v = c
+		}
+		fmt.Fprintf(buf, "%s[%s] = %s\n}\n}\n", dst, k, v)
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if !g.needDeep(field.Type, nil) {
+				continue
+			}
+			for _, name := range fieldNamesOf(field) {
+				g.copy(buf, dst+"."+name, src+"."+name, field.Type, depth)
+			}
+		}
+	}
+}
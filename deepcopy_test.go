@@ -0,0 +1,86 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGenerateDeepCopy(t *testing.T) {
+	fst, f := InitEnv("./test_demo/builder_demo.go")
+
+	ret := GenerateDeepCopy(f, "Node")
+	assert.True(t, ret)
+	ret = GenerateDeepCopy(f, "NotFound")
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), `func (n *Node) DeepCopy() *Node {
+	if n == nil {
+		return nil
+	}
+	out := new(Node)
+	*out = *n
+	out.Next = n.Next.DeepCopy()
+	if n.Children != nil {
+		out.Children = make([]*Node, len(n.Children))
+		copy(out.Children, n.Children)
+		for i1 := range n.Children {
+			out.Children[i1] = n.Children[i1].DeepCopy()
+		}
+	}
+	if n.Attrs != nil {
+		out.Attrs = make(map[string][]string, len(n.Attrs))
+		for k1, v1 := range n.Attrs {
+			c1 := v1
+			if v1 != nil {
+				c1 = make([]string, len(v1))
+				copy(c1, v1)
+			}
+			out.Attrs[k1] = c1
+		}
+	}
+	out.Meta = *n.Meta.DeepCopy()
+	for i1 := range n.Grid {
+		if n.Grid[i1] != nil {
+			out.Grid[i1] = make([]int, len(n.Grid[i1]))
+			copy(out.Grid[i1], n.Grid[i1])
+		}
+	}
+	if n.ptr != nil {
+		out.ptr = new(int)
+		*out.ptr = *n.ptr
+	}
+	if n.Tags != nil {
+		out.Tags = make(Tags, len(n.Tags))
+		copy(out.Tags, n.Tags)
+	}
+	return out
+}`)
+	// 依赖的 struct 一并生成
+	assert.Contains(t, string(src), `func (m *Meta) DeepCopy() *Meta {
+	if m == nil {
+		return nil
+	}
+	out := new(Meta)
+	*out = *m
+	if m.Labels != nil {
+		out.Labels = make(map[string]string, len(m.Labels))
+		for k1, v1 := range m.Labels {
+			out.Labels[k1] = v1
+		}
+	}
+	if m.inline.Values != nil {
+		out.inline.Values = make([]int, len(m.inline.Values))
+		copy(out.inline.Values, m.inline.Values)
+	}
+	return out
+}`)
+	// 再次生成时原位更新
+	ret = GenerateDeepCopy(f, "Meta")
+	assert.True(t, ret)
+	src2, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(src), string(src2))
+	PrintResult(fst, f)
+}
@@ -0,0 +1,206 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"sync"
+)
+
+// 幂等模式
+//
+// 生成器每次运行都会重复调用同样的修改，幂等模式下修改类 API 先检查要做的修改是否已经存在，
+// 已经存在时不再修改，直接返回 true，并将本次修改的结果记为 EditUnchanged。
+// 可以用 SetIdempotent 对整个文件开启，也可以用 Ensure 对单次调用开启。
+//
+// 以下修改以位置或数量为参数，无法判断是否已经执行过，不受幂等模式影响：
+// RemoveResultFromFunc、AddArgToCalls、RemoveArgFromCalls、ExtractInterface、GenerateMock、DeleteNode
+
+// EditResult 修改的结果
+type EditResult int
+
+const (
+	// EditFailed 修改失败，如找不到目标、参数不合法
+	EditFailed EditResult = iota
+	// EditApplied 修改已执行
+	EditApplied
+	// EditUnchanged 幂等模式下修改已经存在，没有重复执行
+	EditUnchanged
+)
+
+func (r EditResult) String() string {
+	switch r {
+	case EditApplied:
+		return "applied"
+	case EditUnchanged:
+		return "unchanged"
+	}
+	return "failed"
+}
+
+// MarshalText 输出结果名称，便于序列化为 JSON
+func (r EditResult) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText 解析结果名称
+func (r *EditResult) UnmarshalText(text []byte) error {
+	for _, v := range []EditResult{EditFailed, EditApplied, EditUnchanged} {
+		if v.String() == string(text) {
+			*r = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown edit result %q", text)
+}
+
+// editState 文件的幂等模式、自动加引号及最近一次修改是否因已存在而跳过
+type editState struct {
+	idempotent bool
+	autoQuote  bool
+	unchanged  bool
+}
+
+// editStates 保存 *ast.File => *editState
+var editStates sync.Map
+
+func getEditState(f *ast.File) *editState {
+	s, _ := editStates.LoadOrStore(f, &editState{})
+	return s.(*editState)
+}
+
+// SetIdempotent 开启或关闭文件的幂等模式
+func SetIdempotent(f *ast.File, on bool) {
+	getEditState(f).idempotent = on
+}
+
+// IsIdempotent 判断文件是否开启了幂等模式
+func IsIdempotent(f *ast.File) bool {
+	s, ok := editStates.Load(f)
+	return ok && s.(*editState).idempotent
+}
+
+// Result 返回修改的结果，ok 为修改类 API 的返回值
+//
+// 例子：
+//
+// SetIdempotent(f, true)
+//
+// r := Result(f, AddValueToSlice(f, "sliceStr", AddQuote("hello")))
+//
+// 第一次执行 r 为 EditApplied，再次执行为 EditUnchanged
+func Result(f *ast.File, ok bool) EditResult {
+	s := getEditState(f)
+	unchanged := s.unchanged
+	s.unchanged = false
+	switch {
+	case !ok:
+		return EditFailed
+	case unchanged:
+		return EditUnchanged
+	}
+	return EditApplied
+}
+
+// Ensure 以幂等模式执行一次修改，执行后恢复文件原来的模式
+//
+// 例子：Ensure(f, func() bool { return AddFunc(f, &AstFunc{Name: "Hello"}) })
+func Ensure(f *ast.File, edit func() bool) EditResult {
+	s := getEditState(f)
+	prev := s.idempotent
+	s.idempotent = true
+	defer func() {
+		s.idempotent = prev
+	}()
+	return runEdit(f, edit)
+}
+
+// runEdit 执行一次修改并返回结果，执行前清除上一次修改留下的 unchanged 标记，
+// 避免修改在调用 skipApplied 之前失败或者不检查是否已存在时沿用上一次的结果
+func runEdit(f *ast.File, edit func() bool) EditResult {
+	if s, ok := editStates.Load(f); ok {
+		s.(*editState).unchanged = false
+	}
+	return Result(f, edit())
+}
+
+// skipApplied 记录修改是否已经存在，幂等模式下已经存在时返回 true，调用方不再修改，直接返回成功
+//  每个修改类 API 在真正修改之前调用一次
+func skipApplied(f *ast.File, exists bool) bool {
+	s, ok := editStates.Load(f)
+	if !ok {
+		return false
+	}
+	state := s.(*editState)
+	state.unchanged = exists && state.idempotent
+	return state.unchanged
+}
+
+// sameNode 判断两个节点的源码是否相同，不比较注释及换行
+func sameNode(a, b ast.Node) bool {
+	return exprString(a) == exprString(b)
+}
+
+// hasExpr 判断列表中是否存在源码相同的表达式
+func hasExpr(list []ast.Expr, expr ast.Expr) bool {
+	for _, x := range list {
+		if sameNode(x, expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasStmt 判断代码块中（包括嵌套的代码块）是否存在源码相同的语句
+func hasStmt(body *ast.BlockStmt, stmt ast.Stmt) bool {
+	want := exprString(stmt)
+	found := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		if s, ok := node.(ast.Stmt); ok && s != body && exprString(s) == want {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// hasField 判断 struct 或 interface 中是否存在名称及类型都相同的成员
+func hasField(list *ast.FieldList, field *ast.Field) bool {
+	want := fieldString(field)
+	for _, x := range list.List {
+		if fieldString(x) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldString 返回成员的名称及类型，不包括注释
+func fieldString(field *ast.Field) string {
+	text := ""
+	for _, name := range field.Names {
+		text += name.Name + ","
+	}
+	text += exprString(field.Type)
+	if field.Tag != nil {
+		text += " " + field.Tag.Value
+	}
+	return text
+}
+
+// hasSameFunc 判断文件中是否存在源码相同的函数，不比较文档注释
+func hasSameFunc(f *ast.File, fd *ast.FuncDecl) bool {
+	want := funcString(fd)
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok && d.Name.Name == fd.Name.Name && funcString(d) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// funcString 返回函数去掉文档注释后的源码
+func funcString(fd *ast.FuncDecl) string {
+	nd := *fd
+	nd.Doc = nil
+	return exprString(&nd)
+}
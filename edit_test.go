@@ -0,0 +1,65 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIdempotent(t *testing.T) {
+	fst, f := InitEnv("./test_demo/edit_demo.go")
+	SetIdempotent(f, true)
+	assert.True(t, IsIdempotent(f))
+
+	edits := []func() bool{
+		func() bool { return AddImport(fst, f, "", "strings") },
+		func() bool { return AddFunc(f, &AstFunc{Name: "Hello", Body: "fmt.Println(1)"}) },
+		func() bool { return AddFuncAt(f, &AstFunc{Name: "Hi"}, &AstInsertPos{After: "Setup"}) },
+		func() bool { return DeleteFunc(f, "Old") },
+		func() bool { return RenameFunc(f, "Rename", "Renamed") },
+		func() bool { return ReplaceFunc(f, "Replace", "func Replace() {\n\tfmt.Println(2)\n}") },
+		func() bool { return AddValueToSlice(f, "routes", AddQuote("/a")) },
+		func() bool { return AddValueToMap(f, "handlers", AddQuote("b"), "2") },
+		func() bool { return AddValueToCaller(f, "set", "2") },
+		func() bool { return AddKVToUnaryStruct(f, "conf", "Name", AddQuote("conf")) },
+		func() bool { return AddKVToFuncUnaryStruct(f, "Setup", "stu", "Name", AddQuote("stu")) },
+		func() bool { return AddVarToFunc(f, "Setup", "b", "1", "stu", "var") },
+		func() bool {
+			return AddCallBlockToFunc(f, "Setup", []AstCallExpr{{FunName: "fmt", FunSel: "Println", Args: []string{"b"}}}, "")
+		},
+		func() bool { return AddKVToStruct(f, "Stu", "Age", "int") },
+		func() bool { return AddFuncToInterface(f, "Service", &AstFunc{Name: "Put"}) },
+		func() bool { return AddVarAfterVar(f, "v1", "1", "routes") },
+		func() bool { return AddParamToFunc(f, "Setup", "n", "int64") },
+		func() bool { return RenameParamInFunc(f, "Setup", "a", "name") },
+		func() bool { return ChangeParamType(f, "Setup", "name", "interface{}") },
+		func() bool { return AddResultToFunc(f, "Setup", "", "error", "") },
+		func() bool { return GenerateConstructor(f, "Stu") },
+		func() bool { return ImplementInterface(nil, f, "Service", "*Stu", &AstImplOption{Assert: true}) },
+	}
+	for i, edit := range edits {
+		assert.Equal(t, EditApplied, Result(f, edit()), "edit %d", i)
+	}
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+
+	// 再次执行时修改都已存在
+	for i, edit := range edits {
+		assert.Equal(t, EditUnchanged, Result(f, edit()), "edit %d", i)
+	}
+	again, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(src), string(again))
+
+	// 关闭幂等模式后照常修改
+	SetIdempotent(f, false)
+	assert.Equal(t, EditApplied, Result(f, AddValueToSlice(f, "routes", AddQuote("/a"))))
+	assert.Equal(t, EditFailed, Result(f, DeleteFunc(f, "Old")))
+	assert.Equal(t, EditFailed, Result(f, AddValueToSlice(f, "notfound", AddQuote("/a"))))
+
+	// 单次调用开启幂等模式
+	assert.Equal(t, EditUnchanged, Ensure(f, func() bool { return AddKVToStruct(f, "Stu", "Age", "int") }))
+	assert.Equal(t, EditApplied, Ensure(f, func() bool { return AddKVToStruct(f, "Stu", "Score", "int") }))
+	assert.False(t, IsIdempotent(f))
+	assert.Equal(t, "unchanged", EditUnchanged.String())
+	PrintResult(fst, f)
+}
@@ -0,0 +1,296 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// Editor 链式修改一个文件，每一步失败时记录错误并继续执行后面的步骤，最后由 Err 或 Save 统一返回
+//
+// Struct、Interface、Func 选择后续 Field、Method、Append、Param 操作的目标
+//
+// 例子：
+//
+// err := Edit(f).Import("fmt").Struct("Stu").Field("Age", "int").Func("Stu.Hello").Append("fmt.Println(1)").Save()
+type Editor struct {
+	fset *token.FileSet
+	f    *ast.File
+	// owned 为 true 时文件由 EditFile 加载，Close 时释放
+	owned bool
+
+	structName string
+	infName    string
+	funcName   string
+
+	errs []error
+}
+
+// EditErrors 链式修改中所有失败步骤的错误
+type EditErrors []error
+
+func (e EditErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Edit 开始修改文件，文件需要由 InitEnv 加载或者用 BindFileSet 关联 FileSet
+func Edit(f *ast.File) *Editor {
+	e := &Editor{f: f}
+	if fset, ok := fileSets.Load(f); ok {
+		e.fset = fset.(*token.FileSet)
+	} else {
+		e.fail("Edit", "file set not bound")
+	}
+	return e
+}
+
+// EditFile 加载文件并开始修改，加载失败时后续步骤都不执行，错误由 Err 或 Save 返回
+//  修改完成后调用 Close 释放文件的状态
+func EditFile(path string) *Editor {
+	fset := token.NewFileSet()
+	f, err := parseFile(fset, path)
+	if err != nil {
+		return &Editor{errs: []error{err}}
+	}
+	return &Editor{fset: fset, f: f, owned: true}
+}
+
+// File 返回正在修改的文件
+func (e *Editor) File() *ast.File {
+	return e.f
+}
+
+// FileSet 返回文件的 FileSet
+func (e *Editor) FileSet() *token.FileSet {
+	return e.fset
+}
+
+// loaded 判断文件及 FileSet 是否可用
+func (e *Editor) loaded() bool {
+	return e.f != nil && e.fset != nil
+}
+
+// fail 记录失败的步骤
+func (e *Editor) fail(op, format string, args ...interface{}) *Editor {
+	e.errs = append(e.errs, fmt.Errorf("%s: %s", op, fmt.Sprintf(format, args...)))
+	return e
+}
+
+// do 执行一个修改，返回 false 时记录错误，文件不可用时不执行
+func (e *Editor) do(op string, edit func() bool) *Editor {
+	if !e.loaded() {
+		return e
+	}
+	if !edit() {
+		return e.fail(op, "failed")
+	}
+	return e
+}
+
+// Idempotent 对文件开启幂等模式，已存在的修改不再重复执行
+func (e *Editor) Idempotent() *Editor {
+	if e.loaded() {
+		SetIdempotent(e.f, true)
+	}
+	return e
+}
+
+// AutoQuote 对文件开启自动加引号，元素类型为 string 时原始字符串自动加上双引号
+func (e *Editor) AutoQuote() *Editor {
+	if e.loaded() {
+		SetAutoQuote(e.f, true)
+	}
+	return e
+}
+
+// Import 添加 import
+func (e *Editor) Import(path string) *Editor {
+	return e.ImportAs("", path)
+}
+
+// ImportAs 添加带别名的 import
+func (e *Editor) ImportAs(name, path string) *Editor {
+	return e.do(fmt.Sprintf("Import(%q)", path), func() bool {
+		return AddImport(e.fset, e.f, name, path)
+	})
+}
+
+// Struct 选择 struct，后续的 Field 添加到该 struct 中
+func (e *Editor) Struct(name string) *Editor {
+	e.structName = name
+	if !e.loaded() {
+		return e
+	}
+	if spec := findTypeSpec(e.f, name); spec == nil {
+		return e.fail(fmt.Sprintf("Struct(%q)", name), "struct not found")
+	} else if _, ok := spec.Type.(*ast.StructType); !ok {
+		return e.fail(fmt.Sprintf("Struct(%q)", name), "not a struct")
+	}
+	return e
+}
+
+// Field 为选择的 struct 添加成员
+func (e *Editor) Field(name, typ string) *Editor {
+	op := fmt.Sprintf("Field(%q, %q)", name, typ)
+	if e.structName == "" {
+		return e.fail(op, "no struct selected")
+	}
+	return e.do(op, func() bool {
+		return AddKVToStruct(e.f, e.structName, name, typ)
+	})
+}
+
+// Interface 选择 interface，后续的 Method 添加到该 interface 中
+func (e *Editor) Interface(name string) *Editor {
+	e.infName = name
+	if !e.loaded() {
+		return e
+	}
+	if spec := findTypeSpec(e.f, name); spec == nil {
+		return e.fail(fmt.Sprintf("Interface(%q)", name), "interface not found")
+	} else if _, ok := spec.Type.(*ast.InterfaceType); !ok {
+		return e.fail(fmt.Sprintf("Interface(%q)", name), "not an interface")
+	}
+	return e
+}
+
+// Method 为选择的 interface 添加方法
+func (e *Editor) Method(params *AstFunc) *Editor {
+	op := fmt.Sprintf("Method(%q)", params.Name)
+	if e.infName == "" {
+		return e.fail(op, "no interface selected")
+	}
+	return e.do(op, func() bool {
+		return AddFuncToInterface(e.f, e.infName, params)
+	})
+}
+
+// AddFunc 添加函数并选择该函数，pos 为 nil 时添加到文件末尾
+func (e *Editor) AddFunc(params *AstFunc, pos *AstInsertPos) *Editor {
+	e.funcName = params.Name
+	if params.Recv != nil {
+		if expr, err := parser.ParseExpr(params.Recv.Value); err == nil {
+			e.funcName = typeName(expr) + "." + params.Name
+		}
+	}
+	return e.do(fmt.Sprintf("AddFunc(%q)", params.Name), func() bool {
+		return AddFuncAt(e.f, params, pos)
+	})
+}
+
+// Func 选择函数，后续的 Append、Param 修改该函数，名称格式见 findFunc
+func (e *Editor) Func(name string) *Editor {
+	e.funcName = name
+	if !e.loaded() {
+		return e
+	}
+	if _, fd := findFunc(e.f, name); fd == nil || fd.Body == nil {
+		return e.fail(fmt.Sprintf("Func(%q)", name), "func not found")
+	}
+	return e
+}
+
+// Append 将语句添加到选择的函数中最后的 return 之前，没有 return 时添加到末尾
+//  幂等模式下所有语句都已存在时不再添加
+func (e *Editor) Append(src string) *Editor {
+	op := fmt.Sprintf("Append(%q)", src)
+	if e.funcName == "" {
+		return e.fail(op, "no func selected")
+	}
+	if !e.loaded() {
+		return e
+	}
+	_, fd := findFunc(e.f, e.funcName)
+	if fd == nil || fd.Body == nil {
+		return e.fail(op, "func %s not found", e.funcName)
+	}
+	stmts, err := parseStmts(src)
+	if err != nil {
+		return e.fail(op, "%v", err)
+	}
+	exists := true
+	for _, stmt := range stmts {
+		if !hasStmt(fd.Body, stmt) {
+			exists = false
+		}
+	}
+	if skipApplied(e.f, exists) {
+		return e
+	}
+	if !insertNode(e.f, fd.Body, stmtInsertIndex(fd, ""), stmtSource(stmts...)) {
+		return e.fail(op, "failed")
+	}
+	return e
+}
+
+// Param 为选择的函数添加参数
+func (e *Editor) Param(name, typ string) *Editor {
+	op := fmt.Sprintf("Param(%q, %q)", name, typ)
+	if e.funcName == "" {
+		return e.fail(op, "no func selected")
+	}
+	return e.do(op, func() bool {
+		return AddParamToFunc(e.f, e.funcName, name, typ)
+	})
+}
+
+// MapValue 为 map 变量添加键值对
+func (e *Editor) MapValue(varName, key, value string) *Editor {
+	return e.do(fmt.Sprintf("MapValue(%q, %q)", varName, key), func() bool {
+		return AddValueToMap(e.f, varName, key, value)
+	})
+}
+
+// SliceValue 为 slice 变量添加元素
+func (e *Editor) SliceValue(varName, value string) *Editor {
+	return e.do(fmt.Sprintf("SliceValue(%q, %q)", varName, value), func() bool {
+		return AddValueToSlice(e.f, varName, value)
+	})
+}
+
+// Do 执行链式方法没有覆盖的修改，如 Do("GenerateConstructor", func(fset *token.FileSet, f *ast.File) bool {...})
+func (e *Editor) Do(op string, edit func(fset *token.FileSet, f *ast.File) bool) *Editor {
+	return e.do(op, func() bool {
+		return edit(e.fset, e.f)
+	})
+}
+
+// Err 返回所有失败步骤的错误，类型为 EditErrors，全部成功时返回 nil
+func (e *Editor) Err() error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+	return EditErrors(e.errs)
+}
+
+// Source 返回修改后的源码，有步骤失败时返回错误
+func (e *Editor) Source() ([]byte, error) {
+	if err := e.Err(); err != nil {
+		return nil, err
+	}
+	return formatFile(e.fset, e.f)
+}
+
+// Save 将修改写回文件，有步骤失败时不写入并返回所有错误
+func (e *Editor) Save() error {
+	if err := e.Err(); err != nil {
+		return err
+	}
+	return WriteToFile(e.fset, e.f, e.fset.Position(e.f.Package).Filename)
+}
+
+// Close 释放由 EditFile 加载的文件的状态（见 ReleaseFile），由 Edit 传入的文件由调用方释放。
+// 关闭后不能再修改或输出文件
+func (e *Editor) Close() {
+	if e.owned {
+		ReleaseFile(e.f)
+		e.owned = false
+	}
+	e.f, e.fset = nil, nil
+}
@@ -0,0 +1,92 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEditor(t *testing.T) {
+	_, f := InitEnv("./test_demo/edit_demo.go")
+	e := Edit(f).
+		Import("strings").
+		Struct("Stu").Field("Age", "int").
+		AddFunc(&AstFunc{Name: "Hello", Recv: &AstKv{Key: "s", Value: "*Stu"}}, &AstInsertPos{After: "Stu"}).
+		Append("fmt.Println(1)").
+		Param("name", "string").
+		Func("Setup").Append("fmt.Println(2)\nfmt.Println(3)").
+		Interface("Service").Method(&AstFunc{Name: "Put"}).
+		MapValue("handlers", AddQuote("b"), "2").
+		SliceValue("routes", AddQuote("/a")).
+		Do("GenerateConstructor", func(fset *token.FileSet, f *ast.File) bool {
+			return GenerateConstructor(f, "Stu")
+		})
+	assert.NoError(t, e.Err())
+
+	src, err := e.Source()
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "\t\"strings\"\n")
+	assert.Contains(t, string(src), "\tAge  int\n")
+	assert.Contains(t, string(src), "func (s *Stu) Hello(name string) {\n\tfmt.Println(1)\n}")
+	assert.Contains(t, string(src), "\tfmt.Println(a, stu)\n\tfmt.Println(2)\n\tfmt.Println(3)\n}")
+	assert.Contains(t, string(src), "\tPut()\n")
+	assert.Contains(t, string(src), "func NewStu(")
+	PrintResult(e.FileSet(), e.File())
+}
+
+func TestEditorErrors(t *testing.T) {
+	_, f := InitEnv("./test_demo/edit_demo.go")
+	err := Edit(f).
+		Struct("NotFound").Field("Age", "int").
+		Append("fmt.Println(1)").
+		Func("Setup").Append("fmt.Println(").
+		SliceValue("routes", AddQuote("/a")).
+		Save()
+	assert.Error(t, err)
+	errs, ok := err.(EditErrors)
+	assert.True(t, ok)
+	assert.Equal(t, 4, len(errs))
+	assert.Equal(t, `Struct("NotFound"): struct not found`, errs[0].Error())
+	assert.Equal(t, `Field("Age", "int"): failed`, errs[1].Error())
+	assert.Equal(t, `Append("fmt.Println(1)"): no func selected`, errs[2].Error())
+	assert.Contains(t, errs[3].Error(), `Append("fmt.Println("): `)
+
+	// 文件没有关联 FileSet
+	err = Edit(&ast.File{Name: ast.NewIdent("p")}).Import("fmt").Save()
+	assert.Equal(t, "Edit: file set not bound", err.Error())
+}
+
+func TestEditFile(t *testing.T) {
+	src, err := ioutil.ReadFile("./test_demo/edit_demo.go")
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "edit_demo.go")
+	assert.NoError(t, ioutil.WriteFile(path, src, 0644))
+
+	e := EditFile(path)
+	err = e.Idempotent().Struct("Stu").Field("Age", "int").Func("Setup").Append("fmt.Println(2)").Save()
+	assert.NoError(t, err)
+	// 关闭后释放文件的状态
+	f := e.File()
+	e.Close()
+	_, ok := fileSets.Load(f)
+	assert.False(t, ok)
+	_, ok = sources.Load(f)
+	assert.False(t, ok)
+	assert.Nil(t, e.File())
+
+	// 幂等模式下再次执行不会重复添加
+	e = EditFile(path)
+	defer e.Close()
+	err = e.Idempotent().Struct("Stu").Field("Age", "int").Func("Setup").Append("fmt.Println(2)").Save()
+	assert.NoError(t, err)
+	src, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(src), "fmt.Println(2)"))
+	assert.Equal(t, 1, strings.Count(string(src), "Age"))
+
+	assert.Error(t, EditFile(filepath.Join(t.TempDir(), "notfound.go")).Import("fmt").Save())
+}
@@ -0,0 +1,337 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// GenerateEqual 为 struct 生成 Equal(other *Xxx) bool 方法，逐个成员比较，slice、map、指针比较指向的数据，
+// 同一文件中的 struct 成员调用其 Equal 方法，并一并生成。带有 astutil:"-" 标签的成员及 func 成员不参与比较，
+// 元素不参与比较的 map 只比较 key。其他包的类型及无法确定能否使用 == 的类型用 reflect.DeepEqual 比较，并导入 reflect
+//
+// 生成的方法带有 //astutil:gen equal Xxx 标记，成员变化后再次执行会原位更新
+//
+// 测试数据：
+//
+// type Stu struct {
+//	name  string
+//	tags  []string
+//	cache map[string]int `astutil:"-"`
+// }
+//
+// 执行：GenerateEqual(f, "Stu")
+//
+// 结果为：
+//
+// // Equal 判断 Stu 与 other 是否相等
+// //
+// //astutil:gen equal Stu
+// func (s *Stu) Equal(other *Stu) bool {
+//	if s == other {
+//		return true
+//	}
+//	if s == nil || other == nil {
+//		return false
+//	}
+//	if s.name != other.name {
+//		return false
+//	}
+//	if len(s.tags) != len(other.tags) {
+//		return false
+//	}
+//	for i1 := range s.tags {
+//		if s.tags[i1] != other.tags[i1] {
+//			return false
+//		}
+//	}
+//	return true
+// }
+func GenerateEqual(f *ast.File, structName string) bool {
+	g := &equalGen{f: f, done: make(map[string]bool)}
+	if !g.generate(structName, "equal", g.equalSource) {
+		return false
+	}
+	if g.deepEqual && !hasImport(f, "reflect") {
+		fset, _ := fileSets.Load(f)
+		fs, _ := fset.(*token.FileSet)
+		AddImport(fs, f, "", "reflect")
+	}
+	return true
+}
+
+// GenerateHash 为 struct 生成 Hash() uint64 方法，参与计算的成员与 GenerateEqual 一致，Equal 相等时 Hash 相等。
+// map 的计算与遍历顺序无关，同一文件中的 struct 成员调用其 Hash 方法，并一并生成
+//
+// 生成的方法带有 //astutil:gen hash Xxx 标记，并导入 fmt 及 hash/fnv
+//
+// 测试数据：
+//
+// type Stu struct {
+//	name string
+//	tags []string
+// }
+//
+// 执行：GenerateHash(fset, f, "Stu")
+//
+// 结果为：
+//
+// // Hash 返回 Stu 的哈希值
+// //
+// //astutil:gen hash Stu
+// func (s *Stu) Hash() uint64 {
+//	if s == nil {
+//		return 0
+//	}
+//	h := fnv.New64a()
+//	fmt.Fprintf(h, "%v;", s.name)
+//	fmt.Fprintf(h, "%d;", len(s.tags))
+//	for i1 := range s.tags {
+//		fmt.Fprintf(h, "%v;", s.tags[i1])
+//	}
+//	return h.Sum64()
+// }
+func GenerateHash(fset *token.FileSet, f *ast.File, structName string) bool {
+	g := &equalGen{f: f, done: make(map[string]bool)}
+	if !g.generate(structName, "hash", g.hashSource) {
+		return false
+	}
+	for _, path := range []string{"fmt", "hash/fnv"} {
+		if !hasImport(f, path) {
+			AddImport(fset, f, "", path)
+		}
+	}
+	return true
+}
+
+// equalGen 生成 Equal 及 Hash 方法，记录已生成的 struct
+type equalGen struct {
+	f    *ast.File
+	done map[string]bool
+	// pending 需要一并生成方法的 struct
+	pending []string
+	// deepEqual 为 true 时生成的代码使用了 reflect.DeepEqual
+	deepEqual bool
+}
+
+// generate 为 struct 及其依赖的 struct 生成方法，source 返回方法的源码
+func (g *equalGen) generate(structName, kind string, source func(name, recv string, fields []structField) string) bool {
+	g.pending = append(g.pending, structName)
+	for len(g.pending) > 0 {
+		name := g.pending[0]
+		g.pending = g.pending[1:]
+		if g.done[name] {
+			continue
+		}
+		g.done[name] = true
+		list, ok := findStructFields(g.f, name)
+		if !ok {
+			return false
+		}
+		fields := make([]structField, 0, len(list))
+		for _, field := range list {
+			if !isIgnoredField(field.tag) {
+				fields = append(fields, field)
+			}
+		}
+		recv := recvNameOf(typeMethodList([]*ast.File{g.f}, name), name)
+		if recv == "other" || recv == "h" {
+			recv = "v"
+		}
+		src := source(name, recv, fields)
+		index := getInsertIndex(g.f, &AstInsertPos{AfterMethods: true}, name, "")
+		if !applyGen(g.f, kind, name, []string{src}, index) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalSource 返回 Equal 方法的源码
+func (g *equalGen) equalSource(name, recv string, fields []structField) string {
+	var buf strings.Builder
+	buf.WriteString(genDoc("equal", name, fmt.Sprintf("Equal 判断 %s 与 other 是否相等", name)))
+	fmt.Fprintf(&buf, "func (%s *%s) Equal(other *%s) bool {\n", recv, name, name)
+	fmt.Fprintf(&buf, "if %s == other {\nreturn true\n}\nif %s == nil || other == nil {\nreturn false\n}\n", recv, recv)
+	for _, field := range fields {
+		g.equal(&buf, recv+"."+field.name, "other."+field.name, field.typ, 1)
+	}
+	buf.WriteString("return true\n}\n")
+	return buf.String()
+}
+
+// hashSource 返回 Hash 方法的源码
+func (g *equalGen) hashSource(name, recv string, fields []structField) string {
+	var buf strings.Builder
+	buf.WriteString(genDoc("hash", name, fmt.Sprintf("Hash 返回 %s 的哈希值", name)))
+	fmt.Fprintf(&buf, "func (%s *%s) Hash() uint64 {\nif %s == nil {\nreturn 0\n}\nh := fnv.New64a()\n", recv, name, recv)
+	for _, field := range fields {
+		g.hash(&buf, "h", recv+"."+field.name, field.typ, 1)
+	}
+	buf.WriteString("return h.Sum64()\n}\n")
+	return buf.String()
+}
+
+// isIgnoredField 判断成员是否带有 astutil:"-" 标签
+func isIgnoredField(tag string) bool {
+	if tag == "" {
+		return false
+	}
+	value, err := strconv.Unquote(tag)
+	if err != nil {
+		return false
+	}
+	return reflect.StructTag(value).Get("astutil") == "-"
+}
+
+// comparable 判断类型是否可以直接使用 == 比较，本文件的 struct 需要调用其 Equal 方法
+//  其他包的类型及类型参数等无法确定的类型视为不能比较。
+//  接口（包括 any、error）中的动态值可能是 slice、map 等不能比较的类型，== 会在运行时 panic，交给 reflect.DeepEqual
+func (g *equalGen) comparable(typ ast.Expr) bool {
+	switch t := typ.(type) {
+	case *ast.ParenExpr:
+		return g.comparable(t.X)
+	case *ast.Ident:
+		if spec := findLocalType(g.f, t); spec != nil {
+			if _, ok := spec.Type.(*ast.StructType); ok {
+				return false
+			}
+			return g.comparable(spec.Type)
+		}
+		obj, ok := types.Universe.Lookup(t.Name).(*types.TypeName)
+		return ok && !types.IsInterface(obj.Type()) && types.Comparable(obj.Type())
+	case *ast.ChanType:
+		return true
+	case *ast.ArrayType:
+		return t.Len != nil && g.comparable(t.Elt)
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if !g.comparable(field.Type) || isIgnoredField(fieldTag(field)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// equal 生成比较 a 与 b 的语句，不相等时返回 false。depth 用于生成不冲突的循环变量名称
+func (g *equalGen) equal(buf *strings.Builder, a, b string, typ ast.Expr, depth int) {
+	if g.comparable(typ) {
+		fmt.Fprintf(buf, "if %s != %s {\nreturn false\n}\n", a, b)
+		return
+	}
+	underlying := typ
+	if spec := findLocalType(g.f, typ); spec != nil {
+		if _, ok := spec.Type.(*ast.StructType); ok {
+			g.pending = append(g.pending, spec.Name.Name)
+			fmt.Fprintf(buf, "if !%s.Equal(&%s) {\nreturn false\n}\n", a, b)
+			return
+		}
+		underlying = spec.Type
+	}
+	i, k, v1, v2 := fmt.Sprintf("i%d", depth), fmt.Sprintf("k%d", depth), fmt.Sprintf("a%d", depth), fmt.Sprintf("b%d", depth)
+	switch t := underlying.(type) {
+	case *ast.ParenExpr:
+		g.equal(buf, a, b, t.X, depth)
+	case *ast.StarExpr:
+		if typ == underlying && isLocalStruct(g.f, t.X) {
+			g.pending = append(g.pending, t.X.(*ast.Ident).Name)
+			fmt.Fprintf(buf, "if !%s.Equal(%s) {\nreturn false\n}\n", a, b)
+			return
+		}
+		fmt.Fprintf(buf, "if (%s == nil) != (%s == nil) {\nreturn false\n}\nif %s != nil {\n", a, b, a)
+		g.equal(buf, "(*"+a+")", "(*"+b+")", t.X, depth+1)
+		buf.WriteString("}\n")
+	case *ast.ArrayType:
+		if t.Len == nil {
+			fmt.Fprintf(buf, "if len(%s) != len(%s) {\nreturn false\n}\n", a, b)
+		}
+		// 元素不参与比较时不生成循环，避免未使用的循环变量
+		var elem strings.Builder
+		g.equal(&elem, a+"["+i+"]", b+"["+i+"]", t.Elt, depth+1)
+		if elem.Len() > 0 {
+			fmt.Fprintf(buf, "for %s := range %s {\n%s}\n", i, a, elem.String())
+		}
+	case *ast.MapType:
+		fmt.Fprintf(buf, "if len(%s) != len(%s) {\nreturn false\n}\n", a, b)
+		var elem strings.Builder
+		g.equal(&elem, v1, v2, t.Value, depth+1)
+		if elem.Len() == 0 {
+			// 元素不参与比较时只比较 key
+			fmt.Fprintf(buf, "for %s := range %s {\nif _, ok := %s[%s]; !ok {\nreturn false\n}\n}\n", k, a, b, k)
+			return
+		}
+		fmt.Fprintf(buf, "for %s, %s := range %s {\n%s, ok := %s[%s]\nif !ok {\nreturn false\n}\n%s}\n", k, v1, a, v2, b, k, elem.String())
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if isIgnoredField(fieldTag(field)) {
+				continue
+			}
+			for _, name := range fieldNamesOf(field) {
+				g.equal(buf, a+"."+name, b+"."+name, field.Type, depth)
+			}
+		}
+	case *ast.FuncType:
+	default:
+		g.deepEqual = true
+		fmt.Fprintf(buf, "if !reflect.DeepEqual(%s, %s) {\nreturn false\n}\n", a, b)
+	}
+}
+
+// hash 生成将 v 写入 h 的语句。depth 用于生成不冲突的循环变量名称
+func (g *equalGen) hash(buf *strings.Builder, h, v string, typ ast.Expr, depth int) {
+	underlying := typ
+	if spec := findLocalType(g.f, typ); spec != nil {
+		if _, ok := spec.Type.(*ast.StructType); ok {
+			g.pending = append(g.pending, spec.Name.Name)
+			fmt.Fprintf(buf, "fmt.Fprintf(%s, \"%%d;\", %s.Hash())\n", h, v)
+			return
+		}
+		underlying = spec.Type
+	}
+	i, k, e, sum := fmt.Sprintf("i%d", depth), fmt.Sprintf("k%d", depth), fmt.Sprintf("v%d", depth), fmt.Sprintf("sum%d", depth)
+	switch t := underlying.(type) {
+	case *ast.ParenExpr:
+		g.hash(buf, h, v, t.X, depth)
+	case *ast.FuncType:
+	case *ast.StarExpr:
+		if typ == underlying && isLocalStruct(g.f, t.X) {
+			g.pending = append(g.pending, t.X.(*ast.Ident).Name)
+			fmt.Fprintf(buf, "fmt.Fprintf(%s, \"%%d;\", %s.Hash())\n", h, v)
+			return
+		}
+		fmt.Fprintf(buf, "if %s != nil {\n", v)
+		g.hash(buf, h, "(*"+v+")", t.X, depth+1)
+		buf.WriteString("}\n")
+	case *ast.ArrayType:
+		if t.Len == nil {
+			fmt.Fprintf(buf, "fmt.Fprintf(%s, \"%%d;\", len(%s))\n", h, v)
+		}
+		fmt.Fprintf(buf, "for %s := range %s {\n", i, v)
+		g.hash(buf, h, v+"["+i+"]", t.Elt, depth+1)
+		buf.WriteString("}\n")
+	case *ast.MapType:
+		// 每个元素单独计算后求和，与遍历顺序无关
+		eh := fmt.Sprintf("h%d", depth)
+		fmt.Fprintf(buf, "var %s uint64\nfor %s, %s := range %s {\n%s := fnv.New64a()\n", sum, k, e, v, eh)
+		g.hash(buf, eh, k, t.Key, depth+1)
+		g.hash(buf, eh, e, t.Value, depth+1)
+		fmt.Fprintf(buf, "%s += %s.Sum64()\n}\nfmt.Fprintf(%s, \"%%d;\", %s)\n", sum, eh, h, sum)
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if isIgnoredField(fieldTag(field)) {
+				continue
+			}
+			for _, name := range fieldNamesOf(field) {
+				g.hash(buf, h, v+"."+name, field.Type, depth)
+			}
+		}
+	default:
+		fmt.Fprintf(buf, "fmt.Fprintf(%s, \"%%v;\", %s)\n", h, v)
+	}
+}
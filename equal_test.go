@@ -0,0 +1,200 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateEqual(t *testing.T) {
+	fst, f := InitEnv("./test_demo/equal_demo.go")
+
+	ret := GenerateEqual(f, "Shape")
+	assert.True(t, ret)
+	ret = GenerateEqual(f, "NotFound")
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), `func (s *Shape) Equal(other *Shape) bool {
+	if s == other {
+		return true
+	}
+	if s == nil || other == nil {
+		return false
+	}
+	if s.Name != other.Name {
+		return false
+	}
+	if !s.Center.Equal(&other.Center) {
+		return false
+	}
+	if len(s.Points) != len(other.Points) {
+		return false
+	}
+	for i1 := range s.Points {
+		if !s.Points[i1].Equal(&other.Points[i1]) {
+			return false
+		}
+	}
+	if len(s.Attrs) != len(other.Attrs) {
+		return false
+	}
+	for k1, a1 := range s.Attrs {
+		b1, ok := other.Attrs[k1]
+		if !ok {
+			return false
+		}
+		if len(a1) != len(b1) {
+			return false
+		}
+		for i2 := range a1 {
+			if a1[i2] != b1[i2] {
+				return false
+			}
+		}
+	}
+	if !s.Parent.Equal(other.Parent) {
+		return false
+	}
+	if (s.Ratio == nil) != (other.Ratio == nil) {
+		return false
+	}
+	if s.Ratio != nil {
+		if (*s.Ratio) != (*other.Ratio) {
+			return false
+		}
+	}
+	if s.Grid != other.Grid {
+		return false
+	}
+	if s.Opt.On != other.Opt.On {
+		return false
+	}
+	return true
+}`)
+	// 依赖的 struct 一并生成
+	assert.Contains(t, string(src), "func (p *Point) Equal(other *Point) bool {\n")
+	assert.Contains(t, string(src), "\tif p.Y != other.Y {\n\t\treturn false\n\t}\n\tif (p.Label == nil) != (other.Label == nil) {\n")
+	assert.NotContains(t, string(src), "s.cache")
+	assert.NotContains(t, string(src), "Opt.Cache")
+	assert.NotContains(t, string(src), "OnDraw !=")
+	PrintResult(fst, f)
+}
+
+func TestGenerateHash(t *testing.T) {
+	fst, f := InitEnv("./test_demo/equal_demo.go")
+
+	ret := GenerateHash(fst, f, "Shape")
+	assert.True(t, ret)
+	ret = GenerateEqual(f, "Shape")
+	assert.True(t, ret)
+	// 再次生成时原位更新
+	ret = GenerateHash(fst, f, "Shape")
+	assert.True(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "import (\n\t\"fmt\"\n\t\"hash/fnv\"\n)\n")
+	assert.Contains(t, string(src), `func (s *Shape) Hash() uint64 {
+	if s == nil {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%v;", s.Name)
+	fmt.Fprintf(h, "%d;", s.Center.Hash())
+	fmt.Fprintf(h, "%d;", len(s.Points))
+	for i1 := range s.Points {
+		fmt.Fprintf(h, "%d;", s.Points[i1].Hash())
+	}
+	var sum1 uint64
+	for k1, v1 := range s.Attrs {
+		h1 := fnv.New64a()
+		fmt.Fprintf(h1, "%v;", k1)
+		fmt.Fprintf(h1, "%d;", len(v1))
+		for i2 := range v1 {
+			fmt.Fprintf(h1, "%v;", v1[i2])
+		}
+		sum1 += h1.Sum64()
+	}
+	fmt.Fprintf(h, "%d;", sum1)
+	fmt.Fprintf(h, "%d;", s.Parent.Hash())
+	if s.Ratio != nil {
+		fmt.Fprintf(h, "%v;", (*s.Ratio))
+	}
+	for i1 := range s.Grid {
+		fmt.Fprintf(h, "%v;", s.Grid[i1])
+	}
+	fmt.Fprintf(h, "%v;", s.Opt.On)
+	return h.Sum64()
+}`)
+	assert.Contains(t, string(src), "func (p *Point) Hash() uint64 {\n")
+	assert.Contains(t, string(src), "}\n\n// Equal 判断 Shape 与 other 是否相等\n")
+	PrintResult(fst, f)
+}
+
+func TestGenerateEqualDeep(t *testing.T) {
+	fst, f := InitEnv("./test_demo/equal_event_demo.go")
+
+	ret := GenerateEqual(f, "Event")
+	assert.True(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	// 元素不参与比较的 map 只比较 key，slice 只比较长度
+	assert.Contains(t, string(src), `	for k1 := range e.Handlers {
+		if _, ok := other.Handlers[k1]; !ok {
+			return false
+		}
+	}
+	if len(e.Hooks) != len(other.Hooks) {
+		return false
+	}
+	if !reflect.DeepEqual(e.At, other.At) {
+		return false
+	}
+	if !reflect.DeepEqual(e.Extra, other.Extra) {
+		return false
+	}
+	if !reflect.DeepEqual(e.Payload, other.Payload) {
+		return false
+	}
+	return true
+}`)
+	assert.Contains(t, string(src), "import (\n\t\"reflect\"\n\t\"time\"\n)\n")
+	PrintResult(fst, f)
+}
+
+func TestGenerateEqualInterfaceRun(t *testing.T) {
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	fst, f := InitEnv("./test_demo/equal_event_demo.go")
+	assert.True(t, GenerateEqual(f, "Event"))
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+
+	// 接口中保存 slice 时 == 会 panic，生成的 Equal 需要正常返回
+	main := strings.Replace(string(src), "package test_demo", "package main", 1) + `
+func main() {
+	a, b := &Event{Payload: []int{1}}, &Event{Payload: []int{1}}
+	c := &Event{Payload: []int{2}}
+	println(a.Equal(b), a.Equal(c))
+}
+`
+	dir, err := ioutil.TempDir("", "equal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "main.go")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(main), 0644))
+	cmd := exec.Command(gobin, "run", file)
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GO111MODULE=off")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+	assert.Equal(t, "true false\n", string(out))
+}
@@ -1,8 +1,11 @@
 package ozastutil
 
 import (
+	"fmt"
 	"go/ast"
+	"go/parser"
 	"go/token"
+	"reflect"
 	"strings"
 )
 
@@ -21,11 +24,32 @@ type AstFunc struct {
 	Name    string
 	Params  []AstKv
 	Results []AstKv
-	Return  []string
-	Recv    *AstKv
+	// Return 为 return 语句返回的表达式，为 nil 时不生成 return 语句，为空切片时生成不带返回值的 return
+	Return []string
+	Recv   *AstKv
+	// Doc 为函数的文档注释，每个元素为一行，可以省略开头的 "//"
+	Doc []string
+	// Body 为函数体的源码，位于 return 语句之前
+	Body string
 }
 
-// AddFunc 新增一个函数，目前只支持如下格式：
+// AstInsertPos 新声明在文件中的插入位置，各字段均为空时追加到文件末尾
+type AstInsertPos struct {
+	// After 插入到该声明之后，可以是函数名称（格式见 findFunc）或者类型、变量、常量名称
+	After string
+	// Before 插入到该声明之前，格式同 After
+	Before string
+	// AfterMethods 插入到接收者类型的最后一个方法之后，没有方法时插入到类型声明之后
+	AfterMethods bool
+	// Sorted 在接收者类型的方法中按名称顺序插入
+	Sorted bool
+	// Marker 插入到文件级别的标记注释之前，如 // astutil:handlers，标记保留在原处
+	Marker string
+	// Replace 文件中已存在同名的声明时原位替换，为 false 时返回错误，用于 RenderDecls
+	Replace bool
+}
+
+// AddFunc 新增一个函数，函数体源码不合法时返回 false
 //
 // 参数：
 // &AstFunc{
@@ -56,14 +80,206 @@ type AstFunc struct {
 // func (s *Stu) test2(p1 string, p2 *AstKv) (ret string) {
 //	return ret
 // }
+//
+// 支持文档注释、函数体源码、可变参数、匿名返回值及多个返回值：
+//
+// &AstFunc{
+//		Name: "test3",
+//		Doc: []string{"test3 返回 p2 的个数"},
+//		Params: []AstKv{
+//			{Key: "p1", Value: "string"},
+//			{Key: "p2", Value: "...int"},
+//		},
+//		Results: []AstKv{{Value: "int"}, {Value: "error"}},
+//		Body: `if p1 == "" {
+//	return 0, errors.New("empty")
+// }`,
+//		Return: []string{"len(p2)", "nil"},
+//	}
+//
+// 结果为：
+//
+// // test3 返回 p2 的个数
+// func test3(p1 string, p2 ...int) (int, error) {
+//	if p1 == "" {
+//		return 0, errors.New("empty")
+//	}
+//	return len(p2), nil
+// }
 func AddFunc(f *ast.File, params *AstFunc) bool {
 	if params.Name == "" {
 		return false
 	}
-	f.Decls = append(f.Decls, getFuncDecl(params))
+	fd, err := getFuncDecl(params)
+	if err != nil {
+		return false
+	}
+	if skipApplied(f, hasSameFunc(f, fd)) {
+		return true
+	}
+	f.Decls = append(f.Decls, fd)
+	return true
+}
+
+// AddFuncAt 在指定位置新增一个函数，pos 为 nil 时同 AddFunc
+//
+// 插入到指定声明之后：AddFuncAt(f, params, &AstInsertPos{After: "Func1"})
+//
+// 插入到指定声明之前：AddFuncAt(f, params, &AstInsertPos{Before: "(*Stu).TT"})
+//
+// 插入到 Stu 的最后一个方法之后：AddFuncAt(f, params, &AstInsertPos{AfterMethods: true})
+//
+// 在 Stu 的方法中按名称顺序插入：AddFuncAt(f, params, &AstInsertPos{Sorted: true})
+//
+// 后两种方式需要设置 params.Recv，找不到指定的声明时返回 false
+func AddFuncAt(f *ast.File, params *AstFunc, pos *AstInsertPos) bool {
+	if params.Name == "" {
+		return false
+	}
+	recv := ""
+	if params.Recv != nil {
+		if expr, err := parser.ParseExpr(params.Recv.Value); err == nil {
+			recv = typeName(expr)
+		}
+	}
+	fd, err := getFuncDecl(params)
+	if err != nil {
+		return false
+	}
+	if skipApplied(f, hasSameFunc(f, fd)) {
+		return true
+	}
+	if pos != nil && pos.Marker != "" {
+		return insertDeclAtMarker(f, pos.Marker, fd)
+	}
+	index := getInsertIndex(f, pos, recv, params.Name)
+	if index == -1 {
+		return false
+	}
+	insertDecls(f, index-1, fd)
+	return true
+}
+
+// DeleteFunc 删除函数或方法，函数的文档注释及函数内的注释一并删除
+//
+// 参数 name 支持的格式见 findFunc，例如：
+//
+// DeleteFunc(f, "Func1")
+//
+// DeleteFunc(f, "(*Stu).PStuFunc")
+func DeleteFunc(f *ast.File, name string) bool {
+	index, fd := findFunc(f, name)
+	if fd == nil {
+		// 幂等模式下函数已经不存在视为已删除
+		return skipApplied(f, true)
+	}
+	skipApplied(f, false)
+	removeComments(f, fd)
+	releaseDecl(fd)
+	f.Decls = append(f.Decls[:index], f.Decls[index+1:]...)
+	return true
+}
+
+// RenameFunc 重命名函数或方法，并更新本文件中的调用
+//
+// 普通函数：替换文件中所有引用该函数的标识符，被局部的同名变量遮蔽的标识符不替换，
+// 引用处已经声明了名为 newName 的局部变量时返回 false
+//
+// 方法：替换 x.Name、Stu.Name、(*Stu).Name 形式的引用，其中 x 的类型需要能在本文件中推断出来，
+// 即接收者、参数、var x Stu、x := &Stu{} 等形式
+//
+// 测试数据：
+//
+// func (s *Stu) TT(gin *gin.Context) {
+//	s.PStuFunc("")
+// }
+//
+// 执行：RenameFunc(f, "(*Stu).PStuFunc", "Hello")
+//
+// 结果为：
+//
+// func (s *Stu) TT(gin *gin.Context) {
+//	s.Hello("")
+// }
+//
+// func (s *Stu) Hello(a string) (ret string) {...}
+func RenameFunc(f *ast.File, name, newName string) bool {
+	if !token.IsIdentifier(newName) {
+		return false
+	}
+	_, fd := findFunc(f, name)
+	if fd == nil {
+		// 幂等模式下原函数不存在且新函数存在视为已重命名
+		_, renamed := findFunc(f, name[:strings.LastIndex(name, ".")+1]+newName)
+		return renamed != nil && skipApplied(f, true)
+	}
+	if fd.Name.Name == newName {
+		return false
+	}
+	recv, _ := funcRecv(fd)
+	if recv == "" {
+		// 新名称不能与文件中已有的声明或引用处的局部名称冲突
+		if isDeclExist(f, newName) || isShadowedAtRefs(f, fd.Name.Name, newName) {
+			return false
+		}
+	} else if _, exist := findFunc(f, recv+"."+newName); exist != nil {
+		return false
+	}
+	for _, ref := range findFuncRefs(f, recv, fd.Name.Name) {
+		ref.name.Name = newName
+	}
+	fd.Name.Name = newName
+	return true
+}
+
+// ReplaceFunc 使用源码替换整个函数或方法，新函数保持在原函数的位置
+//
+// 源码中没有文档注释时保留原函数的文档注释，例如：
+//
+// ReplaceFunc(f, "Stu.TT", `func (s *Stu) TT(c *gin.Context) {
+//	c.JSON(200, nil)
+// }`)
+func ReplaceFunc(f *ast.File, name, src string) bool {
+	index, fd := findFunc(f, name)
+	if fd == nil {
+		return false
+	}
+	decls, err := parseDecls(src)
+	if err != nil || len(decls) != 1 {
+		return false
+	}
+	newFd, ok := decls[0].(*ast.FuncDecl)
+	if !ok {
+		return false
+	}
+	if skipApplied(f, funcString(fd) == funcString(newFd) && (newFd.Doc == nil || sameNode(fd.Doc, newFd.Doc))) {
+		return true
+	}
+	if newFd.Doc == nil && fd.Doc != nil {
+		// 原文档注释作为游离注释保留在文件中，输出在新函数之前
+		doc := fd.Doc
+		fd.Doc = nil
+		removeComments(f, fd)
+		fd.Doc = doc
+	} else {
+		removeComments(f, fd)
+	}
+	replaceDecl(f, index, newFd)
 	return true
 }
 
+// replaceDecl 用新声明替换下标 index 处的声明，新声明输出在原声明的位置
+func replaceDecl(f *ast.File, index int, decl ast.Decl) {
+	old := f.Decls[index]
+	if !isNewDecl(old) {
+		setDeclHint(decl, old.Pos())
+	} else {
+		setDeclHint(decl, declHint(old))
+	}
+	releaseDecl(old)
+	f.Decls[index] = decl
+}
+
 // AddParamToFunc 给函数添加参数
 //
 // 测试数据：func t () {}
@@ -72,29 +288,7 @@ func AddFunc(f *ast.File, params *AstFunc) bool {
 //
 // 结果为：func t(demo demo.IDemo,) {}
 func AddParamToFunc(f *ast.File, funcName, paramName, paramType string) bool {
-	if funcName == "" || paramName == "" || paramType == "" {
-		return false
-	}
-	for _, decl := range f.Decls {
-		switch fd := decl.(type) {
-		case *ast.FuncDecl:
-			if fd.Name.Name != funcName {
-				continue
-			}
-			if fd.Type.Params.List == nil {
-				fd.Type.Params.List = make([]*ast.Field, 0)
-			}
-			// 判断变量名称是否存在
-			for _, field := range fd.Type.Params.List {
-				if field.Names[0].Name == paramName {
-					return false
-				}
-			}
-			fd.Type.Params.List = append(fd.Type.Params.List, getField(paramName, paramType))
-			return true
-		}
-	}
-	return false
+	return InsertParamToFunc(f, funcName, -1, paramName, paramType)
 }
 
 // AddKVToFuncUnaryStruct 为函数的struct指针变量添加key value数据。目前没有做变量重复判断
@@ -120,46 +314,44 @@ func AddParamToFunc(f *ast.File, funcName, paramName, paramType string) bool {
 //	stu := &Stu{key: value}
 //	fmt.Println(te, stu)
 // }
-func AddKVToFuncUnaryStruct(f *ast.File, funcName, varName, key, value string) bool {
+//
+// 可选参数 marker 为 struct 字面量内的标记注释时，插入到标记之前
+func AddKVToFuncUnaryStruct(f *ast.File, funcName, varName, key, value string, marker ...string) bool {
 	if funcName == "" || varName == "" || key == "" || value == "" {
 		return false
 	}
-	for _, decl := range f.Decls {
-		switch fd := decl.(type) {
-		case *ast.FuncDecl:
-			if fd.Name.Name != funcName {
+	_, fd := findFunc(f, funcName)
+	if fd == nil {
+		return false
+	}
+	if fd.Body.List == nil {
+		return false
+	}
+	for _, stmt := range fd.Body.List {
+		switch s := stmt.(type) {
+		case *ast.DeclStmt:
+			// 处理 var te = &Stu{} 结构
+			switch g := s.Decl.(type) {
+			case *ast.GenDecl:
+				vs := g.Specs[0].(*ast.ValueSpec)
+				if vs.Names[0].Name != varName {
+					continue
+				}
+				switch vs.Values[0].(type) {
+				case *ast.UnaryExpr:
+					vsVal := vs.Values[0].(*ast.UnaryExpr)
+					return addKVToUnaryExpr(f, vsVal, key, value, getMarker(marker))
+				}
+			}
+		case *ast.AssignStmt:
+			// 处理 stu := &Stu{}
+			if s.Lhs[0].(*ast.Ident).Name != varName {
 				continue
 			}
-			if fd.Body.List == nil {
-				return false
-			}
-			for _, stmt := range fd.Body.List {
-				switch s := stmt.(type) {
-				case *ast.DeclStmt:
-					// 处理 var te = &Stu{} 结构
-					switch g := s.Decl.(type) {
-					case *ast.GenDecl:
-						vs := g.Specs[0].(*ast.ValueSpec)
-						if vs.Names[0].Name != varName {
-							continue
-						}
-						switch vs.Values[0].(type) {
-						case *ast.UnaryExpr:
-							vsVal := vs.Values[0].(*ast.UnaryExpr)
-							return addKVToUnaryExpr(vsVal, key, value)
-						}
-					}
-				case *ast.AssignStmt:
-					// 处理 stu := &Stu{}
-					if s.Lhs[0].(*ast.Ident).Name != varName {
-						continue
-					}
-					switch s.Rhs[0].(type) {
-					case *ast.UnaryExpr:
-						vsVal := s.Rhs[0].(*ast.UnaryExpr)
-						return addKVToUnaryExpr(vsVal, key, value)
-					}
-				}
+			switch s.Rhs[0].(type) {
+			case *ast.UnaryExpr:
+				vsVal := s.Rhs[0].(*ast.UnaryExpr)
+				return addKVToUnaryExpr(f, vsVal, key, value, getMarker(marker))
 			}
 		}
 	}
@@ -173,84 +365,80 @@ func AddKVToFuncUnaryStruct(f *ast.File, funcName, varName, key, value string) b
 //
 // var xx = "xxx"
 //
-// xx := ccc 有问题，暂不修复
+// xx := ccc
 //
-// 不支持复杂的定义
+// 不支持复杂的定义。afterVar 为标记注释（如 // astutil:vars）时插入到标记之前
 func AddVarToFunc(f *ast.File, funcName, varName, value, afterVar, tag string) bool {
 	if funcName == "" || varName == "" || value == "" {
 		return false
 	}
-	for _, decl := range f.Decls {
-		switch fd := decl.(type) {
-		case *ast.FuncDecl:
-			if fd.Name.Name != funcName {
-				continue
-			}
-			if fd.Body.List == nil {
-				fd.Body.List = make([]ast.Stmt, 0)
-			}
-			afterIndex := -1
-			afterLine := token.NoPos
-			if afterVar != "" && len(fd.Body.List) > 0 {
-				for k, stmt := range fd.Body.List {
-					switch s := stmt.(type) {
-					// 处理 var te = &Stu{} 结构
-					case *ast.DeclStmt:
-						switch g := s.Decl.(type) {
-						case *ast.GenDecl:
-							if g.Specs[0].(*ast.ValueSpec).Names[0].Name == afterVar {
-								afterIndex = k
-								afterLine = g.Specs[0].(*ast.ValueSpec).Names[0].NamePos
-								break
-							}
-						}
-					// 处理 stu := &Stu{}
-					case *ast.AssignStmt:
-						switch v := s.Lhs[0].(type) {
-						case *ast.Ident:
-							if v.Name == afterVar {
-								afterIndex = k
-								afterLine = v.NamePos
-								break
-							}
-						case *ast.SelectorExpr:
-							if v.X.(*ast.Ident).Name == afterVar {
-								afterIndex = k
-								afterLine = v.X.(*ast.Ident).NamePos
-								break
-							}
-						}
+	_, fd := findFunc(f, funcName)
+	if fd == nil {
+		return false
+	}
+	if fd.Body.List == nil {
+		fd.Body.List = make([]ast.Stmt, 0)
+	}
+	afterIndex := -1
+	if afterVar != "" && len(fd.Body.List) > 0 {
+		for k, stmt := range fd.Body.List {
+			switch s := stmt.(type) {
+			// 处理 var te = &Stu{} 结构
+			case *ast.DeclStmt:
+				switch g := s.Decl.(type) {
+				case *ast.GenDecl:
+					if g.Specs[0].(*ast.ValueSpec).Names[0].Name == afterVar {
+						afterIndex = k
+						break
 					}
 				}
-			}
-			if afterVar == "" && len(fd.Body.List) > 0 {
-				switch fd.Body.List[len(fd.Body.List) - 1].(type) {
-				case *ast.ReturnStmt:
-					afterIndex = len(fd.Body.List) - 2
+			// 处理 stu := &Stu{}
+			case *ast.AssignStmt:
+				switch v := s.Lhs[0].(type) {
+				case *ast.Ident:
+					if v.Name == afterVar {
+						afterIndex = k
+						break
+					}
+				case *ast.SelectorExpr:
+					if v.X.(*ast.Ident).Name == afterVar {
+						afterIndex = k
+						break
+					}
 				}
 			}
-			// 生产数据
-			var newVar ast.Stmt
-			switch tag {
-			case "var":
-				newVar = &ast.DeclStmt{Decl: getVar(varName, value)}
-			case "define":
-				newVar = &ast.DeclStmt{Decl: getDefineVar(varName, value)}
-			case "assign":
-				newVar = getAssignVar(varName, value, afterLine)
-			}
-			if afterIndex == -1 {
-				fd.Body.List = append(fd.Body.List, newVar)
-			} else {
-				insertAt := afterIndex + 1
-				fd.Body.List = append(fd.Body.List, nil)
-				copy(fd.Body.List[insertAt+1:], fd.Body.List[insertAt:])
-				fd.Body.List[insertAt] = newVar
-			}
-			return true
 		}
 	}
-	return false
+	if afterVar == "" && len(fd.Body.List) > 0 {
+		switch fd.Body.List[len(fd.Body.List) - 1].(type) {
+		case *ast.ReturnStmt:
+			afterIndex = len(fd.Body.List) - 2
+		}
+	}
+	// 生产数据
+	var newVar ast.Stmt
+	switch tag {
+	case "var":
+		newVar = &ast.DeclStmt{Decl: getVar(varName, value)}
+	case "define":
+		newVar = &ast.DeclStmt{Decl: getDefineVar(varName, value)}
+	case "assign":
+		newVar = getAssignVar(varName, value)
+	}
+	if newVar == nil {
+		return false
+	}
+	if skipApplied(f, hasStmt(fd.Body, newVar)) {
+		return true
+	}
+	if isMarker(afterVar) {
+		return insertStmtAtMarker(f, fd.Body, afterVar, newVar)
+	}
+	index := len(fd.Body.List)
+	if afterIndex != -1 {
+		index = afterIndex + 1
+	}
+	return insertNode(f, fd.Body, index, stmtSource(newVar))
 }
 
 // AddCallBlockToFunc 添加一个如下所示的代码块到函数中
@@ -259,83 +447,82 @@ func AddVarToFunc(f *ast.File, funcName, varName, value, afterVar, tag string) b
 //		rdemo.POST("", demo.Create)
 //		rdemo.POST("/", demo.Create)
 //	}
+//
+// afterVar 为标记注释（如 // astutil:routes）时插入到标记之前
 func AddCallBlockToFunc(f *ast.File, funcName string, data []AstCallExpr, afterVar string) bool {
 	if funcName == "" || len(data) == 0 {
 		return false
 	}
-	for _, decl := range f.Decls {
-		switch fd := decl.(type) {
-		case *ast.FuncDecl:
-			if fd.Name.Name != funcName {
-				continue
-			}
-			if fd.Body.List == nil {
-				fd.Body.List = make([]ast.Stmt, 0)
-			}
-			afterIndex := -1
-			if afterVar != "" && len(fd.Body.List) > 0 {
-				for k, stmt := range fd.Body.List {
-					switch s := stmt.(type) {
-					// 处理 var te = &Stu{} 结构
-					case *ast.DeclStmt:
-						switch g := s.Decl.(type) {
-						case *ast.GenDecl:
-							if g.Specs[0].(*ast.ValueSpec).Names[0].Name == afterVar {
-								afterIndex = k
-								break
-							}
-						}
-					// 处理 stu := &Stu{}
-					case *ast.AssignStmt:
-						switch v := s.Lhs[0].(type) {
-						case *ast.Ident:
-							if v.Name == afterVar {
-								afterIndex = k
-								break
-							}
-						case *ast.SelectorExpr:
-							if v.X.(*ast.Ident).Name == afterVar {
-								afterIndex = k
-								break
-							}
-						}
+	_, fd := findFunc(f, funcName)
+	if fd == nil {
+		return false
+	}
+	if fd.Body.List == nil {
+		fd.Body.List = make([]ast.Stmt, 0)
+	}
+	afterIndex := -1
+	if afterVar != "" && len(fd.Body.List) > 0 {
+		for k, stmt := range fd.Body.List {
+			switch s := stmt.(type) {
+			// 处理 var te = &Stu{} 结构
+			case *ast.DeclStmt:
+				switch g := s.Decl.(type) {
+				case *ast.GenDecl:
+					if g.Specs[0].(*ast.ValueSpec).Names[0].Name == afterVar {
+						afterIndex = k
+						break
 					}
 				}
-			}
-			// 生产数据
-			newVar := &ast.BlockStmt{
-				List: make([]ast.Stmt, 0),
-			}
-			for _, datum := range data {
-				args := make([]ast.Expr, 0)
-				if len(datum.Args) > 0 {
-					for _, arg := range datum.Args {
-						args = append(args, &ast.BasicLit{Value: arg})
+			// 处理 stu := &Stu{}
+			case *ast.AssignStmt:
+				switch v := s.Lhs[0].(type) {
+				case *ast.Ident:
+					if v.Name == afterVar {
+						afterIndex = k
+						break
+					}
+				case *ast.SelectorExpr:
+					if v.X.(*ast.Ident).Name == afterVar {
+						afterIndex = k
+						break
 					}
 				}
-				d := &ast.ExprStmt{
-					X: &ast.CallExpr{
-						Fun: &ast.SelectorExpr{
-							X:   &ast.Ident{Name: datum.FunName},
-							Sel: &ast.Ident{Name: datum.FunSel},
-						},
-						Args: args,
-					},
-				}
-				newVar.List = append(newVar.List, d)
 			}
-			if afterIndex == -1 {
-				fd.Body.List = append(fd.Body.List, newVar)
-			} else {
-				insertAt := afterIndex + 1
-				fd.Body.List = append(fd.Body.List, nil)
-				copy(fd.Body.List[insertAt+1:], fd.Body.List[insertAt:])
-				fd.Body.List[insertAt] = newVar
+		}
+	}
+	// 生产数据
+	newVar := &ast.BlockStmt{
+		List: make([]ast.Stmt, 0),
+	}
+	for _, datum := range data {
+		args := make([]ast.Expr, 0)
+		if len(datum.Args) > 0 {
+			for _, arg := range datum.Args {
+				args = append(args, &ast.BasicLit{Value: arg})
 			}
-			return true
 		}
+		d := &ast.ExprStmt{
+			X: &ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X:   &ast.Ident{Name: datum.FunName},
+					Sel: &ast.Ident{Name: datum.FunSel},
+				},
+				Args: args,
+			},
+		}
+		newVar.List = append(newVar.List, d)
 	}
-	return false
+	if skipApplied(f, hasStmt(fd.Body, newVar)) {
+		return true
+	}
+	if isMarker(afterVar) {
+		return insertStmtAtMarker(f, fd.Body, afterVar, newVar)
+	}
+	index := len(fd.Body.List)
+	if afterIndex != -1 {
+		index = afterIndex + 1
+	}
+	return insertNode(f, fd.Body, index, stmtSource(newVar))
 }
 
 // GetLastVarFormFunc 获取函数中最后一个变量名称
@@ -343,125 +530,660 @@ func GetLastVarFormFunc(f *ast.File, funcName string) string {
 	if funcName == "" {
 		return ""
 	}
+	_, fd := findFunc(f, funcName)
+	if fd == nil || fd.Body.List == nil {
+		return ""
+	}
 	retName := ""
-	for _, decl := range f.Decls {
-		switch fd := decl.(type) {
-		case *ast.FuncDecl:
-			if fd.Name.Name != funcName {
+	for _, stmt := range fd.Body.List {
+		switch s := stmt.(type) {
+		// 处理 var te = &Stu{} 结构
+		case *ast.DeclStmt:
+			switch g := s.Decl.(type) {
+			case *ast.GenDecl:
+				retName = g.Specs[0].(*ast.ValueSpec).Names[0].Name
+			}
+		// 处理 stu := &Stu{}
+		case *ast.AssignStmt:
+			switch v := s.Lhs[0].(type) {
+			case *ast.Ident:
+				retName = v.Name
+			case *ast.SelectorExpr:
+				retName = v.X.(*ast.Ident).Name
+			}
+		}
+	}
+	return retName
+}
+
+// findFunc 查找函数声明，返回其在 f.Decls 中的下标，没有找到时返回 -1, nil
+//
+// name 支持以下格式：
+//
+// Func1：普通函数，不匹配同名的方法
+//
+// Stu.TT：Stu 或 *Stu 的方法
+//
+// (Stu).StuFunc：值接收者的方法
+//
+// (*Stu).PStuFunc：指针接收者的方法
+func findFunc(f *ast.File, name string) (int, *ast.FuncDecl) {
+	recv, star, funcName := parseFuncName(name)
+	if funcName == "" {
+		return -1, nil
+	}
+	for i, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Name.Name != funcName {
+			continue
+		}
+		fdRecv, fdStar := funcRecv(fd)
+		if fdRecv == recv && (recv == "" || star == "" || star == fdStar) {
+			return i, fd
+		}
+	}
+	return -1, nil
+}
+
+// getInsertIndex 计算新声明在 f.Decls 中的插入下标，找不到参考声明时返回 -1
+//  recv 及 name 为新函数的接收者类型及名称，用于 AfterMethods 及 Sorted
+func getInsertIndex(f *ast.File, pos *AstInsertPos, recv, name string) int {
+	switch {
+	case pos == nil:
+		return len(f.Decls)
+	case pos.After != "":
+		if index := findDecl(f, pos.After); index != -1 {
+			return index + 1
+		}
+		return -1
+	case pos.Before != "":
+		return findDecl(f, pos.Before)
+	case recv == "" && (pos.AfterMethods || pos.Sorted):
+		return -1
+	case pos.AfterMethods || pos.Sorted:
+		index := findDecl(f, recv)
+		if index != -1 {
+			index++
+		}
+		for i, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok {
 				continue
 			}
-			if fd.Body.List == nil {
-				return ""
+			if fdRecv, _ := funcRecv(fd); fdRecv != recv {
+				continue
 			}
-			for _, stmt := range fd.Body.List {
-				switch s := stmt.(type) {
-				// 处理 var te = &Stu{} 结构
-				case *ast.DeclStmt:
-					switch g := s.Decl.(type) {
-					case *ast.GenDecl:
-						retName = g.Specs[0].(*ast.ValueSpec).Names[0].Name
-					}
-				// 处理 stu := &Stu{}
-				case *ast.AssignStmt:
-					switch v := s.Lhs[0].(type) {
-					case *ast.Ident:
-						retName = v.Name
-					case *ast.SelectorExpr:
-						retName = v.X.(*ast.Ident).Name
+			if pos.Sorted && fd.Name.Name > name {
+				return i
+			}
+			index = i + 1
+		}
+		if index == -1 {
+			return len(f.Decls)
+		}
+		return index
+	}
+	return len(f.Decls)
+}
+
+// findDecl 查找函数、类型、变量或常量声明，返回其在 f.Decls 中的下标，没有找到时返回 -1
+func findDecl(f *ast.File, name string) int {
+	if index, fd := findFunc(f, name); fd != nil {
+		return index
+	}
+	for i, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				if s.Name.Name == name {
+					return i
+				}
+			case *ast.ValueSpec:
+				for _, id := range s.Names {
+					if id.Name == name {
+						return i
 					}
 				}
 			}
 		}
 	}
-	return retName
+	return -1
 }
 
-func addKVToUnaryExpr(ue *ast.UnaryExpr, key, value string) bool {
-	switch cpl := ue.X.(type) {
+// parseFuncName 解析 findFunc 的函数名称参数
+//  star 为 "*" 表示指针接收者，"-" 表示值接收者，为空表示不限
+func parseFuncName(name string) (recv, star, funcName string) {
+	name = strings.TrimSpace(name)
+	i := strings.LastIndex(name, ".")
+	if i == -1 {
+		return "", "", name
+	}
+	recv, funcName = name[:i], name[i+1:]
+	if strings.HasPrefix(recv, "(") && strings.HasSuffix(recv, ")") {
+		recv = strings.TrimSpace(recv[1 : len(recv)-1])
+		star = "-"
+		if strings.HasPrefix(recv, "*") {
+			recv, star = strings.TrimSpace(recv[1:]), "*"
+		}
+	}
+	return
+}
+
+// funcRecv 返回方法的接收者类型名称，指针接收者的 star 为 "*"，值接收者为 "-"，普通函数返回空
+func funcRecv(fd *ast.FuncDecl) (recv, star string) {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return "", ""
+	}
+	typ := fd.Recv.List[0].Type
+	star = "-"
+	if p, ok := typ.(*ast.ParenExpr); ok {
+		typ = p.X
+	}
+	if s, ok := typ.(*ast.StarExpr); ok {
+		typ, star = s.X, "*"
+	}
+	return typeName(typ), star
+}
+
+// typeName 返回类型表达式对应的本包类型名称，如 Stu、*Stu、Stu[T] 均返回 Stu，其他包的类型返回空
+func typeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return typeName(t.X)
+	case *ast.ParenExpr:
+		return typeName(t.X)
+	case *ast.IndexExpr:
+		return typeName(t.X)
+	case *ast.IndexListExpr:
+		return typeName(t.X)
+	}
+	return ""
+}
+
+// valueTypeName 推断 Stu{}、&Stu{}、new(Stu) 形式的值的类型名称
+func valueTypeName(expr ast.Expr) string {
+	switch v := expr.(type) {
 	case *ast.CompositeLit:
-		if cpl.Elts == nil {
-			cpl.Elts = []ast.Expr{}
+		return typeName(v.Type)
+	case *ast.UnaryExpr:
+		if v.Op == token.AND {
+			return valueTypeName(v.X)
+		}
+	case *ast.ParenExpr:
+		return valueTypeName(v.X)
+	case *ast.CallExpr:
+		if id, ok := v.Fun.(*ast.Ident); ok && id.Name == "new" && len(v.Args) == 1 {
+			return typeName(v.Args[0])
 		}
-		// 判断参数是否存在 -- 不完善，暂时屏蔽
-		//for _, elt := range cpl.Elts {
-		//	if elt.(*ast.KeyValueExpr).Key.(*ast.Ident).Name == key {
-		//		return false
-		//	}
-		//}
-		cpl.Elts = append(cpl.Elts, getKVExpr(key, value))
-		return true
 	}
-	return false
+	return ""
 }
 
-func getFuncDecl(params *AstFunc) *ast.FuncDecl {
-	newFunc := &ast.FuncDecl{Name: ast.NewIdent(params.Name)}
-	if params.Params != nil {
-		if newFunc.Type == nil {
-			newFunc.Type = &ast.FuncType{
-				Params: &ast.FieldList{
-					List: make([]*ast.Field, 0),
-				},
+// isDeclExist 判断文件中是否存在同名的函数、类型、变量或常量
+func isDeclExist(f *ast.File, name string) bool {
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.Name == name {
+				return true
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.Name == name {
+						return true
+					}
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						if n.Name == name {
+							return true
+						}
+					}
+				}
 			}
 		}
-		for _, param := range params.Params {
-			newFunc.Type.Params.List = append(newFunc.Type.Params.List, getField(param.Key, param.Value))
+	}
+	return false
+}
+
+// scopeWalker 按作用域遍历语法树，记录每层作用域中声明的名称
+//  只有在某处引用的名称没有被局部声明遮蔽时，该引用才指向外层（包级或参数）的同名声明
+type scopeWalker struct {
+	scopes []map[string]bool
+	visit  func(id *ast.Ident, local func(name string) bool)
+}
+
+// walkScopes 遍历节点中作为引用出现的标识符（不包括声明的名称、选择器及字段名称），
+// local 判断名称在该处是否为节点内的局部声明
+func walkScopes(node ast.Node, visit func(id *ast.Ident, local func(name string) bool)) {
+	w := &scopeWalker{visit: visit}
+	w.walk(node)
+}
+
+func (w *scopeWalker) local(name string) bool {
+	for _, scope := range w.scopes {
+		if scope[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *scopeWalker) push() {
+	w.scopes = append(w.scopes, make(map[string]bool))
+}
+
+func (w *scopeWalker) pop() {
+	w.scopes = w.scopes[:len(w.scopes)-1]
+}
+
+// declare 在当前作用域中声明名称，包级声明不记录
+func (w *scopeWalker) declare(exprs ...ast.Expr) {
+	if len(w.scopes) == 0 {
+		return
+	}
+	for _, e := range exprs {
+		if id, ok := e.(*ast.Ident); ok && id.Name != "_" {
+			w.scopes[len(w.scopes)-1][id.Name] = true
+		}
+	}
+}
+
+// fields 遍历参数列表的类型并声明参数名称
+func (w *scopeWalker) fields(list *ast.FieldList) {
+	if list == nil {
+		return
+	}
+	for _, field := range list.List {
+		w.walk(field.Type)
+		for _, id := range field.Names {
+			w.declare(id)
 		}
 	}
+}
 
-	if params.Results != nil {
-		if newFunc.Type == nil {
-			newFunc.Type = &ast.FuncType{
-				Results: &ast.FieldList{
-					List: make([]*ast.Field, 0),
-				},
+func (w *scopeWalker) walk(node ast.Node) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.FuncDecl:
+			w.push()
+			w.fields(x.Recv)
+			w.fields(x.Type.Params)
+			w.fields(x.Type.Results)
+			w.walk(x.Body)
+			w.pop()
+			return false
+		case *ast.FuncLit:
+			w.push()
+			w.fields(x.Type.Params)
+			w.fields(x.Type.Results)
+			w.walk(x.Body)
+			w.pop()
+			return false
+		case *ast.BlockStmt:
+			w.push()
+			for _, stmt := range x.List {
+				w.walk(stmt)
+			}
+			w.pop()
+			return false
+		case *ast.IfStmt:
+			w.push()
+			w.walk(x.Init)
+			w.walk(x.Cond)
+			w.walk(x.Body)
+			w.walk(x.Else)
+			w.pop()
+			return false
+		case *ast.ForStmt:
+			w.push()
+			w.walk(x.Init)
+			w.walk(x.Cond)
+			w.walk(x.Post)
+			w.walk(x.Body)
+			w.pop()
+			return false
+		case *ast.RangeStmt:
+			w.walk(x.X)
+			w.push()
+			if x.Tok == token.DEFINE {
+				w.declare(x.Key, x.Value)
+			} else {
+				w.walk(x.Key)
+				w.walk(x.Value)
+			}
+			w.walk(x.Body)
+			w.pop()
+			return false
+		case *ast.SwitchStmt:
+			w.push()
+			w.walk(x.Init)
+			w.walk(x.Tag)
+			w.walk(x.Body)
+			w.pop()
+			return false
+		case *ast.TypeSwitchStmt:
+			w.push()
+			w.walk(x.Init)
+			// v := x.(type) 中的 v 在每个 case 中分别声明
+			var bound ast.Expr
+			if as, ok := x.Assign.(*ast.AssignStmt); ok && len(as.Lhs) == 1 && len(as.Rhs) == 1 {
+				w.walk(as.Rhs[0])
+				bound = as.Lhs[0]
+			} else {
+				w.walk(x.Assign)
+			}
+			for _, stmt := range x.Body.List {
+				w.push()
+				w.declare(bound)
+				w.walk(stmt)
+				w.pop()
+			}
+			w.pop()
+			return false
+		case *ast.CaseClause:
+			w.push()
+			for _, e := range x.List {
+				w.walk(e)
+			}
+			for _, stmt := range x.Body {
+				w.walk(stmt)
+			}
+			w.pop()
+			return false
+		case *ast.CommClause:
+			w.push()
+			w.walk(x.Comm)
+			for _, stmt := range x.Body {
+				w.walk(stmt)
+			}
+			w.pop()
+			return false
+		case *ast.AssignStmt:
+			// 右侧的表达式在左侧的名称声明之前求值
+			for _, e := range x.Rhs {
+				w.walk(e)
+			}
+			if x.Tok == token.DEFINE {
+				w.declare(x.Lhs...)
+			} else {
+				for _, e := range x.Lhs {
+					w.walk(e)
+				}
+			}
+			return false
+		case *ast.ValueSpec:
+			w.walk(x.Type)
+			for _, e := range x.Values {
+				w.walk(e)
 			}
+			for _, id := range x.Names {
+				w.declare(id)
+			}
+			return false
+		case *ast.TypeSpec:
+			w.declare(x.Name)
+			w.walk(x.Type)
+			return false
+		case *ast.Field:
+			// Names 为字段名称，参数名称由 fields 处理
+			w.walk(x.Type)
+			return false
+		case *ast.LabeledStmt:
+			w.walk(x.Stmt)
+			return false
+		case *ast.BranchStmt:
+			return false
+		case *ast.SelectorExpr:
+			// Sel 为字段或方法名称
+			w.walk(x.X)
+			return false
+		case *ast.KeyValueExpr:
+			// 结构体字面量的 key 为字段名称
+			if _, ok := x.Key.(*ast.Ident); !ok {
+				w.walk(x.Key)
+			}
+			w.walk(x.Value)
+			return false
+		case *ast.Ident:
+			w.visit(x, w.local)
 		}
-		if newFunc.Type.Results == nil {
-			newFunc.Type.Results = &ast.FieldList{
-				List: make([]*ast.Field, 0),
+		return true
+	})
+}
+
+// funcRef 文件中对函数或方法的一处引用
+type funcRef struct {
+	// expr 为引用表达式，普通函数为 *ast.Ident，方法为 *ast.SelectorExpr
+	expr ast.Expr
+	// name 为 expr 中的函数名称
+	name *ast.Ident
+	// methodExpr 表示 Stu.Name、(*Stu).Name 形式的方法表达式，调用时第一个参数为接收者
+	methodExpr bool
+}
+
+// findFuncRefs 查找文件中对函数或方法的引用
+//
+// recv 为空时查找普通函数 name 的引用，被局部的同名声明遮蔽的标识符不包括在内
+//
+// recv 不为空时查找 recv 类型的方法 name 的引用，x.Name 中 x 的类型需要能在本文件中推断出来，
+// 即接收者、参数、var x Stu、x := &Stu{} 等形式
+func findFuncRefs(f *ast.File, recv, name string) []funcRef {
+	if recv != "" {
+		return findMethodRefs(f, recv, name)
+	}
+	refs := make([]funcRef, 0)
+	for _, decl := range f.Decls {
+		walkScopes(decl, func(id *ast.Ident, local func(string) bool) {
+			if id.Name == name && !local(name) {
+				refs = append(refs, funcRef{expr: id, name: id})
 			}
+		})
+	}
+	return refs
+}
+
+// isShadowedAtRefs 判断文件中引用 name 的位置是否声明了局部名称 newName，此时重命名会使引用指向局部名称
+func isShadowedAtRefs(f *ast.File, name, newName string) bool {
+	shadowed := false
+	for _, decl := range f.Decls {
+		walkScopes(decl, func(id *ast.Ident, local func(string) bool) {
+			if id.Name == name && !local(name) && local(newName) {
+				shadowed = true
+			}
+		})
+	}
+	return shadowed
+}
+
+// findMethodRefs 查找文件中对 recv 的方法 name 的引用
+func findMethodRefs(f *ast.File, recv, name string) []funcRef {
+	refs := make([]funcRef, 0)
+	global := make(map[string]string)
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+			collectVarTypes(gen, global)
 		}
-		for _, param := range params.Results {
-			newFunc.Type.Results.List = append(newFunc.Type.Results.List, getField(param.Key, param.Value))
+	}
+	for _, decl := range f.Decls {
+		vars := global
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			vars = funcVarTypes(fd, global)
 		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != name {
+				return true
+			}
+			switch x := sel.X.(type) {
+			case *ast.ParenExpr:
+				// (*Stu).Name
+				if s, ok := x.X.(*ast.StarExpr); ok && typeName(s.X) == recv {
+					refs = append(refs, funcRef{expr: sel, name: sel.Sel, methodExpr: true})
+				}
+			case *ast.Ident:
+				if x.Name == recv {
+					refs = append(refs, funcRef{expr: sel, name: sel.Sel, methodExpr: true})
+				} else if vars[x.Name] == recv {
+					refs = append(refs, funcRef{expr: sel, name: sel.Sel})
+				}
+			}
+			return true
+		})
 	}
+	return refs
+}
 
-	if params.Return != nil {
-		if newFunc.Body == nil {
-			newFunc.Body = &ast.BlockStmt{
-				List: make([]ast.Stmt, 0),
+// funcVarTypes 收集函数的接收者、参数及函数内变量的类型名称
+func funcVarTypes(fd *ast.FuncDecl, global map[string]string) map[string]string {
+	vars := make(map[string]string, len(global))
+	for k, v := range global {
+		vars[k] = v
+	}
+	for _, list := range []*ast.FieldList{fd.Recv, fd.Type.Params} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, id := range field.Names {
+				vars[id.Name] = typeName(field.Type)
 			}
 		}
-		newFunc.Body.List = append(newFunc.Body.List, getReturnStmt(params.Return))
 	}
-
-	if params.Recv != nil {
-		newFunc.Recv = &ast.FieldList{
-			List: []*ast.Field{},
+	if fd.Body == nil {
+		return vars
+	}
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.GenDecl:
+			collectVarTypes(s, vars)
+		case *ast.AssignStmt:
+			if s.Tok != token.DEFINE || len(s.Lhs) != len(s.Rhs) {
+				return true
+			}
+			for i, lhs := range s.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok {
+					vars[id.Name] = valueTypeName(s.Rhs[i])
+				}
+			}
 		}
-		field := &ast.Field{
-			Names: []*ast.Ident{ast.NewIdent(params.Recv.Key)},
-			Type:  ast.NewIdent(params.Recv.Value),
+		return true
+	})
+	return vars
+}
+
+// collectVarTypes 收集 var 声明中变量的类型名称
+func collectVarTypes(gen *ast.GenDecl, vars map[string]string) {
+	for _, spec := range gen.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
 		}
-		if strings.HasPrefix(params.Recv.Value, "*") {
-			field.Type = &ast.StarExpr{
-				X: ast.NewIdent(strings.TrimPrefix(params.Recv.Value, "*")),
+		for i, id := range vs.Names {
+			switch {
+			case vs.Type != nil:
+				vars[id.Name] = typeName(vs.Type)
+			case len(vs.Values) == len(vs.Names):
+				vars[id.Name] = valueTypeName(vs.Values[i])
 			}
 		}
-		newFunc.Recv.List = append(newFunc.Recv.List, field)
 	}
-	return newFunc
 }
 
-func getReturnStmt(rtns []string) *ast.ReturnStmt {
-	ret := &ast.ReturnStmt{Return: token.NoPos}
-	if len(rtns) == 0 {
-		return ret
+func addKVToUnaryExpr(f *ast.File, ue *ast.UnaryExpr, key, value, marker string) bool {
+	switch cpl := ue.X.(type) {
+	case *ast.CompositeLit:
+		if cpl.Elts == nil {
+			cpl.Elts = []ast.Expr{}
+		}
+		// 判断参数是否存在 -- 不完善，暂时屏蔽
+		//for _, elt := range cpl.Elts {
+		//	if elt.(*ast.KeyValueExpr).Key.(*ast.Ident).Name == key {
+		//		return false
+		//	}
+		//}
+		if skipApplied(f, hasExpr(cpl.Elts, getKVExpr(key, value))) {
+			return true
+		}
+		return insertExprAtMarker(f, cpl, &cpl.Elts, cpl.Lbrace, cpl.Rbrace, marker, getKVExpr(key, value))
+	}
+	return false
+}
+
+// getFuncDecl 根据 AstFunc 生成函数声明
+//  函数先生成为源码再解析，这样函数体及注释都可以原样保留
+func getFuncDecl(params *AstFunc) (*ast.FuncDecl, error) {
+	decls, err := parseDecls(getFuncSource(params))
+	if err != nil {
+		return nil, err
+	}
+	if len(decls) != 1 {
+		return nil, fmt.Errorf("func %s: body must not contain declarations outside the function", params.Name)
+	}
+	fd, ok := decls[0].(*ast.FuncDecl)
+	if !ok {
+		return nil, fmt.Errorf("func %s: not a function", params.Name)
+	}
+	return fd, nil
+}
+
+// getFuncSource 根据 AstFunc 生成函数源码
+func getFuncSource(params *AstFunc) string {
+	var buf strings.Builder
+	for _, doc := range params.Doc {
+		for _, line := range strings.Split(doc, "\n") {
+			if !strings.HasPrefix(line, "//") {
+				line = "// " + line
+			}
+			buf.WriteString(line)
+			buf.WriteString("\n")
+		}
+	}
+	buf.WriteString("func ")
+	if params.Recv != nil {
+		buf.WriteString("(" + getKvSource(*params.Recv) + ") ")
 	}
-	ret.Results = make([]ast.Expr, 0)
-	for _, rtn := range rtns {
-		ret.Results = append(ret.Results, ast.NewIdent(rtn))
+	buf.WriteString(params.Name)
+	buf.WriteString("(" + getFieldsSource(params.Params) + ")")
+	switch {
+	case len(params.Results) == 1 && params.Results[0].Key == "":
+		buf.WriteString(" " + params.Results[0].Value)
+	case len(params.Results) > 0:
+		buf.WriteString(" (" + getFieldsSource(params.Results) + ")")
+	}
+	buf.WriteString(" {\n")
+	if body := strings.TrimSpace(params.Body); body != "" {
+		buf.WriteString(body)
+		buf.WriteString("\n")
+	}
+	if params.Return != nil {
+		buf.WriteString(strings.TrimSpace("return " + strings.Join(params.Return, ", ")))
+		buf.WriteString("\n")
 	}
-	return ret
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// getFieldsSource 生成参数列表源码
+func getFieldsSource(list []AstKv) string {
+	fields := make([]string, 0, len(list))
+	for _, kv := range list {
+		fields = append(fields, getKvSource(kv))
+	}
+	return strings.Join(fields, ", ")
+}
+
+// getKvSource 生成 "name type" 形式的源码，name 可以为空
+func getKvSource(kv AstKv) string {
+	return strings.TrimSpace(kv.Key + " " + kv.Value)
 }
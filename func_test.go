@@ -3,6 +3,8 @@ package ozastutil
 import (
 	"github.com/stretchr/testify/assert"
 	"go/ast"
+	"go/parser"
+	"go/token"
 	"testing"
 )
 
@@ -119,6 +121,9 @@ func TestAddVarToFunc(t *testing.T) {
 	//assert.True(t, ret)
 	ret := AddVarToFunc(f, "t", "te2222", "key", "", "assign")
 	assert.True(t, ret)
+	src, err := FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "func t() {\n\tte2222 := key\n}")
 	PrintResult(fst,f)
 
 }
@@ -136,7 +141,204 @@ func TestAddCallBlockToFunc(t *testing.T) {
 
 func TestGetLastVarFormFunc(t *testing.T) {
 	fst, f := InitEnv("./test_demo/func_demo.go")
-	ret := GetLastVarFormFunc(f, "StuFunc")
+	ret := GetLastVarFormFunc(f, "Stu.StuFunc")
 	assert.Equal(t, ret, "ret")
 	PrintResult(fst,f)
-}
\ No newline at end of file
+}
+func TestFindFunc(t *testing.T) {
+	_, f := InitEnv("./test_demo/func_edit_demo.go")
+
+	_, fd := findFunc(f, "TT")
+	assert.Nil(t, fd.Recv)
+
+	_, fd = findFunc(f, "Stu.TT")
+	assert.NotNil(t, fd.Recv)
+
+	_, fd = findFunc(f, "(*Stu).TT")
+	assert.NotNil(t, fd)
+
+	_, fd = findFunc(f, "(Stu).TT")
+	assert.Nil(t, fd)
+
+	_, fd = findFunc(f, "(Stu).StuFunc")
+	assert.NotNil(t, fd)
+
+	// 只写名称时只匹配普通函数，方法需要带上接收者
+	_, fd = findFunc(f, "PStuFunc")
+	assert.Nil(t, fd)
+	_, fd = findFunc(f, "Stu.PStuFunc")
+	assert.NotNil(t, fd)
+}
+
+func TestDeleteFunc(t *testing.T) {
+	// 保留注释
+	fst := token.NewFileSet()
+	f, err := parser.ParseFile(fst, "./test_demo/func_edit_demo.go", nil, parser.ParseComments)
+	assert.NoError(t, err)
+	ret := DeleteFunc(f, "(*Stu).TT")
+	assert.True(t, ret)
+
+	ret = DeleteFunc(f, "Stu.TT")
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "// TT 普通函数\nfunc TT(a string) string")
+	assert.NotContains(t, string(src), "与普通函数同名的方法")
+	assert.NotContains(t, string(src), "调用普通函数")
+	PrintResult(fst, f)
+}
+
+func TestRenameFunc(t *testing.T) {
+	fst, f := InitEnv("./test_demo/func_edit_demo.go")
+	ret := RenameFunc(f, "TT", "Hello")
+	assert.True(t, ret)
+
+	ret = RenameFunc(f, "(*Stu).PStuFunc", "World")
+	assert.True(t, ret)
+
+	// 与已有的声明冲突
+	ret = RenameFunc(f, "Hello", "end")
+	assert.False(t, ret)
+	ret = RenameFunc(f, "(Stu).StuFunc", "TT")
+	assert.False(t, ret)
+	// 调用处已有同名的局部变量
+	ret = RenameFunc(f, "end", "value")
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "func Hello(a string) string")
+	assert.Contains(t, string(src), `return Hello("tt")`)
+	assert.Contains(t, string(src), "func (s *Stu) TT() string")
+	assert.Contains(t, string(src), "func (s *Stu) World(a string) (ret string)")
+	assert.Contains(t, string(src), `stu.World("a")`)
+	assert.Contains(t, string(src), "(*Stu).World")
+	assert.Contains(t, string(src), `other.StuFunc("b"), Hello("c")`)
+	// 局部变量不受影响
+	assert.Contains(t, string(src), `TT := "local"`)
+	assert.Contains(t, string(src), "TT := 2\n\t\t_ = TT\n")
+	assert.Contains(t, string(src), `return Hello("n") + fmt.Sprint(value)`)
+	PrintResult(fst, f)
+}
+
+func TestReplaceFunc(t *testing.T) {
+	// 保留注释
+	fst := token.NewFileSet()
+	f, err := parser.ParseFile(fst, "./test_demo/func_edit_demo.go", nil, parser.ParseComments)
+	assert.NoError(t, err)
+	ret := ReplaceFunc(f, "Stu.TT", `func (s *Stu) TT() string {
+	// 新的实现
+	return "new"
+}`)
+	assert.True(t, ret)
+
+	ret = ReplaceFunc(f, "TT", `// TT 新的文档
+func TT(a, b string) string {
+	return a + b
+}`)
+	assert.True(t, ret)
+
+	ret = ReplaceFunc(f, "end", "var a = 1")
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	// 保留原有的文档注释
+	assert.Contains(t, string(src), "// TT 与普通函数同名的方法\nfunc (s *Stu) TT() string {\n\t// 新的实现\n\treturn \"new\"\n}")
+	assert.Contains(t, string(src), "// TT 新的文档\nfunc TT(a, b string) string {")
+	assert.NotContains(t, string(src), "普通函数\n")
+	assert.NotContains(t, string(src), "调用普通函数")
+	// 函数的顺序保持不变
+	assert.Contains(t, string(src), "}\n\n// Stu 测试结构体\ntype Stu struct {\n}\n\n// TT 与普通函数同名的方法")
+	PrintResult(fst, f)
+}
+
+func TestAddFuncBody(t *testing.T) {
+	fst, f := InitEnv("./test_demo/func_demo.go")
+
+	// 没有参数及返回值
+	ret := AddFunc(f, &AstFunc{Name: "empty"})
+	assert.True(t, ret)
+
+	// 文档注释、函数体、可变参数、多个匿名返回值
+	ret = AddFunc(f, &AstFunc{
+		Name: "test3",
+		Doc:  []string{"test3 返回 p2 的个数", "// 第二行"},
+		Params: []AstKv{
+			{Key: "p1", Value: "string"},
+			{Key: "p2", Value: "...int"},
+		},
+		Results: []AstKv{{Value: "int"}, {Value: "error"}},
+		Body: `// 检查参数
+if p1 == "" {
+	return 0, errors.New("empty")
+}`,
+		Return: []string{"len(p2)", "nil"},
+	})
+	assert.True(t, ret)
+
+	// 不带返回值的 return
+	ret = AddFunc(f, &AstFunc{
+		Name:   "test4",
+		Recv:   &AstKv{Value: "*Stu"},
+		Body:   "fmt.Println(1)",
+		Return: []string{},
+	})
+	assert.True(t, ret)
+
+	// 函数体不合法
+	ret = AddFunc(f, &AstFunc{Name: "test5", Body: "if {"})
+	assert.False(t, ret)
+	ret = AddFunc(f, &AstFunc{Name: "test5", Body: "}\nfunc test6() {"})
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "\nfunc empty() {\n}\n")
+	assert.Contains(t, string(src), `// test3 返回 p2 的个数
+// 第二行
+func test3(p1 string, p2 ...int) (int, error) {
+	// 检查参数
+	if p1 == "" {
+		return 0, errors.New("empty")
+	}
+	return len(p2), nil
+}`)
+	assert.Contains(t, string(src), "func (*Stu) test4() {\n\tfmt.Println(1)\n\treturn\n}")
+	PrintResult(fst, f)
+}
+
+func TestAddFuncAt(t *testing.T) {
+	fst, f := InitEnv("./test_demo/func_edit_demo.go")
+
+	ret := AddFuncAt(f, &AstFunc{Name: "afterTT"}, &AstInsertPos{After: "TT"})
+	assert.True(t, ret)
+
+	ret = AddFuncAt(f, &AstFunc{Name: "beforeEnd"}, &AstInsertPos{Before: "end"})
+	assert.True(t, ret)
+
+	ret = AddFuncAt(f, &AstFunc{Name: "Last", Recv: &AstKv{Key: "s", Value: "*Stu"}}, &AstInsertPos{AfterMethods: true})
+	assert.True(t, ret)
+
+	ret = AddFuncAt(f, &AstFunc{Name: "QStuFunc", Recv: &AstKv{Key: "s", Value: "Stu"}}, &AstInsertPos{Sorted: true})
+	assert.True(t, ret)
+
+	ret = AddFuncAt(f, &AstFunc{Name: "Other", Recv: &AstKv{Key: "o", Value: "*Other"}}, &AstInsertPos{AfterMethods: true})
+	assert.True(t, ret)
+
+	ret = AddFuncAt(f, &AstFunc{Name: "notFound"}, &AstInsertPos{After: "notFound"})
+	assert.False(t, ret)
+
+	ret = AddFuncAt(f, &AstFunc{Name: "noRecv"}, &AstInsertPos{Sorted: true})
+	assert.False(t, ret)
+
+	names := make([]string, 0)
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			names = append(names, fd.Name.Name)
+		}
+	}
+	assert.Equal(t, []string{"TT", "afterTT", "QStuFunc", "TT", "PStuFunc", "StuFunc", "Last", "useStu", "shadow", "nested", "beforeEnd", "end", "Other"}, names)
+	PrintResult(fst, f)
+}
@@ -0,0 +1,286 @@
+package ozastutil
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+// genMarker 生成代码的标记，写在文档注释的最后一行，格式为 //astutil:gen <kind> <Struct>
+//  重新生成时带有相同标记的声明会被原位替换，不再生成的会被删除，没有标记的同名声明视为手写代码，不做修改
+const genMarker = "//astutil:gen"
+
+// structField struct 的成员
+type structField struct {
+	// name 成员名称，嵌入成员为类型名称
+	name string
+	typ  ast.Expr
+	tag  string
+	// embedded 是否为嵌入成员
+	embedded bool
+}
+
+// applyGen 将生成的声明写入文件
+//  已存在带有相同标记的同名声明时原位替换，存在不带标记的同名声明时保留手写代码，
+//  不存在时从 index 处按顺序插入。文件中带有相同标记但不再生成的声明会被删除
+//  srcs 为每个声明的源码，包含文档注释及标记
+func applyGen(f *ast.File, kind, structName string, srcs []string, index int) bool {
+	marker := genMarker + " " + kind + " " + structName
+	decls := make([]ast.Decl, 0, len(srcs))
+	for _, src := range srcs {
+		parsed, err := parseDecls(src)
+		if err != nil || len(parsed) != 1 {
+			return false
+		}
+		decls = append(decls, parsed[0])
+	}
+	if skipApplied(f, isGenApplied(f, marker, decls)) {
+		return true
+	}
+	wanted := make(map[string]bool, len(srcs))
+	for _, decl := range decls {
+		key := declKey(decl)
+		wanted[key] = true
+		i := findDeclKey(f, key)
+		switch {
+		case i == -1:
+			insertDecls(f, index-1, decl)
+			index++
+		case hasGenMarker(f.Decls[i], marker):
+			removeComments(f, f.Decls[i])
+			replaceDecl(f, i, decl)
+		}
+		if i >= index {
+			// 后续的新声明跟在已有的声明之后
+			index = i + 1
+		}
+	}
+	list := f.Decls[:0]
+	for _, decl := range f.Decls {
+		if hasGenMarker(decl, marker) && !wanted[declKey(decl)] {
+			removeComments(f, decl)
+			releaseDecl(decl)
+			continue
+		}
+		list = append(list, decl)
+	}
+	f.Decls = list
+	return true
+}
+
+// isGenApplied 判断生成的声明是否都已存在且内容相同，并且没有多余的生成代码
+func isGenApplied(f *ast.File, marker string, decls []ast.Decl) bool {
+	wanted := make(map[string]bool, len(decls))
+	for _, decl := range decls {
+		key := declKey(decl)
+		wanted[key] = true
+		i := findDeclKey(f, key)
+		if i == -1 || hasGenMarker(f.Decls[i], marker) && !sameNode(f.Decls[i], decl) {
+			return false
+		}
+	}
+	for _, decl := range f.Decls {
+		if hasGenMarker(decl, marker) && !wanted[declKey(decl)] {
+			return false
+		}
+	}
+	return true
+}
+
+// declKey 返回声明的名称，方法为 Stu.GetName 形式，分组声明返回空
+func declKey(decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if recv, _ := funcRecv(d); recv != "" {
+			return recv + "." + d.Name.Name
+		}
+		return d.Name.Name
+	case *ast.GenDecl:
+		if len(d.Specs) != 1 {
+			return ""
+		}
+		switch s := d.Specs[0].(type) {
+		case *ast.TypeSpec:
+			return s.Name.Name
+		case *ast.ValueSpec:
+			if len(s.Names) == 1 {
+				return s.Names[0].Name
+			}
+		}
+	}
+	return ""
+}
+
+// findDeclKey 根据 declKey 查找声明的下标
+func findDeclKey(f *ast.File, key string) int {
+	if key == "" {
+		return -1
+	}
+	for i, decl := range f.Decls {
+		if declKey(decl) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasGenMarker 判断声明的文档注释中是否带有标记
+func hasGenMarker(decl ast.Decl, marker string) bool {
+	var doc *ast.CommentGroup
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		doc = d.Doc
+	case *ast.GenDecl:
+		doc = d.Doc
+	}
+	for _, line := range commentLines(doc) {
+		if strings.TrimSpace(line) == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// genDoc 返回带有标记的文档注释
+func genDoc(kind, structName string, lines ...string) string {
+	var buf strings.Builder
+	for _, line := range lines {
+		buf.WriteString("// " + line + "\n")
+	}
+	if len(lines) > 0 {
+		// 与 gofmt 一致，指令与文档之间以空注释行分隔
+		buf.WriteString("//\n")
+	}
+	buf.WriteString(genMarker + " " + kind + " " + structName + "\n")
+	return buf.String()
+}
+
+// findStructFields 返回 struct 的成员，只返回 names 中的成员，names 为空时返回所有成员，不包括 _ 成员。
+// 不是 struct 或为泛型 struct 时返回 false
+func findStructFields(f *ast.File, structName string, names ...string) ([]structField, bool) {
+	spec := findTypeSpec(f, structName)
+	if spec == nil || spec.TypeParams != nil {
+		return nil, false
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return nil, false
+	}
+	fields := make([]structField, 0)
+	for _, field := range st.Fields.List {
+		for _, name := range fieldNamesOf(field) {
+			fields = append(fields, structField{name: name, typ: field.Type, tag: fieldTag(field), embedded: len(field.Names) == 0})
+		}
+	}
+	if len(names) == 0 {
+		return fields, true
+	}
+	selected := make([]structField, 0, len(names))
+	for _, field := range fields {
+		for _, name := range names {
+			if field.name == name {
+				selected = append(selected, field)
+				break
+			}
+		}
+	}
+	return selected, true
+}
+
+// findLocalType 返回类型在文件中的声明，不是本文件声明的类型、泛型或别名返回 nil
+func findLocalType(f *ast.File, typ ast.Expr) *ast.TypeSpec {
+	id, ok := typ.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	spec := findTypeSpec(f, id.Name)
+	if spec == nil || spec.TypeParams != nil || spec.Assign.IsValid() {
+		return nil
+	}
+	return spec
+}
+
+// isLocalStruct 判断类型是否为本文件声明的 struct
+func isLocalStruct(f *ast.File, typ ast.Expr) bool {
+	if spec := findLocalType(f, typ); spec != nil {
+		_, ok := spec.Type.(*ast.StructType)
+		return ok
+	}
+	return false
+}
+
+// fieldTag 返回成员的标签
+func fieldTag(field *ast.Field) string {
+	if field.Tag == nil {
+		return ""
+	}
+	return field.Tag.Value
+}
+
+// fieldNamesOf 返回成员的名称，嵌入成员为类型名称，不包括 _ 成员
+func fieldNamesOf(field *ast.Field) []string {
+	if len(field.Names) == 0 {
+		return []string{embeddedName(field.Type)}
+	}
+	names := make([]string, 0, len(field.Names))
+	for _, id := range field.Names {
+		if id.Name != "_" {
+			names = append(names, id.Name)
+		}
+	}
+	return names
+}
+
+// embeddedName 返回嵌入成员的名称
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// exportedName 返回首字母大写的名称
+func exportedName(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// paramName 返回首字母小写的参数名称，开头连续的大写字母一起转为小写，如 ID 为 id、URLPath 为 urlPath，
+// 与关键字或 avoid 冲突时加上后缀 _
+func paramName(name string, avoid ...string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+	for i := 0; i < upper || i == 0; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	name = string(runes)
+	for conflict := true; conflict; {
+		conflict = token.IsKeyword(name)
+		for _, a := range avoid {
+			if a == name {
+				conflict = true
+			}
+		}
+		if conflict {
+			name += "_"
+		}
+	}
+	return name
+}
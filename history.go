@@ -0,0 +1,238 @@
+package ozastutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 修改记录
+//
+// 通过 Session.Apply 执行的修改会记录到会话的修改记录中，Undo、Redo 在修改前后的状态之间切换，
+// 修改记录可以导出为 recipe，在模板的新副本上重新执行
+
+// ErrNothingToUndo 没有可以撤销的修改
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// ErrNothingToRedo 没有可以重做的修改
+var ErrNothingToRedo = errors.New("nothing to redo")
+
+// LogEntry 一次成功的修改
+type LogEntry struct {
+	// Step 修改的操作名称及参数，格式同 recipe 的步骤
+	Step RecipeStep `json:"step"`
+	// Target 受影响节点的选择器，如 type[name=Stu] > field[name=Age]，无法确定（如删除函数）时为空
+	Target string `json:"target,omitempty"`
+	// Node 修改写入或改动的节点，即修改后 Target 查询到的节点中修改前没有的节点，不参与序列化
+	Node ast.Node `json:"-"`
+
+	before *FileSnapshot
+	after  *FileSnapshot
+}
+
+// Apply 执行一个修改步骤并记录到修改记录中，step.File 为空且会话只有一个文件时修改该文件
+//
+//	只有实际执行的修改（EditApplied）会被记录，记录新的修改后不能再 Redo 已撤销的修改，
+//	修改失败时文件恢复到执行前的状态
+//
+// 例子：
+//
+// s.Apply(RecipeStep{Op: "add_struct_field", Struct: "Stu", Name: "Age", Type: "int"})
+func (s *Session) Apply(step RecipeStep) StepResult {
+	result := StepResult{Op: step.Op, File: step.File, Index: len(s.log)}
+	op, ok := recipeOps[step.Op]
+	if !ok {
+		result.Error = fmt.Sprintf("unknown op %q", step.Op)
+		return result
+	}
+	f := s.stepFile(step.File)
+	if f == nil {
+		result.Error = fmt.Sprintf("file %s not loaded", step.File)
+		return result
+	}
+	if step.File == "" {
+		step.File = s.fset.Position(f.Package).Filename
+		result.File = step.File
+	}
+	before := Snapshot(f)
+	result.Result = runEdit(f, func() bool {
+		return op(s.fset, f, &step)
+	})
+	switch result.Result {
+	case EditFailed:
+		// 修改可能在中途失败，恢复到修改前的状态
+		before.Restore()
+		result.Error = fmt.Sprintf("%s failed", step.Op)
+	case EditApplied:
+		entry := &LogEntry{Step: step, Target: stepTarget(&step), before: before, after: Snapshot(f)}
+		if entry.Target != "" {
+			if m, err := Query(f, entry.Target); err == nil {
+				if changed := entry.changedMatches(m); len(changed) > 0 {
+					entry.Node = changed[len(changed)-1].Node
+				}
+			}
+		}
+		s.log = append(s.log, entry)
+		s.undone = nil
+	}
+	return result
+}
+
+// changedMatches 返回 matches 中由该修改写入或改动的节点：与修改前后 Target 查询结果的源码比较，
+// 修改后比修改前多出的源码即为修改写入的节点。源码相同的节点有多个时认为靠后的节点是写入的
+func (e *LogEntry) changedMatches(matches []QueryMatch) []QueryMatch {
+	after, err := Query(e.after.saved, e.Target)
+	if err != nil {
+		return nil
+	}
+	texts := make(map[string]int)
+	for _, m := range after {
+		texts[exprString(m.Node)]++
+	}
+	if before, err := Query(e.before.saved, e.Target); err == nil {
+		for _, m := range before {
+			texts[exprString(m.Node)]--
+		}
+	}
+	changed := make([]QueryMatch, 0)
+	for i := len(matches) - 1; i >= 0; i-- {
+		if text := exprString(matches[i].Node); texts[text] > 0 {
+			texts[text]--
+			changed = append([]QueryMatch{matches[i]}, changed...)
+		}
+	}
+	return changed
+}
+
+// stepFile 返回步骤的目标文件，路径不完全相同时按文件名查找，便于在模板的新副本上重新执行
+func (s *Session) stepFile(path string) *ast.File {
+	if path == "" {
+		if len(s.files) == 1 {
+			return s.files[0]
+		}
+		return nil
+	}
+	if f := s.File(path); f != nil {
+		return f
+	}
+	for _, f := range s.files {
+		if filepath.Base(s.fset.Position(f.Package).Filename) == filepath.Base(path) {
+			return f
+		}
+	}
+	return nil
+}
+
+// Log 返回当前生效的修改记录，不包括已撤销的修改
+func (s *Session) Log() []*LogEntry {
+	return s.log
+}
+
+// Undo 撤销最近一次修改，文件恢复到修改前的状态
+func (s *Session) Undo() error {
+	if len(s.log) == 0 {
+		return ErrNothingToUndo
+	}
+	entry := s.log[len(s.log)-1]
+	entry.before.Restore()
+	s.log = s.log[:len(s.log)-1]
+	s.undone = append(s.undone, entry)
+	return nil
+}
+
+// Redo 重做最近一次撤销的修改
+func (s *Session) Redo() error {
+	if len(s.undone) == 0 {
+		return ErrNothingToRedo
+	}
+	entry := s.undone[len(s.undone)-1]
+	entry.after.Restore()
+	s.undone = s.undone[:len(s.undone)-1]
+	s.log = append(s.log, entry)
+	return nil
+}
+
+// Recipe 将修改记录导出为 recipe，每次修改为一个步骤
+func (s *Session) Recipe() *Recipe {
+	recipe := &Recipe{Steps: make([]RecipeStep, 0, len(s.log))}
+	for _, entry := range s.log {
+		recipe.Steps = append(recipe.Steps, entry.Step)
+	}
+	return recipe
+}
+
+// MarshalLog 将修改记录序列化为 JSON 格式的 recipe，可以用 ParseRecipe 解析后交给 Replay 重新执行
+func (s *Session) MarshalLog() ([]byte, error) {
+	return json.MarshalIndent(s.Recipe(), "", "  ")
+}
+
+// Replay 依次执行 recipe 中的步骤并记录到修改记录中，步骤中的文件按路径或文件名匹配会话中的文件
+func (s *Session) Replay(recipe *Recipe) []StepResult {
+	results := make([]StepResult, 0, len(recipe.Steps))
+	for i, step := range recipe.Steps {
+		if step.File == "" {
+			step.File = recipe.File
+		}
+		if f := s.stepFile(step.File); f != nil {
+			step.File = s.fset.Position(f.Package).Filename
+		}
+		result := s.Apply(step)
+		result.Index = i
+		results = append(results, result)
+	}
+	return results
+}
+
+// stepTarget 返回步骤修改的节点的选择器
+func stepTarget(s *RecipeStep) string {
+	switch s.Op {
+	case "add_import":
+		return "import[path=" + strconv.Quote(s.Path) + "]"
+	case "add_struct_field", "add_interface_method":
+		return "type[name=" + s.Struct + "] > field[name=" + s.Name + "]"
+	case "add_var", "define_var":
+		return "var[name=" + s.Name + "]"
+	case "add_value_to_slice", "add_value_to_caller":
+		return "var[name=" + s.Var + "]"
+	case "add_value_to_map", "add_kv_to_struct_var":
+		return "var[name=" + s.Var + "] > kv[key=" + strconv.Quote(s.Key) + "]"
+	case "add_func":
+		name := s.Name
+		if s.Recv != "" {
+			name = strings.TrimPrefix(s.Recv, "*") + "." + name
+		}
+		return funcSelector(name)
+	case "replace_func":
+		return funcSelector(s.Name)
+	case "rename_func":
+		recv, _, _ := parseFuncName(s.Name)
+		if recv != "" {
+			return funcSelector(recv + "." + s.NewName)
+		}
+		return funcSelector(s.NewName)
+	case "add_param":
+		return funcSelector(s.Func) + " > param[name=" + s.Name + "]"
+	case "add_var_to_func":
+		if s.Tag == "" || s.Tag == "var" {
+			return funcSelector(s.Func) + " var[name=" + s.Name + "]"
+		}
+		return funcSelector(s.Func) + " assign[lhs=" + s.Name + "]"
+	case "add_kv_to_func_struct":
+		return funcSelector(s.Func) + " kv[key=" + strconv.Quote(s.Key) + "]"
+	case "add_call_block":
+		if len(s.Calls) > 0 {
+			return funcSelector(s.Func) + " call[fun=" + s.Calls[0].Fun + "." + s.Calls[0].Sel + "]"
+		}
+	}
+	return ""
+}
+
+// funcSelector 将 findFunc 格式的函数名称转换为选择器
+func funcSelector(name string) string {
+	recv, _, funcName := parseFuncName(name)
+	return "func[name=" + funcName + "][recv=" + recv + "]"
+}
@@ -0,0 +1,100 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionHistory(t *testing.T) {
+	s, err := LoadSession("./test_demo/edit_demo.go")
+	assert.NoError(t, err)
+	f := s.Files()[0]
+	src0, _ := formatFile(s.FileSet(), f)
+
+	steps := []RecipeStep{
+		{Op: "add_struct_field", Struct: "Stu", Name: "Age", Type: "int"},
+		{Op: "add_value_to_map", Var: "handlers", Key: `"b"`, Value: "2"},
+		{Op: "add_func", Name: "Hello", Recv: "*Stu", Body: "fmt.Println(s.Name)"},
+		{Op: "delete_func", Name: "Old"},
+	}
+	srcs := [][]byte{src0}
+	for _, step := range steps {
+		result := s.Apply(step)
+		assert.Equal(t, EditApplied, result.Result)
+		src, _ := formatFile(s.FileSet(), f)
+		srcs = append(srcs, src)
+	}
+	failed := s.Apply(RecipeStep{Op: "add_param", Func: "NotFound", Name: "n", Type: "int"})
+	assert.Equal(t, EditFailed, failed.Result)
+	assert.NotEqual(t, "", failed.Error)
+	after, _ := formatFile(s.FileSet(), f)
+	assert.Equal(t, string(srcs[len(srcs)-1]), string(after))
+	assert.Equal(t, 4, len(s.Log()))
+
+	// 记录受影响的节点
+	log := s.Log()
+	assert.Equal(t, "type[name=Stu] > field[name=Age]", log[0].Target)
+	assert.Equal(t, "Age", log[0].Node.(*ast.Field).Names[0].Name)
+	assert.Equal(t, `"b": 2`, exprString(log[1].Node))
+	assert.Equal(t, "Hello", log[2].Node.(*ast.FuncDecl).Name.Name)
+	assert.Nil(t, log[3].Node)
+
+	// 撤销及重做
+	for i := len(steps) - 1; i >= 0; i-- {
+		assert.NoError(t, s.Undo())
+		src, _ := formatFile(s.FileSet(), f)
+		assert.Equal(t, string(srcs[i]), string(src))
+	}
+	assert.Equal(t, ErrNothingToUndo, s.Undo())
+	assert.NoError(t, s.Redo())
+	assert.NoError(t, s.Redo())
+	src, _ := formatFile(s.FileSet(), f)
+	assert.Equal(t, string(srcs[2]), string(src))
+
+	// 新的修改后不能再重做
+	assert.Equal(t, EditApplied, s.Apply(RecipeStep{Op: "add_value_to_slice", Var: "routes", Value: `"/a"`}).Result)
+	assert.Equal(t, ErrNothingToRedo, s.Redo())
+	assert.Equal(t, 3, len(s.Log()))
+
+	// 事务回滚时修改记录一并恢复
+	assert.NoError(t, s.Begin())
+	s.Apply(RecipeStep{Op: "add_import", Path: "strings"})
+	assert.NoError(t, s.Undo())
+	assert.NoError(t, s.Undo())
+	assert.NoError(t, s.Rollback())
+	assert.Equal(t, 3, len(s.Log()))
+	PrintResult(s.FileSet(), f)
+}
+
+func TestSessionReplay(t *testing.T) {
+	s, err := LoadSession("./test_demo/edit_demo.go")
+	assert.NoError(t, err)
+	s.Apply(RecipeStep{Op: "add_struct_field", Struct: "Stu", Name: "Age", Type: "int"})
+	s.Apply(RecipeStep{Op: "add_call_block", Func: "Setup", Calls: []RecipeCall{{Fun: "fmt", Sel: "Println", Args: []string{`"setup"`}}}})
+	s.Apply(RecipeStep{Op: "rename_func", Name: "Rename", NewName: "Renamed"})
+	want, _ := formatFile(s.FileSet(), s.Files()[0])
+	data, err := s.MarshalLog()
+	assert.NoError(t, err)
+
+	// 在模板的新副本上重新执行
+	src, err := ioutil.ReadFile("./test_demo/edit_demo.go")
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "edit_demo.go")
+	assert.NoError(t, ioutil.WriteFile(path, src, 0644))
+	recipe, err := ParseRecipe(data)
+	assert.NoError(t, err)
+	fresh, err := LoadSession(path)
+	assert.NoError(t, err)
+	results := fresh.Replay(recipe)
+	assert.Equal(t, 3, len(results))
+	for _, result := range results {
+		assert.Equal(t, EditApplied, result.Result)
+	}
+	got, _ := formatFile(fresh.FileSet(), fresh.Files()[0])
+	assert.Equal(t, string(want), string(got))
+	assert.Equal(t, 3, len(fresh.Log()))
+	assert.Equal(t, "func[name=Renamed][recv=]", fresh.Log()[2].Target)
+}
@@ -7,10 +7,13 @@ import (
 )
 
 // AddImport 添加包名
-//  参数 name 可以为空
+//  参数 name 可以为空，fset 为 nil 时新的 import 声明添加到 package 子句之后，不考虑同一行的注释
 func AddImport(fset *token.FileSet, f *ast.File, name, path string) bool {
 	if !canImport(f, name, path) {
-		return false
+		return skipApplied(f, path != "")
+	}
+	if skipApplied(f, hasImportSpec(f, name, path)) {
+		return true
 	}
 
 	// 注册一个新增import实例
@@ -26,45 +29,50 @@ func AddImport(fset *token.FileSet, f *ast.File, name, path string) bool {
 		newImport.Name = &ast.Ident{Name: name}
 	}
 
-	// 判断原文件中是否存在一个或多个import关键字
-	impDecl := &ast.GenDecl{
-		Tok: token.IMPORT,
-	}
+	// 添加到最后一个import关键字中
 	lastImport := -1
-	lastIndex := -1
 	for i, decl := range f.Decls {
 		gen, ok := decl.(*ast.GenDecl)
 		if ok && gen.Tok == token.IMPORT {
 			lastImport = i
-			lastIndex = len(gen.Specs) - 1
-			impDecl = gen
 		}
 	}
+	if lastImport != -1 {
+		gen := f.Decls[lastImport].(*ast.GenDecl)
+		return insertNode(f, gen, len(gen.Specs), exprString(newImport))
+	}
 
-	// 原文件没有import关键字
-	if lastImport == -1 {
-		impDecl.TokPos = f.Package
+	// 原文件没有import关键字，新声明输出在 package 子句所在行的下一个非空行之前，
+	// package 子句同一行的注释仍然留在该行
+	impDecl := &ast.GenDecl{
+		Tok:   token.IMPORT,
+		Specs: []ast.Spec{newImport},
+	}
+	hint := token.NoPos
+	if fset != nil && fset.File(f.Package) != nil {
 		file := fset.File(f.Package)
 		pkgLine := file.Line(f.Package)
+		hint = token.Pos(file.Base() + file.Size())
 		for _, c := range f.Comments {
 			if file.Line(c.Pos()) > pkgLine {
+				hint = c.Pos()
+				break
+			}
+		}
+		for _, decl := range f.Decls {
+			if !isNewDecl(decl) {
+				if from, _ := declRange(decl); from < hint {
+					hint = from
+				}
 				break
 			}
-			// +2 for a blank line
-			impDecl.TokPos = c.End() + 2
 		}
-		f.Decls = append(f.Decls, nil)
-		copy(f.Decls[lastImport+2:], f.Decls[lastImport+1:])
-		f.Decls[lastImport+1] = impDecl
-	} else {
-		impDecl.TokPos = f.Decls[lastImport].End()
+		if hint < token.Pos(file.Base()+file.Size()) {
+			hint = file.LineStart(file.Line(hint))
+		}
 	}
-
-	// 将import实例注入decl的specs空间中
-	insertAt := lastIndex + 1
-	impDecl.Specs = append(impDecl.Specs, nil)
-	copy(impDecl.Specs[insertAt+1:], impDecl.Specs[insertAt:])
-	impDecl.Specs[insertAt] = newImport
+	setDeclHint(impDecl, hint)
+	insertDecls(f, -1, impDecl)
 	return true
 }
 
@@ -80,6 +88,23 @@ func canImport(f *ast.File, name, path string) bool {
 	return true
 }
 
+// hasImportSpec 判断文件的 import 声明中是否已存在相同的包，包括新添加的 import
+func hasImportSpec(f *ast.File, name, path string) bool {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			s := spec.(*ast.ImportSpec)
+			if importName(s) == name && importPath(s) == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // importName returns the name of s,
 // or "" if the import is not named.
 func importName(s *ast.ImportSpec) string {
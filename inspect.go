@@ -0,0 +1,352 @@
+package ozastutil
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// 结构化查询
+//
+// Inspect 返回文件中 import、类型、变量、常量及函数的描述，FuncLocals 返回函数内的局部变量，
+// 类型及值均为源码文本，结果可以直接序列化为 JSON，供生成器判断要做哪些修改
+
+// FileInfo 文件的描述
+type FileInfo struct {
+	// File 文件路径，文件没有关联 FileSet 时为空
+	File    string       `json:"file,omitempty"`
+	Package string       `json:"package"`
+	Imports []ImportInfo `json:"imports,omitempty"`
+	Types   []TypeInfo   `json:"types,omitempty"`
+	Vars    []ValueInfo  `json:"vars,omitempty"`
+	Consts  []ValueInfo  `json:"consts,omitempty"`
+	Funcs   []FuncInfo   `json:"funcs,omitempty"`
+}
+
+// ImportInfo import 的别名及路径，没有别名时 Name 为空
+type ImportInfo struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path"`
+}
+
+// TypeInfo 类型声明
+type TypeInfo struct {
+	Name string `json:"name"`
+	// Kind 为 struct、interface、alias（type A = B）或 type（其他类型定义）
+	Kind string `json:"kind"`
+	// Type 非 struct、interface 类型的源码，如 map[string]int
+	Type string `json:"type,omitempty"`
+	// TypeParams 泛型类型的类型参数
+	TypeParams []ParamInfo `json:"type_params,omitempty"`
+	// Fields struct 的成员，interface 中嵌入的接口记为 Embedded 成员
+	Fields []FieldInfo `json:"fields,omitempty"`
+	// Methods interface 声明的方法，其他类型为文件中以该类型为接收者的方法
+	Methods []FuncInfo `json:"methods,omitempty"`
+	Doc     []string   `json:"doc,omitempty"`
+}
+
+// FieldInfo struct 成员，Tag 为去掉反引号后的标签
+type FieldInfo struct {
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type"`
+	Tag      string `json:"tag,omitempty"`
+	Embedded bool   `json:"embedded,omitempty"`
+}
+
+// ValueInfo 变量或常量，Type 及 Value 为源码，省略时为空
+//  var a, b = f() 这样多个变量共用一个值时，每个变量的 Value 均为 f()
+type ValueInfo struct {
+	Name  string `json:"name"`
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// FuncInfo 函数或方法，Recv 为 nil 时表示普通函数
+type FuncInfo struct {
+	Name    string      `json:"name"`
+	Recv    *ParamInfo  `json:"recv,omitempty"`
+	Params  []ParamInfo `json:"params,omitempty"`
+	Results []ParamInfo `json:"results,omitempty"`
+	Doc     []string    `json:"doc,omitempty"`
+}
+
+// ParamInfo 参数、返回值或接收者，匿名时 Name 为空
+type ParamInfo struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+}
+
+// LocalInfo 函数内的局部变量
+type LocalInfo struct {
+	Name string `json:"name"`
+	// Kind 为 param、result、var（var 声明）、define（:= 声明）或 range（for range 声明）
+	Kind  string `json:"kind"`
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// Inspect 返回文件的描述
+//
+// 测试数据：test_demo/inspect_demo.go
+//
+// 执行：info := Inspect(f)
+//
+// 结果为：info.Types[0] 为 {Name: "Stu", Kind: "struct", Fields: [{Name: "Name", Type: "string", Tag: `json:"name"`} ...], Methods: [...]}
+func Inspect(f *ast.File) *FileInfo {
+	info := &FileInfo{Package: f.Name.Name}
+	if fset, ok := fileSets.Load(f); ok {
+		info.File = fset.(*token.FileSet).Position(f.Package).Filename
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			info.Funcs = append(info.Funcs, funcInfo(d))
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ImportSpec:
+					info.Imports = append(info.Imports, importInfo(s))
+				case *ast.TypeSpec:
+					info.Types = append(info.Types, typeInfo(f, d, s))
+				case *ast.ValueSpec:
+					if d.Tok == token.CONST {
+						info.Consts = append(info.Consts, valueInfos(s)...)
+					} else {
+						info.Vars = append(info.Vars, valueInfos(s)...)
+					}
+				}
+			}
+		}
+	}
+	return info
+}
+
+// InspectVar 返回文件级别的变量，支持 var ( ... ) 中的变量
+//
+// 测试数据：var map1 = map[string]int{"hello": 1}
+//
+// 执行：InspectVar(f, "map1")
+//
+// 结果为：{Name: "map1", Value: `map[string]int{"hello": 1}`}, true
+func InspectVar(f *ast.File, name string) (ValueInfo, bool) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for _, v := range valueInfos(spec.(*ast.ValueSpec)) {
+				if v.Name == name {
+					return v, true
+				}
+			}
+		}
+	}
+	return ValueInfo{}, false
+}
+
+// InspectFunc 返回函数的描述，函数名称格式见 findFunc
+func InspectFunc(f *ast.File, funcName string) (FuncInfo, bool) {
+	_, fd := findFunc(f, funcName)
+	if fd == nil {
+		return FuncInfo{}, false
+	}
+	return funcInfo(fd), true
+}
+
+// FuncLocals 按声明顺序返回函数的参数、具名返回值及函数体内声明的局部变量，不包括函数字面量内的变量
+//
+// 测试数据：
+//
+// func Setup(a string) (err error) {
+//   stu := &Stu{}
+//   var n int
+// }
+//
+// 执行：FuncLocals(f, "Setup")
+//
+// 结果为：a（param）、err（result）、stu（define，Value 为 &Stu{}）、n（var，Type 为 int）
+func FuncLocals(f *ast.File, funcName string) ([]LocalInfo, bool) {
+	_, fd := findFunc(f, funcName)
+	if fd == nil {
+		return nil, false
+	}
+	locals := make([]LocalInfo, 0)
+	for _, p := range fieldInfos(fd.Type.Params) {
+		locals = append(locals, LocalInfo{Name: p.Name, Kind: "param", Type: p.Type})
+	}
+	for _, p := range fieldInfos(fd.Type.Results) {
+		if p.Name != "" {
+			locals = append(locals, LocalInfo{Name: p.Name, Kind: "result", Type: p.Type})
+		}
+	}
+	if fd.Body == nil {
+		return locals, true
+	}
+	ast.Inspect(fd.Body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeclStmt:
+			gen, ok := n.Decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				return false
+			}
+			for _, spec := range gen.Specs {
+				for _, v := range valueInfos(spec.(*ast.ValueSpec)) {
+					locals = append(locals, LocalInfo{Name: v.Name, Kind: "var", Type: v.Type, Value: v.Value})
+				}
+			}
+		case *ast.AssignStmt:
+			if n.Tok != token.DEFINE {
+				return true
+			}
+			for i, lhs := range n.Lhs {
+				id, ok := lhs.(*ast.Ident)
+				if !ok || id.Name == "_" {
+					continue
+				}
+				locals = append(locals, LocalInfo{Name: id.Name, Kind: "define", Value: sharedValue(n.Rhs, len(n.Lhs), i)})
+			}
+		case *ast.RangeStmt:
+			if n.Tok != token.DEFINE {
+				return true
+			}
+			for _, x := range []ast.Expr{n.Key, n.Value} {
+				if id, ok := x.(*ast.Ident); ok && id.Name != "_" {
+					locals = append(locals, LocalInfo{Name: id.Name, Kind: "range", Value: exprString(n.X)})
+				}
+			}
+		}
+		return true
+	})
+	return locals, true
+}
+
+func importInfo(s *ast.ImportSpec) ImportInfo {
+	info := ImportInfo{}
+	if s.Name != nil {
+		info.Name = s.Name.Name
+	}
+	info.Path, _ = strconv.Unquote(s.Path.Value)
+	return info
+}
+
+func typeInfo(f *ast.File, gen *ast.GenDecl, s *ast.TypeSpec) TypeInfo {
+	info := TypeInfo{Name: s.Name.Name, TypeParams: fieldInfos(s.TypeParams)}
+	doc := s.Doc
+	if doc == nil && len(gen.Specs) == 1 {
+		doc = gen.Doc
+	}
+	info.Doc = commentLines(doc)
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		info.Kind = "struct"
+		for _, field := range t.Fields.List {
+			info.Fields = append(info.Fields, structFieldInfos(field)...)
+		}
+	case *ast.InterfaceType:
+		info.Kind = "interface"
+		for _, field := range t.Methods.List {
+			ft, ok := field.Type.(*ast.FuncType)
+			if !ok {
+				info.Fields = append(info.Fields, FieldInfo{Type: exprString(field.Type), Embedded: true})
+				continue
+			}
+			for _, name := range field.Names {
+				info.Methods = append(info.Methods, FuncInfo{
+					Name:    name.Name,
+					Params:  fieldInfos(ft.Params),
+					Results: fieldInfos(ft.Results),
+					Doc:     commentLines(field.Doc),
+				})
+			}
+		}
+	default:
+		info.Kind = "type"
+		if s.Assign.IsValid() {
+			info.Kind = "alias"
+		}
+		info.Type = exprString(s.Type)
+	}
+	if info.Kind != "interface" {
+		for _, fd := range typeMethodList([]*ast.File{f}, s.Name.Name) {
+			info.Methods = append(info.Methods, funcInfo(fd))
+		}
+	}
+	return info
+}
+
+func structFieldInfos(field *ast.Field) []FieldInfo {
+	tag := ""
+	if field.Tag != nil {
+		tag = strings.Trim(field.Tag.Value, "`")
+		if t, err := strconv.Unquote(field.Tag.Value); err == nil {
+			tag = t
+		}
+	}
+	typ := exprString(field.Type)
+	if len(field.Names) == 0 {
+		return []FieldInfo{{Name: typeName(field.Type), Type: typ, Tag: tag, Embedded: true}}
+	}
+	infos := make([]FieldInfo, 0, len(field.Names))
+	for _, name := range field.Names {
+		infos = append(infos, FieldInfo{Name: name.Name, Type: typ, Tag: tag})
+	}
+	return infos
+}
+
+func funcInfo(fd *ast.FuncDecl) FuncInfo {
+	info := FuncInfo{
+		Name:    fd.Name.Name,
+		Params:  fieldInfos(fd.Type.Params),
+		Results: fieldInfos(fd.Type.Results),
+		Doc:     commentLines(fd.Doc),
+	}
+	if recv := fieldInfos(fd.Recv); len(recv) > 0 {
+		info.Recv = &recv[0]
+	}
+	return info
+}
+
+// fieldInfos 将参数列表展开为每个名称一项，a, b int 返回两项
+func fieldInfos(list *ast.FieldList) []ParamInfo {
+	if list == nil {
+		return nil
+	}
+	infos := make([]ParamInfo, 0, len(list.List))
+	for _, field := range list.List {
+		typ := exprString(field.Type)
+		if len(field.Names) == 0 {
+			infos = append(infos, ParamInfo{Type: typ})
+		}
+		for _, name := range field.Names {
+			infos = append(infos, ParamInfo{Name: name.Name, Type: typ})
+		}
+	}
+	return infos
+}
+
+func valueInfos(s *ast.ValueSpec) []ValueInfo {
+	typ := ""
+	if s.Type != nil {
+		typ = exprString(s.Type)
+	}
+	infos := make([]ValueInfo, 0, len(s.Names))
+	for i, name := range s.Names {
+		infos = append(infos, ValueInfo{Name: name.Name, Type: typ, Value: sharedValue(s.Values, len(s.Names), i)})
+	}
+	return infos
+}
+
+// sharedValue 返回第 i 个名称对应的值，a, b := f() 这样只有一个值时返回该值
+func sharedValue(values []ast.Expr, names, i int) string {
+	switch {
+	case len(values) == names:
+		return exprString(values[i])
+	case len(values) == 1:
+		return exprString(values[0])
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package ozastutil
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	_, f := InitEnv("./test_demo/inspect_demo.go")
+	info := Inspect(f)
+	assert.Equal(t, "./test_demo/inspect_demo.go", info.File)
+	assert.Equal(t, "test_demo", info.Package)
+	assert.Equal(t, []ImportInfo{{Path: "fmt"}, {Name: "str", Path: "strings"}}, info.Imports)
+
+	// struct 的成员及方法
+	stu := info.Types[0]
+	assert.Equal(t, "struct", stu.Kind)
+	assert.Equal(t, []string{"// Stu 学生"}, stu.Doc)
+	assert.Equal(t, []FieldInfo{
+		{Name: "Name", Type: "string", Tag: `json:"name"`},
+		{Name: "Age", Type: "int"},
+		{Name: "Base", Type: "*Base", Embedded: true},
+	}, stu.Fields)
+	assert.Equal(t, "Hello", stu.Methods[0].Name)
+	assert.Equal(t, &ParamInfo{Name: "s", Type: "*Stu"}, stu.Methods[0].Recv)
+
+	// interface 的方法及嵌入的接口
+	store := info.Types[2]
+	assert.Equal(t, "interface", store.Kind)
+	assert.Equal(t, []FieldInfo{{Type: "fmt.Stringer", Embedded: true}}, store.Fields)
+	assert.Equal(t, []FuncInfo{{
+		Name:    "Get",
+		Params:  []ParamInfo{{Name: "id", Type: "int"}},
+		Results: []ParamInfo{{Type: "*Stu"}, {Type: "error"}},
+		Doc:     []string{"// Get 获取学生"},
+	}}, store.Methods)
+	assert.Equal(t, TypeInfo{Name: "Names", Kind: "alias", Type: "[]string"}, info.Types[3])
+	assert.Equal(t, TypeInfo{Name: "Scores", Kind: "type", Type: "map[string]int"}, info.Types[4])
+
+	assert.Equal(t, []ValueInfo{{Name: "A", Value: "iota"}, {Name: "B"}}, info.Consts)
+	assert.Equal(t, []ValueInfo{
+		{Name: "a", Value: "pair()"},
+		{Name: "b", Value: "pair()"},
+		{Name: "stuName", Value: `str.ToUpper("stu")`},
+		{Name: "scores", Type: "Scores"},
+	}, info.Vars)
+	assert.Equal(t, 3, len(info.Funcs))
+	assert.Equal(t, []ParamInfo{{Name: "a", Type: "string"}, {Name: "b", Type: "int"}, {Name: "c", Type: "int"}}, info.Funcs[2].Params)
+
+	data, err := json.Marshal(info.Types[4])
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"Scores","kind":"type","type":"map[string]int"}`, string(data))
+}
+
+func TestInspectVar(t *testing.T) {
+	_, f := InitEnv("./test_demo/var_demo.go")
+	v, ok := InspectVar(f, "map1")
+	assert.True(t, ok)
+	assert.Equal(t, ValueInfo{Name: "map1", Value: `map[string]int{"hello": 1}`}, v)
+
+	// var ( ... ) 中的变量
+	v, ok = InspectVar(f, "bb")
+	assert.True(t, ok)
+	assert.Equal(t, "2", v.Value)
+
+	_, ok = InspectVar(f, "notfound")
+	assert.False(t, ok)
+}
+
+func TestFuncLocals(t *testing.T) {
+	_, f := InitEnv("./test_demo/inspect_demo.go")
+	locals, ok := FuncLocals(f, "Setup")
+	assert.True(t, ok)
+	assert.Equal(t, []LocalInfo{
+		{Name: "a", Kind: "param", Type: "string"},
+		{Name: "b", Kind: "param", Type: "int"},
+		{Name: "c", Kind: "param", Type: "int"},
+		{Name: "err", Kind: "result", Type: "error"},
+		{Name: "stu", Kind: "define", Value: "&Stu{}"},
+		{Name: "n", Kind: "var", Type: "int"},
+		{Name: "i", Kind: "range", Value: "[]int{1}"},
+		{Name: "v", Kind: "range", Value: "[]int{1}"},
+		{Name: "fn", Kind: "define", Value: "func() {\n\tinner := 1\n\tfmt.Println(inner)\n}"},
+	}, locals)
+
+	fn, ok := InspectFunc(f, "Stu.Hello")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"// Hello 打招呼"}, fn.Doc)
+
+	_, ok = FuncLocals(f, "notfound")
+	assert.False(t, ok)
+}
@@ -0,0 +1,640 @@
+package ozastutil
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// AstImplOption 生成接口实现的选项
+type AstImplOption struct {
+	// RecvName 接收者名称，为空时沿用类型第一个已有方法的接收者名称，没有方法时使用类型名称首字母的小写；
+	//  与方法的参数或返回值同名时在名称后添加下划线
+	RecvName string
+	// ZeroReturn 为 true 时方法返回零值，否则方法体为 panic("not implemented")
+	ZeroReturn bool
+	// Assert 为 true 时添加 var _ TestInf = (*Stu)(nil) 形式的编译期检查
+	Assert bool
+}
+
+// ImplementInterface 为类型 recv 补全接口 infName 中缺少的方法
+//
+// files 为查找接口及类型已有方法的文件，新方法添加到 f 中类型最后一个方法之后，f 可以不在 files 中。
+// 接口中嵌入的本包接口及 error 会一并展开，其他包的接口无法展开时返回 false。
+// 方法签名中引用的其他包按接口所在文件的 import 添加到 f 中；类型已有同名但签名不同的方法时返回 false。
+// 所有方法检查通过后才修改文件，返回 false 时 f 不变
+//
+// 测试数据：
+//
+// type TestInf interface {
+//	Demo(a string) error
+//	Tests(a ...string) error
+// }
+//
+// 执行：ImplementInterface(files, f, "TestInf", "*Stu", &AstImplOption{ZeroReturn: true, Assert: true})
+//
+// 结果为：
+//
+// var _ TestInf = (*Stu)(nil)
+//
+// func (s *Stu) Demo(a string) error {
+//	return nil
+// }
+//
+// func (s *Stu) Tests(a ...string) error {
+//	return nil
+// }
+func ImplementInterface(files []*ast.File, f *ast.File, infName, recv string, opt *AstImplOption) bool {
+	if opt == nil {
+		opt = &AstImplOption{}
+	}
+	files = appendFile(files, f)
+	_, spec := findTypeSpecIn(files, infName)
+	if spec == nil {
+		return false
+	}
+	inf, ok := spec.Type.(*ast.InterfaceType)
+	if !ok {
+		return false
+	}
+	methods, ok := interfaceMethods(files, inf, map[string]bool{infName: true})
+	if !ok {
+		return false
+	}
+	recvExpr, err := parser.ParseExpr(recv)
+	if err != nil {
+		return false
+	}
+	recvType := typeName(recvExpr)
+	if recvType == "" {
+		return false
+	}
+	exist := typeMethods(files, recvType)
+	recvName := opt.RecvName
+	if recvName == "" {
+		recvName = recvNameOf(typeMethodList(files, recvType), recvType)
+	}
+
+	// 先检查所有方法并生成桩代码，全部可以添加时才修改文件
+	infFile, _ := findTypeSpecIn(files, infName)
+	stubs := make([]*AstFunc, 0)
+	imports := make(map[string]*ast.ImportSpec)
+	for _, method := range methods {
+		name := method.Names[0].Name
+		ft := method.Type.(*ast.FuncType)
+		if fd, ok := exist[name]; ok {
+			// 同名方法的签名不同时无法实现该接口
+			if !sameSignature(fd.Type, ft) {
+				return false
+			}
+			continue
+		}
+		if !stubImports([]*ast.File{infFile}, files, ft, imports) {
+			return false
+		}
+		// 接收者名称与参数或返回值同名时无法编译，改用不冲突的名称
+		used := make(map[string]bool)
+		for _, fields := range []*ast.FieldList{ft.Params, ft.Results} {
+			for _, field := range flattenFields(fields) {
+				for _, id := range field.Names {
+					used[id.Name] = true
+				}
+			}
+		}
+		params := &AstFunc{
+			Name:    name,
+			Recv:    &AstKv{Key: freeName(recvName, used), Value: recv},
+			Params:  fieldsToKv(ft.Params),
+			Results: fieldsToKv(ft.Results),
+			Doc:     commentLines(method.Doc),
+		}
+		_, named := fieldNames(ft.Results)
+		switch {
+		case !opt.ZeroReturn:
+			params.Body = `panic("not implemented")`
+		case len(params.Results) == 0:
+		case named:
+			params.Return = []string{}
+		default:
+			for _, field := range flattenFields(ft.Results) {
+				params.Return = append(params.Return, zeroValue(files, field.Type))
+			}
+		}
+		if _, err := getFuncDecl(params); err != nil {
+			return false
+		}
+		stubs = append(stubs, params)
+		exist[name] = nil
+	}
+	if skipApplied(f, len(stubs) == 0 && (!opt.Assert || hasImplAssert(f, infName, implAssertValue(files, recv, recvType)))) {
+		return true
+	}
+	if len(stubs) > 0 && getInsertIndex(f, &AstInsertPos{AfterMethods: true}, recvType, stubs[0].Name) == -1 {
+		return false
+	}
+
+	fset, _ := fileSets.Load(f)
+	fs, _ := fset.(*token.FileSet)
+	for _, imp := range imports {
+		if name, impPath := importName(imp), importPath(imp); !hasImportSpec(f, name, impPath) {
+			AddImport(fs, f, name, impPath)
+		}
+	}
+	for _, params := range stubs {
+		if !AddFuncAt(f, params, &AstInsertPos{AfterMethods: true}) {
+			return false
+		}
+	}
+	if opt.Assert {
+		addImplAssert(files, f, infName, recv, recvType)
+	}
+	return true
+}
+
+// sameSignature 判断两个方法的参数及返回值类型是否相同，不比较名称
+func sameSignature(a, b *ast.FuncType) bool {
+	types := func(ft *ast.FuncType) string {
+		var list []string
+		for _, fields := range []*ast.FieldList{ft.Params, ft.Results} {
+			for _, field := range flattenFields(fields) {
+				list = append(list, exprString(field.Type))
+			}
+			list = append(list, ";")
+		}
+		return strings.Join(list, ",")
+	}
+	return types(a) == types(b)
+}
+
+// stubImports 查找方法签名中引用的其他包对应的 import，依次在 first 及 files 中查找，结果按包名保存到 imports
+//  找不到对应的 import 时返回 false
+func stubImports(first, files []*ast.File, ft *ast.FuncType, imports map[string]*ast.ImportSpec) bool {
+	ok := true
+	ast.Inspect(ft, func(n ast.Node) bool {
+		sel, isSel := n.(*ast.SelectorExpr)
+		if !isSel {
+			return ok
+		}
+		pkg, isIdent := sel.X.(*ast.Ident)
+		if !isIdent {
+			return ok
+		}
+		if _, found := imports[pkg.Name]; !found {
+			imp := findImport(append(first, files...), pkg.Name)
+			if imp == nil {
+				ok = false
+				return false
+			}
+			imports[pkg.Name] = imp
+		}
+		return false
+	})
+	return ok
+}
+
+// findImport 返回文件中包名为 name 的 import
+func findImport(files []*ast.File, name string) *ast.ImportSpec {
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		for _, imp := range f.Imports {
+			pkg := importName(imp)
+			if pkg == "" {
+				pkg = path.Base(importPath(imp))
+			}
+			if pkg == name {
+				return imp
+			}
+		}
+	}
+	return nil
+}
+
+// AstExtractOption 提取接口的选项
+type AstExtractOption struct {
+	// Include 只提取这些方法，为空时提取所有导出方法
+	Include []string
+	// Exclude 不提取这些方法
+	Exclude []string
+	// Unexported 为 true 时同时提取未导出的方法
+	Unexported bool
+	// Prune 为 true 时删除已有接口中类型不存在的方法
+	Prune bool
+}
+
+// ExtractInterface 根据类型 recv 的方法生成接口 infName，接收者为 Stu 及 *Stu 的方法都会提取，方法的文档注释一并复制
+//
+// files 为查找类型方法及已有接口的文件。接口已存在时更新同名方法的签名并追加缺少的方法，
+// 不存在时在 f 中类型声明之后新建，f 中没有类型声明时添加到文件末尾。泛型类型返回 false
+//
+// 测试数据：
+//
+// type Stu struct {
+// }
+//
+// // TT 返回名称
+// func (s *Stu) TT() string {
+//	return "TT"
+// }
+//
+// func (s Stu) StuFunc(a string) (ret string) {
+//	return a
+// }
+//
+// 执行：ExtractInterface(files, f, "Stu", "StuService", &AstExtractOption{Exclude: []string{"StuFunc"}})
+//
+// 结果为：
+//
+// type Stu struct {
+// }
+//
+// type StuService interface {
+//	// TT 返回名称
+//	TT() string
+// }
+func ExtractInterface(files []*ast.File, f *ast.File, recv, infName string, opt *AstExtractOption) bool {
+	if recv == "" || infName == "" {
+		return false
+	}
+	if opt == nil {
+		opt = &AstExtractOption{}
+	}
+	files = appendFile(files, f)
+	if _, spec := findTypeSpecIn(files, recv); spec != nil && spec.TypeParams != nil {
+		return false
+	}
+	methods := make([]*ast.FuncDecl, 0)
+	for _, fd := range typeMethodList(files, recv) {
+		if extractMethod(fd.Name.Name, opt) {
+			methods = append(methods, fd)
+		}
+	}
+
+	g, spec := findTypeSpecIn(files, infName)
+	if spec == nil {
+		src := "type " + infName + " interface {\n" + methodsSource(nil, methods, opt.Prune) + "}\n"
+		decls, err := parseDecls(src)
+		if err != nil {
+			return false
+		}
+		index := getInsertIndex(f, &AstInsertPos{After: recv}, "", "")
+		if index == -1 {
+			index = len(f.Decls)
+		}
+		insertDecls(f, index-1, decls[0])
+		return true
+	}
+	inf, ok := spec.Type.(*ast.InterfaceType)
+	if !ok || spec.TypeParams != nil {
+		return false
+	}
+	index, gen := findGenDecl(g, spec)
+	doc := spec.Doc
+	if len(gen.Specs) == 1 && gen.Doc != nil {
+		doc = gen.Doc
+	}
+	src := ""
+	for _, line := range commentLines(doc) {
+		src += line + "\n"
+	}
+	src += "type " + infName + " interface {\n" + methodsSource(inf.Methods.List, methods, opt.Prune) + "}\n"
+	decls, err := parseDecls(src)
+	if err != nil {
+		return false
+	}
+	if len(gen.Specs) > 1 {
+		// 分组声明中只移除该接口，新接口紧跟在分组之后
+		from := spec.Pos()
+		if spec.Doc != nil {
+			from = spec.Doc.Pos()
+		}
+		if !isNewDecl(gen) {
+			removeCommentsIn(g, from, spec.End())
+		}
+		for i, s := range gen.Specs {
+			if s == spec {
+				gen.Specs = append(gen.Specs[:i], gen.Specs[i+1:]...)
+				break
+			}
+		}
+		insertDecls(g, index, decls[0])
+		return true
+	}
+	removeComments(g, gen)
+	replaceDecl(g, index, decls[0])
+	return true
+}
+
+// extractMethod 判断方法是否需要提取
+func extractMethod(name string, opt *AstExtractOption) bool {
+	for _, exclude := range opt.Exclude {
+		if exclude == name {
+			return false
+		}
+	}
+	if len(opt.Include) > 0 {
+		for _, include := range opt.Include {
+			if include == name {
+				return true
+			}
+		}
+		return false
+	}
+	return opt.Unexported || ast.IsExported(name)
+}
+
+// methodsSource 生成接口内的方法列表源码，先按原顺序输出已有的成员，再追加新的方法
+//  已有的同名方法使用新的签名，新方法没有文档注释时保留原注释
+func methodsSource(fields []*ast.Field, methods []*ast.FuncDecl, prune bool) string {
+	added := make(map[string]*ast.FuncDecl, len(methods))
+	for _, fd := range methods {
+		added[fd.Name.Name] = fd
+	}
+	var buf strings.Builder
+	writeMethod := func(doc *ast.CommentGroup, name string, ft *ast.FuncType) {
+		for _, line := range commentLines(doc) {
+			buf.WriteString("\t" + line + "\n")
+		}
+		buf.WriteString("\t" + name + strings.TrimPrefix(exprString(ft), "func") + "\n")
+	}
+	for _, field := range fields {
+		if len(field.Names) == 0 {
+			for _, line := range commentLines(field.Doc) {
+				buf.WriteString("\t" + line + "\n")
+			}
+			buf.WriteString("\t" + exprString(field.Type) + "\n")
+			continue
+		}
+		name := field.Names[0].Name
+		fd, ok := added[name]
+		switch {
+		case ok:
+			doc := fd.Doc
+			if doc == nil {
+				doc = field.Doc
+			}
+			writeMethod(doc, name, fd.Type)
+			delete(added, name)
+		case !prune:
+			writeMethod(field.Doc, name, field.Type.(*ast.FuncType))
+		}
+	}
+	for _, fd := range methods {
+		if _, ok := added[fd.Name.Name]; ok {
+			writeMethod(fd.Doc, fd.Name.Name, fd.Type)
+		}
+	}
+	return buf.String()
+}
+
+// findGenDecl 返回 spec 所在的声明及其下标
+func findGenDecl(f *ast.File, spec ast.Spec) (int, *ast.GenDecl) {
+	for i, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, s := range gen.Specs {
+			if s == spec {
+				return i, gen
+			}
+		}
+	}
+	return -1, nil
+}
+
+// interfaceMethods 返回接口的所有方法，包括嵌入的本包接口及 error 的方法，无法展开的嵌入接口返回 false
+//  seen 记录已经展开的接口，避免循环嵌入
+func interfaceMethods(files []*ast.File, inf *ast.InterfaceType, seen map[string]bool) ([]*ast.Field, bool) {
+	methods := make([]*ast.Field, 0)
+	for _, field := range inf.Methods.List {
+		if len(field.Names) > 0 {
+			if _, ok := field.Type.(*ast.FuncType); ok {
+				methods = append(methods, field)
+			}
+			continue
+		}
+		embed, ok := field.Type.(*ast.Ident)
+		if !ok {
+			// 其他包的接口无法展开，类型约束中的联合类型不影响方法集
+			if _, ok := field.Type.(*ast.SelectorExpr); ok {
+				return nil, false
+			}
+			continue
+		}
+		if seen[embed.Name] {
+			continue
+		}
+		seen[embed.Name] = true
+		if embed.Name == "error" {
+			methods = append(methods, &ast.Field{
+				Names: []*ast.Ident{ast.NewIdent("Error")},
+				Type: &ast.FuncType{
+					Params:  &ast.FieldList{},
+					Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("string")}}},
+				},
+			})
+			continue
+		}
+		_, spec := findTypeSpecIn(files, embed.Name)
+		if spec == nil {
+			return nil, false
+		}
+		embedInf, ok := spec.Type.(*ast.InterfaceType)
+		if !ok {
+			continue
+		}
+		embedMethods, ok := interfaceMethods(files, embedInf, seen)
+		if !ok {
+			return nil, false
+		}
+		methods = append(methods, embedMethods...)
+	}
+	return methods, true
+}
+
+// typeMethods 返回类型在多个文件中声明的方法，包括值接收者及指针接收者的方法
+func typeMethods(files []*ast.File, recv string) map[string]*ast.FuncDecl {
+	methods := make(map[string]*ast.FuncDecl)
+	for _, fd := range typeMethodList(files, recv) {
+		methods[fd.Name.Name] = fd
+	}
+	return methods
+}
+
+// typeMethodList 按声明顺序返回类型在多个文件中声明的方法
+func typeMethodList(files []*ast.File, recv string) []*ast.FuncDecl {
+	methods := make([]*ast.FuncDecl, 0)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if fdRecv, _ := funcRecv(fd); fdRecv == recv {
+				methods = append(methods, fd)
+			}
+		}
+	}
+	return methods
+}
+
+// recvNameOf 返回第一个已有方法（按声明顺序）的接收者名称，没有方法时返回类型名称首字母的小写
+func recvNameOf(methods []*ast.FuncDecl, recv string) string {
+	for _, fd := range methods {
+		if len(fd.Recv.List[0].Names) > 0 && fd.Recv.List[0].Names[0].Name != "_" {
+			return fd.Recv.List[0].Names[0].Name
+		}
+	}
+	for _, r := range recv {
+		return string(unicode.ToLower(r))
+	}
+	return "r"
+}
+
+// freeName 返回不在 used 中的名称，冲突时在名称后添加下划线
+func freeName(name string, used map[string]bool) string {
+	for used[name] {
+		name += "_"
+	}
+	return name
+}
+
+// fieldsToKv 将参数列表转换为 AstKv
+func fieldsToKv(list *ast.FieldList) []AstKv {
+	if list == nil {
+		return nil
+	}
+	kvs := make([]AstKv, 0, len(list.List))
+	for _, field := range list.List {
+		names := make([]string, 0, len(field.Names))
+		for _, id := range field.Names {
+			names = append(names, id.Name)
+		}
+		kvs = append(kvs, AstKv{Key: strings.Join(names, ", "), Value: exprString(field.Type)})
+	}
+	return kvs
+}
+
+// commentLines 返回注释的每一行
+func commentLines(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	lines := make([]string, 0, len(doc.List))
+	for _, c := range doc.List {
+		lines = append(lines, c.Text)
+	}
+	return lines
+}
+
+// zeroValue 返回类型的零值表达式，无法推断时返回 *new(T)
+func zeroValue(files []*ast.File, typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "bool":
+			return "false"
+		case "string":
+			return `""`
+		case "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+			"float32", "float64", "complex64", "complex128", "byte", "rune":
+			return "0"
+		case "error", "any":
+			return "nil"
+		}
+		if _, spec := findTypeSpecIn(files, t.Name); spec != nil && spec.TypeParams == nil {
+			switch spec.Type.(type) {
+			case *ast.StructType, *ast.ArrayType:
+				if arr, ok := spec.Type.(*ast.ArrayType); ok && arr.Len == nil {
+					return "nil"
+				}
+				return t.Name + "{}"
+			case *ast.Ident:
+				// type MyInt int 的零值为 0
+				if zero := zeroValue(files, spec.Type); !strings.HasPrefix(zero, "*new(") && !strings.HasSuffix(zero, "{}") {
+					return zero
+				}
+			default:
+				return "nil"
+			}
+		}
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return "nil"
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "nil"
+		}
+		return exprString(t) + "{}"
+	case *ast.StructType:
+		return exprString(t) + "{}"
+	}
+	return "*new(" + exprString(typ) + ")"
+}
+
+// addImplAssert 添加 var _ TestInf = (*Stu)(nil) 形式的编译期检查，已存在时不重复添加
+func addImplAssert(files []*ast.File, f *ast.File, infName, recv, recvType string) {
+	value := implAssertValue(files, recv, recvType)
+	if hasImplAssert(f, infName, value) {
+		return
+	}
+	assert := &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{&ast.ValueSpec{
+			Names:  []*ast.Ident{ast.NewIdent("_")},
+			Type:   ast.NewIdent(infName),
+			Values: []ast.Expr{&ast.BasicLit{Value: value}},
+		}},
+	}
+	index := getInsertIndex(f, &AstInsertPos{After: recvType}, "", "")
+	if index == -1 {
+		index = len(f.Decls)
+	}
+	insertDecls(f, index-1, assert)
+}
+
+// implAssertValue 返回断言中 recv 类型的值
+func implAssertValue(files []*ast.File, recv, recvType string) string {
+	if strings.HasPrefix(recv, "*") {
+		return "(*" + recvType + ")(nil)"
+	}
+	if _, spec := findTypeSpecIn(files, recvType); spec != nil {
+		if _, ok := spec.Type.(*ast.StructType); ok {
+			return recv + "{}"
+		}
+	}
+	return "*new(" + recv + ")"
+}
+
+// hasImplAssert 判断文件中是否已有 var _ Inf = value 形式的断言
+func hasImplAssert(f *ast.File, infName, value string) bool {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if len(vs.Names) == 1 && vs.Names[0].Name == "_" && vs.Type != nil && typeName(vs.Type) == infName &&
+				len(vs.Values) == 1 && exprString(vs.Values[0]) == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appendFile 将 f 加入 files，已存在时不重复加入
+func appendFile(files []*ast.File, f *ast.File) []*ast.File {
+	for _, file := range files {
+		if file == f {
+			return files
+		}
+	}
+	return append(files[:len(files):len(files)], f)
+}
@@ -0,0 +1,126 @@
+package ozastutil
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestImplementInterface(t *testing.T) {
+	fst, files := InitEnvs("./test_demo/type_demo.go", "./test_demo/func_demo.go")
+
+	ret := ImplementInterface(files, files[1], "TestInf", "*Stu", &AstImplOption{Assert: true})
+	assert.True(t, ret)
+
+	// 已实现的方法及编译期检查不重复添加
+	ret = ImplementInterface(files, files[1], "TestInf", "*Stu", &AstImplOption{Assert: true})
+	assert.True(t, ret)
+
+	ret = ImplementInterface(files, files[1], "NotFound", "*Stu", nil)
+	assert.False(t, ret)
+
+	// 不是接口
+	ret = ImplementInterface(files, files[1], "TypeStruct", "*Stu", nil)
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, files[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "type Stu struct {\n}\n\nvar _ TestInf = (*Stu)(nil)\n")
+	assert.Contains(t, string(src), "func (s *Stu) Demo(a string) error {\n\tpanic(\"not implemented\")\n}")
+	assert.Contains(t, string(src), "func (s Stu) StuFunc(a string) (ret string) {\n\tvar b = a\n\tret = b\n\treturn ret\n}\n\nfunc (s *Stu) Demo")
+	PrintResult(fst, files[1])
+}
+
+func TestImplementInterfaceZeroReturn(t *testing.T) {
+	fst, f := InitEnv("./test_demo/interface_demo.go")
+
+	ret := ImplementInterface(nil, f, "Service", "Impl", &AstImplOption{ZeroReturn: true, RecvName: "impl", Assert: true})
+	assert.True(t, ret)
+
+	// 其他包的接口无法展开
+	ret = ImplementInterface(nil, f, "External", "Impl", nil)
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	// 已有的 ID 方法不重复添加
+	assert.NotContains(t, string(src), "func (impl Impl) ID")
+	assert.Contains(t, string(src), "var _ Service = Impl{}")
+	assert.Contains(t, string(src), "func (impl Impl) Error() string {\n\treturn \"\"\n}")
+	assert.Contains(t, string(src), "func (impl Impl) Get(id int) (*Impl, error) {\n\treturn nil, nil\n}")
+	assert.Contains(t, string(src), "func (impl Impl) Names() []string {\n\treturn nil\n}")
+	assert.Contains(t, string(src), "func (impl Impl) Count() (n int) {\n\treturn\n}")
+	assert.Contains(t, string(src), "func (impl Impl) Save(Impl, map[string]int, ...string) (Impl, bool, Kind) {\n\treturn Impl{}, false, 0\n}")
+	assert.Contains(t, string(src), "func (impl Impl) Close() {\n}")
+	PrintResult(fst, f)
+}
+
+func TestImplementInterfaceImports(t *testing.T) {
+	fst, files := InitEnvs("./test_demo/interface_demo.go", "./test_demo/interface_impl_demo.go")
+	f := files[1]
+
+	// 已有的 Ping 方法签名不同，检查失败时不添加任何方法
+	before, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	ret := ImplementInterface(files, f, "Pinger", "*Worker", nil)
+	assert.False(t, ret)
+	after, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	// 签名中引用的其他包同时添加 import
+	ret = ImplementInterface(files, f, "Runner", "*Worker", nil)
+	assert.True(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "package test_demo\n\nimport \"context\"\n")
+	assert.Contains(t, string(src), "func (w *Worker) Run(ctx context.Context) error {\n\tpanic(\"not implemented\")\n}")
+	PrintResult(fst, f)
+}
+
+func TestExtractInterface(t *testing.T) {
+	fst := token.NewFileSet()
+	f, err := parser.ParseFile(fst, "./test_demo/extract_demo.go", nil, parser.ParseComments)
+	assert.NoError(t, err)
+	more, err := parser.ParseFile(fst, "./test_demo/extract_more_demo.go", nil, parser.ParseComments)
+	assert.NoError(t, err)
+	files := []*ast.File{f, more}
+
+	// 新建接口
+	ret := ExtractInterface(files, f, "Animal", "Runner", &AstExtractOption{Include: []string{"Run", "Eat", "rest"}, Exclude: []string{"Eat"}})
+	assert.True(t, ret)
+	// 更新已有接口
+	ret = ExtractInterface(files, f, "Animal", "AnimalService", &AstExtractOption{Exclude: []string{"Close"}})
+	assert.True(t, ret)
+	// 更新分组声明中的接口
+	ret = ExtractInterface(files, f, "Animal", "Grouped", &AstExtractOption{Unexported: true, Prune: true})
+	assert.True(t, ret)
+	// 不是接口
+	ret = ExtractInterface(files, f, "Animal", "Other", nil)
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "type Animal struct {\n\tname string\n}\n\ntype Runner interface {\n\t// Run 奔跑\n\tRun(ctx context.Context, speed int) (err error)\n\trest()\n}\n")
+	assert.Contains(t, string(src), "// AnimalService 动物服务\ntype AnimalService interface {\n\t// Name 返回名称\n\tName() string\n\t// Stale 类型中已不存在的方法\n\tStale()\n\t// Run 奔跑\n\tRun(ctx context.Context, speed int) (err error)\n\t// Eat 进食\n\tEat(food ...string) bool\n}\n")
+	assert.NotContains(t, string(src), "旧的注释")
+	assert.Contains(t, string(src), "type (\n\tOther int\n)\n")
+	assert.Contains(t, string(src), "type Grouped interface {\n\tClose() error\n\t// Name 返回名称\n\tName() string\n\t// Run 奔跑\n\tRun(ctx context.Context, speed int) (err error)\n\trest()\n\t// Eat 进食\n\tEat(food ...string) bool\n}")
+	PrintResult(fst, f)
+}
+
+func TestImplementInterfaceRecvName(t *testing.T) {
+	fst, f := InitEnv("./test_demo/interface_recv_demo.go")
+
+	// 使用第一个方法的接收者名称，与参数同名时添加下划线
+	ret := ImplementInterface(nil, f, "Saver", "*Store", nil)
+	assert.True(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "func (s_ *Store) Save(s string, store int) error {\n\tpanic(\"not implemented\")\n}")
+	PrintResult(fst, f)
+}
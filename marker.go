@@ -0,0 +1,311 @@
+package ozastutil
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// 标记注释
+//
+// 模板中可以用 // astutil:routes、// astutil:insert models 这样的注释标记代码的插入位置。
+// 插入类 API 的锚点参数以 // 开头时视为标记注释，新代码插入到标记之前，标记保留在原处，
+// 多次插入时按插入顺序排列在标记之前。文件需要使用 parser.ParseComments 解析。
+//
+// 声明内部的标记无法只靠节点的位置信息让 printer 把新代码排在标记之前，
+// 因此先输出所在声明的源码，在标记所在行之前插入新代码的源码，再重新解析替换原声明。
+
+// isMarker 判断锚点是否为标记注释
+func isMarker(anchor string) bool {
+	return strings.HasPrefix(strings.TrimSpace(anchor), "//")
+}
+
+// markerText 返回注释去掉 // 后的内容
+func markerText(text string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "//"))
+}
+
+// getMarker 返回可选参数中的标记注释，没有时返回空
+func getMarker(marker []string) string {
+	if len(marker) > 0 && isMarker(marker[0]) {
+		return marker[0]
+	}
+	return ""
+}
+
+// findMarker 返回注释列表中位于 from 与 to 之间第一个内容为 marker 的注释
+func findMarker(comments []*ast.CommentGroup, from, to token.Pos, marker string) *ast.Comment {
+	text := markerText(marker)
+	for _, cg := range comments {
+		if cg.End() <= from || cg.Pos() >= to {
+			continue
+		}
+		for _, c := range cg.List {
+			if c.Pos() > from && c.End() < to && markerText(c.Text) == text {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// markerIndex 返回在 pos 处的标记之前插入时的下标，即第一个位于标记之后的节点的下标。
+// 没有位置信息的新节点跳过，多次插入时新节点依次排在标记之前
+func markerIndex(pos token.Pos, n int, nodePos func(i int) token.Pos) int {
+	for i := 0; i < n; i++ {
+		if p := nodePos(i); p.IsValid() && p > pos {
+			return i
+		}
+	}
+	return n
+}
+
+// findDeclMarker 查找文件级别的标记注释，返回在标记之前插入声明的下标，没有找到时返回 -1
+func findDeclMarker(f *ast.File, marker string) (int, *ast.Comment) {
+	text := markerText(marker)
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if markerText(c.Text) != text || isInDecl(f, c.Pos()) {
+				continue
+			}
+			index := markerIndex(c.Pos(), len(f.Decls), func(i int) token.Pos {
+				if isNewDecl(f.Decls[i]) {
+					return token.NoPos
+				}
+				from, _ := declRange(f.Decls[i])
+				return from
+			})
+			return index, c
+		}
+	}
+	return -1, nil
+}
+
+// isInDecl 判断位置是否在文件原有的某个声明内部，不包括声明的文档注释
+func isInDecl(f *ast.File, pos token.Pos) bool {
+	for _, decl := range f.Decls {
+		if !isNewDecl(decl) && decl.Pos() <= pos && pos < decl.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// insertDeclAtMarker 在文件级别的标记注释之前插入声明
+func insertDeclAtMarker(f *ast.File, marker string, decl ast.Decl) bool {
+	index, c := findDeclMarker(f, marker)
+	if index == -1 {
+		return false
+	}
+	setDeclHint(decl, c.Pos())
+	insertDecls(f, index-1, decl)
+	return true
+}
+
+// insertFieldAtMarker 在 struct 或 interface 内的标记注释之前插入成员，marker 为空时添加到末尾
+func insertFieldAtMarker(f *ast.File, typ ast.Expr, list *ast.FieldList, marker string, field *ast.Field) bool {
+	if marker == "" {
+		return insertNode(f, list, len(list.List), fieldSource(typ, field))
+	}
+	return insertSourceAtMarker(f, typ, list.Opening, list.Closing, marker, fieldSource(typ, field))
+}
+
+// fieldSource 输出 struct 成员或 interface 方法的源码
+func fieldSource(typ ast.Expr, field *ast.Field) string {
+	var names []string
+	for _, name := range field.Names {
+		names = append(names, name.Name)
+	}
+	src := exprString(field.Type)
+	switch {
+	case len(names) == 0:
+	case isInterface(typ):
+		src = names[0] + strings.TrimPrefix(src, "func")
+	default:
+		src = strings.Join(names, ", ") + " " + src
+	}
+	if field.Tag != nil {
+		src += " " + field.Tag.Value
+	}
+	return src
+}
+
+// isInterface 判断类型表达式是否为 interface
+func isInterface(typ ast.Expr) bool {
+	_, ok := typ.(*ast.InterfaceType)
+	return ok
+}
+
+// insertExprAtMarker 在 { } 或 ( ) 之间的标记注释之前插入表达式，marker 为空时添加到末尾
+func insertExprAtMarker(f *ast.File, node ast.Node, list *[]ast.Expr, from, to token.Pos, marker string, expr ast.Expr) bool {
+	if marker == "" {
+		return insertNode(f, node, len(*list), exprString(expr))
+	}
+	return insertSourceAtMarker(f, node, from, to, marker, exprString(expr)+",")
+}
+
+// insertStmtAtMarker 在函数体内的标记注释之前插入语句，标记可以位于嵌套的代码块或 case 中
+func insertStmtAtMarker(f *ast.File, body *ast.BlockStmt, marker string, stmts ...ast.Stmt) bool {
+	return insertSourceAtMarker(f, body, body.Lbrace, body.Rbrace, marker, stmtSource(stmts...))
+}
+
+// stmtSource 输出语句的源码，每条语句占一行
+func stmtSource(stmts ...ast.Stmt) string {
+	var lines []string
+	for _, stmt := range stmts {
+		lines = append(lines, exprString(stmt))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// insertSourceAtMarker 在 node 所属声明中位于 from 与 to 之间的标记注释之前插入源码
+func insertSourceAtMarker(f *ast.File, node ast.Node, from, to token.Pos, marker, src string) bool {
+	index := ownerDecl(f, node)
+	if index == -1 {
+		return false
+	}
+	c := findMarker(declComments(f, f.Decls[index]), from, to, marker)
+	if c == nil {
+		return false
+	}
+	return spliceAtMarker(f, index, c, src)
+}
+
+// ownerDecl 返回包含节点的声明的下标，没有找到时返回 -1
+func ownerDecl(f *ast.File, node ast.Node) int {
+	for i, decl := range f.Decls {
+		found := false
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if n == node {
+				found = true
+			}
+			return !found
+		})
+		if found {
+			return i
+		}
+	}
+	return -1
+}
+
+// declComments 返回声明范围内的注释，由源码片段解析的声明使用片段自己的注释
+func declComments(f *ast.File, decl ast.Decl) []*ast.CommentGroup {
+	comments := f.Comments
+	if s, ok := snippets.Load(decl); ok {
+		// 与 declSource 一致，源码片段中的注释全部属于该声明
+		return s.(*snippet).comments
+	} else if isNewDecl(decl) {
+		return nil
+	}
+	from, to := declRange(decl)
+	var list []*ast.CommentGroup
+	for _, cg := range comments {
+		if cg.Pos() >= from && cg.End() <= to {
+			list = append(list, cg)
+		}
+	}
+	return list
+}
+
+// spliceAtMarker 输出第 index 个声明的源码，在标记注释 c 所在行之前插入 src，重新解析后替换原声明
+//  标记与其他代码在同一行时，src 插入到标记之前并单独成行
+func spliceAtMarker(f *ast.File, index int, c *ast.Comment, src string) bool {
+	decl := f.Decls[index]
+	// 声明中可能有多个内容相同的标记，按序号在重新输出的源码中找到同一个标记
+	text := markerText(c.Text)
+	nth := 0
+	for _, cg := range declComments(f, decl) {
+		for _, x := range cg.List {
+			if x.Pos() < c.Pos() && markerText(x.Text) == text {
+				nth++
+			}
+		}
+	}
+	source, ok := declSource(f, decl)
+	if !ok {
+		return false
+	}
+	tmpFset := token.NewFileSet()
+	tmpF, err := parser.ParseFile(tmpFset, "", source, parser.ParseComments)
+	if err != nil {
+		return false
+	}
+	offset := -1
+	for _, cg := range tmpF.Comments {
+		for _, x := range cg.List {
+			if markerText(x.Text) != text {
+				continue
+			}
+			if nth == 0 {
+				offset = tmpFset.Position(x.Pos()).Offset
+			}
+			nth--
+		}
+	}
+	if offset == -1 {
+		return false
+	}
+	start := strings.LastIndex(source[:offset], "\n") + 1
+	after := source[:offset] + "\n" + src + "\n" + source[offset:]
+	if indent := source[start:offset]; strings.TrimSpace(indent) == "" {
+		after = source[:start] + indent + strings.ReplaceAll(src, "\n", "\n"+indent) + "\n" + source[start:]
+	}
+	return replaceDeclSource(f, index, source, after)
+}
+
+// declSource 输出声明及其注释的源码，源码以 package p 开头，可以直接解析
+func declSource(f *ast.File, decl ast.Decl) (string, bool) {
+	if _, isSnippet := snippets.Load(decl); isSnippet {
+		// 源码片段中声明之前及之后的注释一并输出
+		var buf bytes.Buffer
+		buf.WriteString("package p\n\n")
+		if err := formatNewDecl(&buf, nil, decl); err != nil {
+			return "", false
+		}
+		return buf.String(), true
+	}
+	fset, ok := fileSets.Load(f)
+	if !ok && isNewDecl(decl) {
+		// 新生成的声明没有位置信息，不依赖文件的 FileSet
+		fset, ok = token.NewFileSet(), true
+	}
+	if !ok {
+		return "", false
+	}
+	var buf bytes.Buffer
+	buf.WriteString("package p\n\n")
+	if err := format.Node(&buf, fset.(*token.FileSet), &printer.CommentedNode{Node: decl, Comments: declComments(f, decl)}); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// replaceDeclSource 将第 index 个声明替换为源码中唯一的声明，before 为修改前由 declSource 输出的源码
+//  新声明中未修改的节点换回原声明中对应的节点（见 graftDecl），原声明及其中未被替换的节点仍然属于文件
+func replaceDeclSource(f *ast.File, index int, before, source string) bool {
+	decls, err := parseDecls(source)
+	if err != nil || len(decls) != 1 {
+		return false
+	}
+	old := f.Decls[index]
+	hint := old.Pos()
+	if isNewDecl(old) {
+		hint = declHint(old)
+	}
+	removeComments(f, old)
+	if !graftDecl(old, before, decls[0], source) {
+		replaceDecl(f, index, decls[0])
+		return true
+	}
+	// 原声明的位置信息已换成新声明的，片段信息随之转移
+	s, _ := snippets.Load(decls[0])
+	releaseDecl(decls[0])
+	releaseDecl(old)
+	snippets.Store(old, s)
+	setDeclHint(old, hint)
+	return true
+}
@@ -0,0 +1,50 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMarker(t *testing.T) {
+	fst, f := InitEnv("./test_demo/marker_demo.go")
+
+	// 文件级别
+	assert.True(t, AddFuncAt(f, &AstFunc{Name: "First"}, &AstInsertPos{Marker: "// astutil:funcs"}))
+	assert.True(t, AddFuncAt(f, &AstFunc{Name: "Second"}, &AstInsertPos{Marker: "//astutil:funcs"}))
+	assert.True(t, AddVarAfterVar(f, "v1", "1", "// astutil:vars"))
+	assert.False(t, AddVarAfterVar(f, "v2", "1", "// astutil:notfound"))
+	// 函数内的标记不是文件级别的标记
+	assert.False(t, AddFuncAt(f, &AstFunc{Name: "Third"}, &AstInsertPos{Marker: "// astutil:setup"}))
+
+	// 类型内
+	assert.True(t, AddKVToStruct(f, "Model", "Age", "int", "// astutil:fields"))
+	assert.True(t, AddFuncToInterface(f, "Service", &AstFunc{Name: "Put"}, "// astutil:methods"))
+	assert.False(t, AddKVToStruct(f, "Model", "Age", "int", "// astutil:methods"))
+
+	// 字面量内
+	assert.True(t, AddValueToSlice(f, "routes", AddQuote("/a"), "// astutil:routes"))
+	assert.True(t, AddValueToSlice(f, "routes", AddQuote("/b"), "// astutil:routes"))
+	assert.True(t, AddValueToMap(f, "handlers", AddQuote("b"), "2", "// astutil:handlers"))
+	assert.True(t, AddKVToUnaryStruct(f, "conf", "Name", AddQuote("conf"), "// astutil:conf"))
+	assert.True(t, AddKVToFuncUnaryStruct(f, "Setup", "m", "Name", AddQuote("m"), "// astutil:model"))
+
+	// 函数内
+	assert.True(t, AddVarToFunc(f, "Setup", "s", AddQuote("s"), "// astutil:setup", "var"))
+	assert.True(t, AddCallBlockToFunc(f, "Setup", []AstCallExpr{{FunName: "fmt", FunSel: "Println", Args: []string{"s"}}}, "// astutil:setup"))
+	assert.NoError(t, RenderStmts(fst, f, "Setup", "fmt.Println({{.}})", 2, "// astutil:case"))
+	assert.False(t, AddVarToFunc(f, "Setup", "x", "1", "// astutil:funcs", "var"))
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "type Model struct {\n\tID  int\n\tAge int\n\t// astutil:fields\n\tName string\n}")
+	assert.Contains(t, string(src), "\tGet() int\n\tPut()\n\t// astutil:methods\n}")
+	assert.Contains(t, string(src), "var routes = []string{\n\t\"/\",\n\t\"/a\",\n\t\"/b\",\n\t// astutil:routes\n}")
+	assert.Contains(t, string(src), "\t\"a\": 1,\n\t\"b\": 2,\n\t// astutil:handlers\n}")
+	assert.Contains(t, string(src), "\tID:   1,\n\tName: \"conf\",\n\t// astutil:conf\n}")
+	assert.Contains(t, string(src), "var v1 = 1\n\n// astutil:vars\n\nfunc Setup() {")
+	assert.Contains(t, string(src), "\tvar r = 1\n\tvar s = \"s\"\n\t{\n\t\tfmt.Println(s)\n\t}\n\t// astutil:setup\n\tfmt.Println(r)\n")
+	assert.Contains(t, string(src), "\t\tfmt.Println(1)\n\t\tfmt.Println(2)\n\t\t// astutil:case\n\tdefault:")
+	assert.Contains(t, string(src), "\tm := &Model{\n\t\tName: \"m\",\n\t\t// astutil:model\n\t}")
+	assert.Contains(t, string(src), "func First() {\n}\n\nfunc Second() {\n}\n\n// astutil:funcs\n\nfunc End() {")
+	PrintResult(fst, f)
+}
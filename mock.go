@@ -0,0 +1,299 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AstMockOption 生成 mock 的选项
+type AstMockOption struct {
+	// Name mock 结构体名称，为空时为 Mock + 接口名称
+	Name string
+	// PkgPath 接口所在包的导入路径，输出文件与接口不在同一个包时必须设置
+	PkgPath string
+}
+
+// GenerateMock 为接口生成 mock 实现，写入输出文件 out
+//
+// 每个方法对应一个 XxxFunc 函数成员及一个 XxxCalls 调用记录，方法记录参数后调用 XxxFunc，XxxFunc 未设置时 panic。
+// files 为查找接口的文件，接口中嵌入的本包接口及 error 会一并展开。
+// out 与接口不在同一个包时，接口所在包的类型会加上包名，并导入 PkgPath。out 中已存在同名类型时返回 false
+//
+// 测试数据：
+//
+// type TestInf interface {
+//	Demo(a string) error
+// }
+//
+// 执行：GenerateMock(fset, files, out, "TestInf", nil)
+//
+// 结果为：
+//
+// // MockTestInf 为 TestInf 的 mock 实现
+// type MockTestInf struct {
+//	// DemoFunc 为 Demo 的实现
+//	DemoFunc func(a string) error
+//	// DemoCalls 记录 Demo 的调用参数
+//	DemoCalls []MockTestInfDemoCall
+//
+//	mu sync.Mutex
+// }
+//
+// // MockTestInfDemoCall 为 Demo 的一次调用参数
+// type MockTestInfDemoCall struct {
+//	A string
+// }
+//
+// var _ TestInf = (*MockTestInf)(nil)
+//
+// func (m *MockTestInf) Demo(a string) error {
+//	m.mu.Lock()
+//	m.DemoCalls = append(m.DemoCalls, MockTestInfDemoCall{A: a})
+//	m.mu.Unlock()
+//	if m.DemoFunc == nil {
+//		panic("MockTestInf.Demo: DemoFunc is not set")
+//	}
+//	return m.DemoFunc(a)
+// }
+func GenerateMock(fset *token.FileSet, files []*ast.File, out *ast.File, infName string, opt *AstMockOption) bool {
+	if opt == nil {
+		opt = &AstMockOption{}
+	}
+	mockName := opt.Name
+	if mockName == "" {
+		mockName = "Mock" + infName
+	}
+	g, spec := findTypeSpecIn(files, infName)
+	if spec == nil || spec.TypeParams != nil || findTypeSpec(out, mockName) != nil {
+		return false
+	}
+	inf, ok := spec.Type.(*ast.InterfaceType)
+	if !ok {
+		return false
+	}
+	methods, ok := interfaceMethods(files, inf, map[string]bool{infName: true})
+	if !ok {
+		return false
+	}
+	m := &mockBuilder{files: files, imports: make(map[string]string)}
+	if out.Name.Name != g.Name.Name {
+		if opt.PkgPath == "" {
+			return false
+		}
+		m.pkg = g.Name.Name
+		m.imports[m.pkg] = opt.PkgPath
+	}
+
+	var fields, types, funcs strings.Builder
+	for _, method := range methods {
+		name := method.Names[0].Name
+		ft := method.Type.(*ast.FuncType)
+		callName := mockName + name + "Call"
+		params := m.params(ft.Params)
+		results := m.results(ft.Results)
+		recv := mockRecvName(params)
+
+		paramList := make([]string, 0, len(params))
+		args := make([]string, 0, len(params))
+		callFields := make([]string, 0, len(params))
+		callValues := make([]string, 0, len(params))
+		// a 与 A 导出后同名，重复的成员名称加上数字后缀
+		used := make(map[string]bool, len(params))
+		for _, p := range params {
+			paramList = append(paramList, p.name+" "+p.typ)
+			arg, typ := p.name, p.typ
+			if strings.HasPrefix(typ, "...") {
+				arg, typ = arg+"...", "[]"+strings.TrimPrefix(typ, "...")
+			}
+			args = append(args, arg)
+			field := exportedName(p.name)
+			for i := 2; used[field]; i++ {
+				field = exportedName(p.name) + strconv.Itoa(i)
+			}
+			used[field] = true
+			callFields = append(callFields, field+" "+typ)
+			callValues = append(callValues, field+": "+p.name)
+		}
+		signature := "(" + strings.Join(paramList, ", ") + ")" + results
+
+		fmt.Fprintf(&fields, "// %sFunc 为 %s 的实现\n%sFunc func%s\n", name, name, name, signature)
+		fmt.Fprintf(&fields, "// %sCalls 记录 %s 的调用参数\n%sCalls []%s\n", name, name, name, callName)
+
+		fmt.Fprintf(&types, "// %s 为 %s 的一次调用参数\ntype %s struct {\n%s}\n\n", callName, name, callName, joinLines(callFields))
+
+		for _, line := range commentLines(method.Doc) {
+			funcs.WriteString(line + "\n")
+		}
+		fmt.Fprintf(&funcs, "func (%s *%s) %s%s {\n", recv, mockName, name, signature)
+		fmt.Fprintf(&funcs, "%s.mu.Lock()\n%s.%sCalls = append(%s.%sCalls, %s{%s})\n%s.mu.Unlock()\n",
+			recv, recv, name, recv, name, callName, strings.Join(callValues, ", "), recv)
+		fmt.Fprintf(&funcs, "if %s.%sFunc == nil {\npanic(%q)\n}\n", recv, name, mockName+"."+name+": "+name+"Func is not set")
+		call := fmt.Sprintf("%s.%sFunc(%s)", recv, name, strings.Join(args, ", "))
+		if results != "" {
+			call = "return " + call
+		}
+		funcs.WriteString(call + "\n}\n\n")
+	}
+
+	infType := infName
+	if m.pkg != "" {
+		infType = m.pkg + "." + infName
+	}
+	src := fmt.Sprintf("// %s 为 %s 的 mock 实现\ntype %s struct {\n%s\nmu sync.Mutex\n}\n\n", mockName, infName, mockName, fields.String())
+	src += types.String()
+	src += fmt.Sprintf("var _ %s = (*%s)(nil)\n\n", infType, mockName)
+	src += funcs.String()
+	decls, err := parseDecls(src)
+	if err != nil {
+		return false
+	}
+	out.Decls = append(out.Decls, decls...)
+
+	m.imports["sync"] = "sync"
+	names := make([]string, 0, len(m.imports))
+	for name := range m.imports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pkgPath := m.imports[name]
+		if hasImport(out, pkgPath) {
+			continue
+		}
+		if path.Base(pkgPath) == name {
+			name = ""
+		}
+		AddImport(fset, out, name, pkgPath)
+	}
+	return true
+}
+
+// mockParam mock 方法的参数
+type mockParam struct {
+	name string
+	typ  string
+}
+
+// mockBuilder 生成 mock 时记录需要导入的包
+type mockBuilder struct {
+	files []*ast.File
+	// pkg 不为空时，接口所在包的类型需要加上该包名
+	pkg string
+	// imports 包名与导入路径
+	imports map[string]string
+}
+
+// params 返回参数列表，匿名参数及 _ 命名为 p0、p1
+func (m *mockBuilder) params(list *ast.FieldList) []mockParam {
+	params := make([]mockParam, 0)
+	for i, field := range flattenFields(list) {
+		name := fmt.Sprintf("p%d", i)
+		if len(field.Names) > 0 && field.Names[0].Name != "_" {
+			name = field.Names[0].Name
+		}
+		params = append(params, mockParam{name: name, typ: m.typeString(field.Type)})
+	}
+	return params
+}
+
+// results 返回不带名称的返回值列表源码，没有返回值时为空
+func (m *mockBuilder) results(list *ast.FieldList) string {
+	types := make([]string, 0)
+	for _, field := range flattenFields(list) {
+		types = append(types, m.typeString(field.Type))
+	}
+	switch len(types) {
+	case 0:
+		return ""
+	case 1:
+		return " " + types[0]
+	}
+	return " (" + strings.Join(types, ", ") + ")"
+}
+
+// typeString 返回类型的源码，记录使用到的包，需要时为接口所在包的类型加上包名
+func (m *mockBuilder) typeString(typ ast.Expr) string {
+	expr, err := parser.ParseExpr(exprString(typ))
+	if err != nil {
+		return exprString(typ)
+	}
+	ast.Inspect(expr, m.qualify)
+	return exprString(expr)
+}
+
+// qualify 记录使用到的包，为接口所在包的类型加上包名
+func (m *mockBuilder) qualify(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.Field:
+		// 函数类型中的参数名称不需要处理
+		ast.Inspect(n.Type, m.qualify)
+		return false
+	case *ast.SelectorExpr:
+		if id, ok := n.X.(*ast.Ident); ok {
+			if pkgPath := m.importPath(id.Name); pkgPath != "" {
+				m.imports[id.Name] = pkgPath
+			}
+		}
+		return false
+	case *ast.Ident:
+		if m.pkg != "" {
+			if _, spec := findTypeSpecIn(m.files, n.Name); spec != nil {
+				n.Name = m.pkg + "." + n.Name
+			}
+		}
+	}
+	return true
+}
+
+// importPath 返回包名对应的导入路径
+func (m *mockBuilder) importPath(name string) string {
+	for _, f := range m.files {
+		for _, s := range f.Imports {
+			pkgPath := importPath(s)
+			if importName(s) == name || importName(s) == "" && path.Base(pkgPath) == name {
+				return pkgPath
+			}
+		}
+	}
+	return ""
+}
+
+// mockRecvName 返回与参数名称不冲突的接收者名称
+func mockRecvName(params []mockParam) string {
+	used := make(map[string]bool, len(params))
+	for _, p := range params {
+		used[p.name] = true
+	}
+	return freeName("m", used)
+}
+
+// joinLines 将每一项作为一行拼接
+func joinLines(lines []string) string {
+	var buf strings.Builder
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+	return buf.String()
+}
+
+// hasImport 判断文件是否已导入 path
+func hasImport(f *ast.File, pkgPath string) bool {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			if importPath(spec.(*ast.ImportSpec)) == pkgPath {
+				return true
+			}
+		}
+	}
+	return false
+}
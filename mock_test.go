@@ -0,0 +1,63 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestGenerateMock(t *testing.T) {
+	fst, files := InitEnvs("./test_demo/type_demo.go")
+	out, err := parser.ParseFile(fst, "mock.go", "package test_demo\n", parser.ParseComments)
+	assert.NoError(t, err)
+
+	ret := GenerateMock(fst, files, out, "TestInf", nil)
+	assert.True(t, ret)
+	// 已存在同名类型
+	ret = GenerateMock(fst, files, out, "TestInf", nil)
+	assert.False(t, ret)
+	ret = GenerateMock(fst, files, out, "NotFound", nil)
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "import \"sync\"\n")
+	assert.Contains(t, string(src), "\t// DemoFunc 为 Demo 的实现\n\tDemoFunc func(a string) error\n\t// DemoCalls 记录 Demo 的调用参数\n\tDemoCalls []MockTestInfDemoCall\n")
+	assert.Contains(t, string(src), "type MockTestInfTestsCall struct {\n\tA []string\n}")
+	assert.Contains(t, string(src), "var _ TestInf = (*MockTestInf)(nil)")
+	assert.Contains(t, string(src), "func (m *MockTestInf) Tests(a ...string) error {\n\tm.mu.Lock()\n\tm.TestsCalls = append(m.TestsCalls, MockTestInfTestsCall{A: a})\n\tm.mu.Unlock()\n\tif m.TestsFunc == nil {\n\t\tpanic(\"MockTestInf.Tests: TestsFunc is not set\")\n\t}\n\treturn m.TestsFunc(a...)\n}")
+	PrintResult(fst, out)
+}
+
+func TestGenerateMockOtherPackage(t *testing.T) {
+	fst := token.NewFileSet()
+	f, err := parser.ParseFile(fst, "./test_demo/mock_demo.go", nil, parser.ParseComments)
+	assert.NoError(t, err)
+	inf, err := parser.ParseFile(fst, "./test_demo/interface_demo.go", nil, parser.ParseComments)
+	assert.NoError(t, err)
+	out, err := parser.ParseFile(fst, "mock.go", "package mocks\n", parser.ParseComments)
+	assert.NoError(t, err)
+	files := []*ast.File{f, inf}
+
+	// 不在同一个包时必须设置导入路径
+	ret := GenerateMock(fst, files, out, "Store", nil)
+	assert.False(t, ret)
+	ret = GenerateMock(fst, files, out, "Store", &AstMockOption{Name: "StoreMock", PkgPath: "github.com/ouzhou0110/demo"})
+	assert.True(t, ret)
+
+	src, err := formatFile(fst, out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "import (\n\t\"context\"\n\ttest_demo \"github.com/ouzhou0110/demo\"\n\tctxio \"io\"\n\t\"sync\"\n)\n")
+	assert.Contains(t, string(src), "var _ test_demo.Store = (*StoreMock)(nil)")
+	assert.Contains(t, string(src), "// Get 根据 id 获取数据\nfunc (m *StoreMock) Get(ctx context.Context, id int) (*test_demo.Impl, error) {")
+	assert.Contains(t, string(src), "type StoreMockPutCall struct {\n\tP0 context.Context\n\tP1 test_demo.Impl\n\tP2 []string\n}")
+	assert.Contains(t, string(src), "func (m_ *StoreMock) Reader(m string) ctxio.Reader {")
+	// 参数 a 与 A 的记录成员不重复
+	assert.Contains(t, string(src), "type StoreMockCopyCall struct {\n\tA  string\n\tA2 string\n}")
+	assert.Contains(t, string(src), "StoreMockCopyCall{A: a, A2: A}")
+	assert.Contains(t, string(src), "func (m *StoreMock) ID() int {")
+	assert.Contains(t, string(src), "\tm.CloseCalls = append(m.CloseCalls, StoreMockCloseCall{})\n\tm.mu.Unlock()\n\tif m.CloseFunc == nil {\n\t\tpanic(\"StoreMock.Close: CloseFunc is not set\")\n\t}\n\tm.CloseFunc()\n}")
+	PrintResult(fst, out)
+}
@@ -0,0 +1,320 @@
+package ozastutil
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// 插入节点的位置
+//
+// go/printer 根据节点的位置决定换行及注释的输出位置。新节点没有位置或者使用伪造的位置时，
+// 会与原有的注释交错，或者在列表末尾输出多余的 ",\n}"。
+// 因此向已有声明中插入节点时不直接修改语法树，而是与 spliceAtMarker 一样：
+// 输出所属声明的源码，在插入点写入新节点的源码后重新解析，用得到的声明替换原声明，新节点从而拥有真实的位置。
+// 插入点按列表的排版确定：
+//
+//	列表在一行内时插入到相邻元素之间，如 {"a": 1, "b": 2}
+//	列表跨多行（语句、struct 成员等总是跨多行）时新元素单独占一行，
+//	插入到前一个元素所在行之后，或者后一个元素及其上方紧挨着的注释之前
+//	空列表插入到左括号之后
+//
+// 重新解析得到的声明中，插入点之外的节点与原声明的节点一一对应，对应的节点原地更新为新的内容（见 graftDecl），
+// 因此调用方此前持有的该声明及其中的节点（如 *ast.FuncDecl、*ast.CompositeLit、Query 的结果）插入后仍然有效。
+// 文件没有关联 FileSet（见 BindFileSet）时无法输出原声明，新节点只能使用伪造的位置，因此不插入，返回 false。
+
+// nodeList 节点中的元素列表
+type nodeList struct {
+	open, close token.Pos
+	elems       []ast.Node
+	// lines 为 true 时每个元素单独占一行，没有逗号分隔
+	lines bool
+	// wrap 为 true 时列表没有括号，如 import "fmt"，插入时加上括号
+	wrap bool
+}
+
+// listOf 返回节点中可以插入元素的列表
+func listOf(node ast.Node, source string, fset *token.FileSet) (*nodeList, bool) {
+	l := &nodeList{}
+	switch n := node.(type) {
+	case *ast.CompositeLit:
+		l.open, l.close = n.Lbrace, n.Rbrace
+		for _, e := range n.Elts {
+			l.elems = append(l.elems, e)
+		}
+	case *ast.CallExpr:
+		l.open, l.close = n.Lparen, n.Rparen
+		for _, e := range n.Args {
+			l.elems = append(l.elems, e)
+		}
+	case *ast.BlockStmt:
+		l.open, l.close, l.lines = n.Lbrace, n.Rbrace, true
+		for _, s := range n.List {
+			l.elems = append(l.elems, s)
+		}
+	case *ast.FieldList:
+		if !n.Opening.IsValid() {
+			return nil, false
+		}
+		// struct、interface 的成员每个占一行，参数列表用逗号分隔
+		l.open, l.close = n.Opening, n.Closing
+		l.lines = source[fset.Position(n.Opening).Offset] == '{'
+		for _, field := range n.List {
+			l.elems = append(l.elems, field)
+		}
+	case *ast.GenDecl:
+		if len(n.Specs) == 0 {
+			return nil, false
+		}
+		l.open, l.close, l.lines, l.wrap = n.Lparen, n.Rparen, true, !n.Lparen.IsValid()
+		for _, spec := range n.Specs {
+			l.elems = append(l.elems, spec)
+		}
+	default:
+		return nil, false
+	}
+	return l, true
+}
+
+// insertNode 在 parent 的元素列表中第 index 个元素之前插入源码 src，index 为列表长度时添加到末尾，
+// 插入后 parent 及所属的声明原地更新为重新解析的内容，文件没有关联 FileSet 时返回 false
+func insertNode(f *ast.File, parent ast.Node, index int, src string) bool {
+	di := ownerDecl(f, parent)
+	if di == -1 {
+		return false
+	}
+	decl := f.Decls[di]
+	path, ok := nodePath(decl, parent)
+	if !ok {
+		return false
+	}
+	source, ok := declSource(f, decl)
+	if !ok {
+		return false
+	}
+	tmpFset := token.NewFileSet()
+	tmpF, err := parser.ParseFile(tmpFset, "", source, parser.ParseComments)
+	if err != nil || len(tmpF.Decls) != 1 {
+		return false
+	}
+	l, ok := listOf(followPath(tmpF.Decls[0], path), source, tmpFset)
+	if !ok || index < 0 || index > len(l.elems) {
+		return false
+	}
+	return replaceDeclSource(f, di, source, spliceList(source, tmpFset, l, index, src))
+}
+
+// spliceList 在源码中列表的第 index 个元素之前写入 src
+func spliceList(source string, fset *token.FileSet, l *nodeList, index int, src string) string {
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	line := func(pos token.Pos) int { return fset.Position(pos).Line }
+	insert := func(at int, text string) string {
+		return source[:at] + text + source[at:]
+	}
+	if l.wrap {
+		from, to := offset(l.elems[0].Pos()), offset(l.elems[0].End())
+		to = lineEnd(source, to)
+		if index == 0 {
+			return source[:from] + "(\n" + src + "\n" + source[from:to] + "\n)" + source[to:]
+		}
+		return source[:from] + "(\n" + source[from:to] + "\n" + src + "\n)" + source[to:]
+	}
+	comma := ","
+	if l.lines {
+		comma = ""
+	}
+	if !l.lines && line(l.open) == line(l.close) {
+		switch {
+		case index < len(l.elems):
+			return insert(offset(l.elems[index].Pos()), src+", ")
+		case len(l.elems) > 0:
+			return insert(offset(l.elems[len(l.elems)-1].End()), ", "+src)
+		default:
+			return insert(offset(l.open)+1, src)
+		}
+	}
+	if index < len(l.elems) {
+		return insert(commentStart(source, offset(l.elems[index].Pos())), src+comma+"\n")
+	}
+	closeAt := offset(l.close)
+	if len(l.elems) > 0 {
+		last := offset(l.elems[len(l.elems)-1].End())
+		if line(l.elems[len(l.elems)-1].End()) < line(l.close) {
+			// 前一个元素所在行之后，保留行尾的逗号和注释
+			return insert(lineEnd(source, last), "\n"+src+comma)
+		}
+		// 右括号与最后一个元素在同一行
+		if strings.TrimSpace(source[last:closeAt]) == "," || l.lines {
+			return insert(closeAt, "\n"+src+comma+"\n")
+		}
+		return insert(closeAt, ",\n"+src+comma+"\n")
+	}
+	// 空列表中只有空白时替换为新元素，有注释时插入到右括号所在行之前
+	if openAt := offset(l.open) + 1; strings.TrimSpace(source[openAt:closeAt]) == "" {
+		return source[:openAt] + "\n" + src + comma + "\n" + source[closeAt:]
+	}
+	if start := lineStart(source, closeAt); strings.TrimSpace(source[start:closeAt]) == "" {
+		return insert(start, src+comma+"\n")
+	}
+	return insert(closeAt, "\n"+src+comma+"\n")
+}
+
+// lineEnd 返回 offset 所在行的行尾位置
+func lineEnd(source string, offset int) int {
+	if i := strings.Index(source[offset:], "\n"); i != -1 {
+		return offset + i
+	}
+	return len(source)
+}
+
+// commentStart 返回 offset 所在行的起始位置，上方紧挨着的注释行属于该元素，一起跳过
+func commentStart(source string, offset int) int {
+	start := lineStart(source, offset)
+	for start > 0 {
+		prev := lineStart(source, start-1)
+		text := strings.TrimSpace(source[prev : start-1])
+		if !strings.HasPrefix(text, "//") && !strings.HasPrefix(text, "/*") {
+			break
+		}
+		start = prev
+	}
+	return start
+}
+
+// nodePath 返回从 root 到 node 经过的子节点序号（见 eachChild，不包括注释）
+func nodePath(root, node ast.Node) ([]int, bool) {
+	if root == node {
+		return []int{}, true
+	}
+	var path []int
+	found := false
+	i := 0
+	eachChild(root, func(v reflect.Value) bool {
+		child, ok := v.Interface().(ast.Node)
+		if !ok || isCommentNode(child) {
+			return false
+		}
+		if sub, ok := nodePath(child, node); ok {
+			path, found = append([]int{i}, sub...), true
+			return true
+		}
+		i++
+		return false
+	})
+	return path, found
+}
+
+// followPath 按 nodePath 返回的序号找到对应的节点
+func followPath(root ast.Node, path []int) ast.Node {
+	for _, index := range path {
+		var next ast.Node
+		i := 0
+		eachChild(root, func(v reflect.Value) bool {
+			child, ok := v.Interface().(ast.Node)
+			if !ok || isCommentNode(child) {
+				return false
+			}
+			if i == index {
+				next = child
+				return true
+			}
+			i++
+			return false
+		})
+		if next == nil {
+			return nil
+		}
+		root = next
+	}
+	return root
+}
+
+// isCommentNode 判断节点是否为注释，注释重新输出后不一定挂在原来的节点上
+func isCommentNode(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.CommentGroup, *ast.Comment:
+		return true
+	}
+	return false
+}
+
+// graftDecl 将由修改后的源码 after 解析得到的声明 nd 嫁接到原声明 od 上，before 为修改前 od 输出的源码
+//  before 与 after 首尾相同的部分之外为修改的范围，两个声明中完全位于修改范围内的节点为被删除或新写入的节点，
+//  其余节点按先序一一对应，对应的原节点原地复制新节点的内容，子节点再指回原节点，
+//  原声明及其中未被修改的节点因此仍然属于文件。节点无法对应时返回 false，调用方改为直接替换声明
+func graftDecl(od ast.Decl, before string, nd ast.Decl, after string) bool {
+	tmpFset := token.NewFileSet()
+	tmpF, err := parser.ParseFile(tmpFset, "", before, parser.ParseComments)
+	if err != nil || len(tmpF.Decls) != 1 {
+		return false
+	}
+	olds, tmps := preorder(od), preorder(tmpF.Decls[0])
+	if len(olds) != len(tmps) {
+		return false
+	}
+	s, ok := snippets.Load(nd)
+	if !ok {
+		return false
+	}
+	newFset := s.(*snippet).fset
+	// 修改的范围
+	p := 0
+	for p < len(before) && p < len(after) && before[p] == after[p] {
+		p++
+	}
+	q := 0
+	for q < len(before)-p && q < len(after)-p && before[len(before)-1-q] == after[len(after)-1-q] {
+		q++
+	}
+	kept := func(fset *token.FileSet, nodes []ast.Node, hi int) []int {
+		var list []int
+		for i, n := range nodes {
+			from, to := fset.Position(n.Pos()).Offset, fset.Position(n.End()).Offset
+			if from < p || to > hi || from == to {
+				list = append(list, i)
+			}
+		}
+		return list
+	}
+	news := preorder(nd)
+	keptOld, keptNew := kept(tmpFset, tmps, len(before)-q), kept(newFset, news, len(after)-q)
+	if len(keptOld) != len(keptNew) || len(keptOld) == 0 || keptOld[0] != 0 || keptNew[0] != 0 {
+		return false
+	}
+	pairs := make(map[ast.Node]ast.Node, len(keptNew))
+	for i := range keptNew {
+		o, n := olds[keptOld[i]], news[keptNew[i]]
+		if reflect.TypeOf(o) != reflect.TypeOf(n) {
+			return false
+		}
+		pairs[n] = o
+	}
+	for n, o := range pairs {
+		reflect.ValueOf(o).Elem().Set(reflect.ValueOf(n).Elem())
+	}
+	for _, o := range pairs {
+		eachChild(o, func(v reflect.Value) bool {
+			if child, ok := v.Interface().(ast.Node); ok {
+				if orig, ok := pairs[child]; ok {
+					v.Set(reflect.ValueOf(orig))
+				}
+			}
+			return false
+		})
+	}
+	return true
+}
+
+// preorder 按先序返回节点及其所有子节点（见 eachChild，不包括注释）
+func preorder(root ast.Node) []ast.Node {
+	nodes := []ast.Node{root}
+	eachChild(root, func(v reflect.Value) bool {
+		if child, ok := v.Interface().(ast.Node); ok && !isCommentNode(child) {
+			nodes = append(nodes, preorder(child)...)
+		}
+		return false
+	})
+	return nodes
+}
@@ -0,0 +1,124 @@
+package ozastutil
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "更新 test_demo 中的 golden 文件")
+
+// assertGolden 比较输出与 golden 文件，-update 时写入 golden 文件
+func assertGolden(t *testing.T, path string, src []byte) {
+	if *updateGolden {
+		assert.NoError(t, ioutil.WriteFile(path, src, 0644))
+		return
+	}
+	golden, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, string(golden), string(src))
+}
+
+func TestInsertPosition(t *testing.T) {
+	fst, f := InitEnv("./test_demo/position_demo.go")
+
+	// 没有 import 时新声明添加到 package 子句所在行之后，行尾注释留在原处
+	assert.True(t, AddImport(fst, f, "", "fmt"))
+	assert.True(t, AddImport(fst, f, "", "strings"))
+	assert.True(t, AddKVToStruct(f, "Model", "Age", "int"))
+	assert.True(t, AddValueToSlice(f, "routes", AddQuote("/a")))
+	assert.True(t, AddValueToMap(f, "handlers", AddQuote("b"), "2"))
+	assert.True(t, AddKVToUnaryStruct(f, "conf", "Name", AddQuote("m")))
+	assert.True(t, AddVarToFunc(f, "Setup", "s", AddQuote("s"), "", "assign"))
+	assert.True(t, AddVarToFunc(f, "Empty", "e", "1", "", "var"))
+
+	src, err := FormatFile(fst, f)
+	assert.NoError(t, err)
+	assertGolden(t, "./test_demo/position_demo.golden", src)
+	PrintResult(fst, f)
+}
+
+func TestInsertImport(t *testing.T) {
+	// 没有括号的 import 添加括号
+	fst, f := InitEnv("./test_demo/edit_demo.go")
+	assert.True(t, AddImport(fst, f, "", "strings"))
+	src, err := FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "import (\n\t\"fmt\"\n\t\"strings\"\n)\n\ntype Stu struct {")
+
+	// 没有 import 时添加到 package 子句之后
+	fst, f = InitEnv("./test_demo/var_add_value_to_slice.go")
+	assert.True(t, AddImport(fst, f, "", "os"))
+	assert.True(t, AddImport(fst, f, "", "fmt"))
+	src, err = FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, "package test_demo\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nvar sliceStr = []string{\"1\"}\n\n// hello 作为变量添加到 sliceStr 中\nvar hello = \"hello\"\n", string(src))
+}
+
+func TestInsertUnbound(t *testing.T) {
+	// 直接用 parser.ParseFile 解析、没有关联 FileSet 的文件无法输出原声明，不插入
+	fst := token.NewFileSet()
+	f, err := parser.ParseFile(fst, "./test_demo/edit_demo.go", nil, parser.ParseComments)
+	assert.NoError(t, err)
+	before, err := FormatFile(fst, f)
+	assert.NoError(t, err)
+
+	assert.False(t, AddImport(fst, f, "", "strings"))
+	assert.False(t, AddKVToStruct(f, "Stu", "Age", "int"))
+	assert.False(t, AddValueToMap(f, "handlers", AddQuote("b"), "2"))
+	assert.False(t, AddVarToFunc(f, "Setup", "s", AddQuote("s"), "", "assign"))
+	m, err := Query(f, `var[name=handlers] > kv[key="a"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+	assert.False(t, ReplaceNode(f, m[0], `"a": 2`))
+
+	after, err := FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	// 关联 FileSet 后可以插入
+	BindFileSet(fst, f)
+	defer ReleaseFile(f)
+	assert.True(t, AddKVToStruct(f, "Stu", "Age", "int"))
+	src, err := FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "\tName string\n\tAge  int\n}")
+}
+
+func TestInsertKeepNodes(t *testing.T) {
+	fst, f := InitEnv("./test_demo/edit_demo.go")
+	_, fd := findFunc(f, "Setup")
+	body := fd.Body
+	m, err := Query(f, `var[name=handlers] > kv[key="a"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+	kv, lit := m[0].Node, m[0].Parent().(*ast.CompositeLit)
+
+	// 插入后原有的声明及其中的节点仍然属于文件
+	assert.True(t, AddVarToFunc(f, "Setup", "s", AddQuote("s"), "", "assign"))
+	assert.True(t, AddValueToMap(f, "handlers", AddQuote("b"), "2"))
+	assert.Equal(t, 3, len(body.List))
+	assert.True(t, body == fd.Body)
+	assert.Equal(t, 2, len(lit.Elts))
+	assert.True(t, lit.Elts[0] == kv)
+	assert.True(t, ownerDecl(f, kv) != -1)
+
+	// 继续修改同一个函数
+	assert.True(t, insertNode(f, body, len(body.List), "_ = s"))
+	assert.Equal(t, 4, len(fd.Body.List))
+	m, err = Query(f, `func[name=Setup] > call[fun=fmt.Println]`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+	assert.True(t, ReplaceNode(f, m[0], "fmt.Println(a)"))
+	assert.Equal(t, 4, len(body.List))
+	assert.True(t, ownerDecl(f, body) != -1)
+
+	src, err := FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "func Setup(a string) {\n\tstu := &Stu{}\n\tfmt.Println(a)\n\ts := \"s\"\n\t_ = s\n}")
+	assert.Contains(t, string(src), `var handlers = map[string]int{"a": 1, "b": 2}`)
+}
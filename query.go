@@ -0,0 +1,639 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 选择器查询
+//
+// 选择器由若干个节点选择条件组成，条件之间以空格分隔表示后代，以 > 分隔表示子节点，
+// 每个条件为节点类型加上若干个 [属性=值]，值可以加双引号，类型为 * 时匹配所有类型。
+// 子节点及后代只考虑能被选择的节点，如 var > kv 中 map 字面量本身不算一层。
+//
+// 例子：
+//
+// func[name=Func1] > assign[lhs=ret]
+//
+// type[name=Stu] field[name=Name]
+//
+// var[name=mapStr] > kv[key="cc"]
+//
+// 支持的节点类型及属性：
+//
+// import: name、path
+//
+// type: name、kind（struct、interface、alias、type）
+//
+// field: name、type、tag，struct 的成员或 interface 的方法
+//
+// func: name、recv（接收者类型名称，如 Stu）
+//
+// param、result: name、type，函数的参数及返回值
+//
+// var、const: name、type、value，包括函数内的 var 声明
+//
+// assign: lhs、rhs、tok（= 或 :=）
+//
+// call: fun（如 fmt.Println）、name（如 Println）
+//
+// kv: key、value，字符串的键及值可以不加引号
+//
+// return、if、for、range: 没有属性
+
+// queryAttrs 节点类型 => 支持的属性
+var queryAttrs = map[string][]string{
+	"import": {"name", "path"},
+	"type":   {"name", "kind"},
+	"field":  {"name", "type", "tag"},
+	"func":   {"name", "recv"},
+	"param":  {"name", "type"},
+	"result": {"name", "type"},
+	"var":    {"name", "type", "value"},
+	"const":  {"name", "type", "value"},
+	"assign": {"lhs", "rhs", "tok"},
+	"call":   {"fun", "name"},
+	"kv":     {"key", "value"},
+	"return": nil,
+	"if":     nil,
+	"for":    nil,
+	"range":  nil,
+}
+
+// QueryMatch 查询到的节点，Parents 为从 *ast.File 到 Node 的直接父节点的完整节点链
+type QueryMatch struct {
+	Node    ast.Node
+	Parents []ast.Node
+}
+
+// Parent 返回直接父节点
+func (m QueryMatch) Parent() ast.Node {
+	if len(m.Parents) == 0 {
+		return nil
+	}
+	return m.Parents[len(m.Parents)-1]
+}
+
+// Selector 解析后的选择器
+type Selector struct {
+	parts []selectorPart
+}
+
+// selectorPart 一个节点选择条件，child 为 true 时要求是上一个条件所选节点的子节点
+type selectorPart struct {
+	child bool
+	kind  string
+	attrs []selectorAttr
+}
+
+type selectorAttr struct {
+	name  string
+	value string
+}
+
+// CompileQuery 解析选择器
+func CompileQuery(selector string) (*Selector, error) {
+	s := &Selector{}
+	rest := strings.TrimSpace(selector)
+	child := false
+	for rest != "" {
+		if rest[0] == '>' {
+			if child || len(s.parts) == 0 {
+				return nil, fmt.Errorf("query %q: unexpected >", selector)
+			}
+			child = true
+			rest = strings.TrimSpace(rest[1:])
+			continue
+		}
+		part, r, err := parseSelectorPart(rest)
+		if err != nil {
+			return nil, fmt.Errorf("query %q: %v", selector, err)
+		}
+		part.child = child
+		s.parts = append(s.parts, part)
+		child = false
+		rest = strings.TrimSpace(r)
+	}
+	if len(s.parts) == 0 || child {
+		return nil, fmt.Errorf("query %q: incomplete selector", selector)
+	}
+	return s, nil
+}
+
+// parseSelectorPart 解析一个节点选择条件，返回剩余的部分
+func parseSelectorPart(src string) (selectorPart, string, error) {
+	part := selectorPart{}
+	end := strings.IndexAny(src, "[> \t\n")
+	if end == -1 {
+		end = len(src)
+	}
+	part.kind, src = src[:end], src[end:]
+	attrs, known := queryAttrs[part.kind]
+	if !known && part.kind != "*" {
+		return part, "", fmt.Errorf("unknown node kind %q", part.kind)
+	}
+	for strings.HasPrefix(src, "[") {
+		eq := strings.IndexByte(src, '=')
+		if eq == -1 {
+			return part, "", fmt.Errorf("missing = in %s", src)
+		}
+		attr := selectorAttr{name: strings.TrimSpace(src[1:eq])}
+		if known && !hasString(attrs, attr.name) {
+			return part, "", fmt.Errorf("unknown attribute %q of %s", attr.name, part.kind)
+		}
+		src = strings.TrimLeft(src[eq+1:], " ")
+		if strings.HasPrefix(src, `"`) || strings.HasPrefix(src, "`") {
+			quoted, err := strconv.QuotedPrefix(src)
+			if err != nil {
+				return part, "", fmt.Errorf("invalid value %s", src)
+			}
+			attr.value, _ = strconv.Unquote(quoted)
+			src = strings.TrimLeft(src[len(quoted):], " ")
+		} else {
+			i := strings.IndexByte(src, ']')
+			if i == -1 {
+				return part, "", fmt.Errorf("missing ] in %s", src)
+			}
+			attr.value, src = strings.TrimSpace(src[:i]), src[i:]
+		}
+		if !strings.HasPrefix(src, "]") {
+			return part, "", fmt.Errorf("missing ] after %s", attr.name)
+		}
+		src = src[1:]
+		part.attrs = append(part.attrs, attr)
+	}
+	return part, src, nil
+}
+
+func hasString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Query 按选择器查询文件中的节点，结果按源码顺序排列
+//
+// 测试数据：
+//
+// func Func1(a string) (ret string) {
+//   var b = a
+//   ret = b
+//   return ret
+// }
+//
+// 执行：Query(f, "func[name=Func1] > assign[lhs=ret]")
+//
+// 结果为：ret = b 对应的 *ast.AssignStmt，Parents 为 *ast.File、*ast.FuncDecl、*ast.BlockStmt
+func Query(f *ast.File, selector string) ([]QueryMatch, error) {
+	s, err := CompileQuery(selector)
+	if err != nil {
+		return nil, err
+	}
+	return s.Match(f), nil
+}
+
+// Match 返回文件中匹配选择器的节点
+func (s *Selector) Match(f *ast.File) []QueryMatch {
+	matches := make([]QueryMatch, 0)
+	path := make([]ast.Node, 0)
+	// kinded 为 path 中能被选择的节点
+	kinded := make([]queryNode, 0)
+	ast.Inspect(f, func(node ast.Node) bool {
+		if node == nil {
+			last := path[len(path)-1]
+			path = path[:len(path)-1]
+			if len(kinded) > 0 && kinded[len(kinded)-1].node == last {
+				kinded = kinded[:len(kinded)-1]
+			}
+			return true
+		}
+		if kind := queryKind(node, path); kind != "" {
+			qn := queryNode{node: node, kind: kind}
+			last := len(s.parts) - 1
+			if s.parts[last].matches(qn) && s.matchAncestors(last-1, kinded, len(kinded), s.parts[last].child) {
+				parents := make([]ast.Node, len(path))
+				copy(parents, path)
+				matches = append(matches, QueryMatch{Node: node, Parents: parents})
+			}
+			kinded = append(kinded, qn)
+		}
+		path = append(path, node)
+		return true
+	})
+	return matches
+}
+
+// matchAncestors 判断 parts[:i+1] 能否从后往前依次匹配 ancestors[:j] 中的节点，
+// child 为 true 时 parts[i] 必须匹配 ancestors[j-1]
+func (s *Selector) matchAncestors(i int, ancestors []queryNode, j int, child bool) bool {
+	if i < 0 {
+		return true
+	}
+	for k := j - 1; k >= 0; k-- {
+		if s.parts[i].matches(ancestors[k]) && s.matchAncestors(i-1, ancestors, k, s.parts[i].child) {
+			return true
+		}
+		if child {
+			return false
+		}
+	}
+	return false
+}
+
+// queryNode 能被选择的节点及其类型
+type queryNode struct {
+	node ast.Node
+	kind string
+}
+
+func (p selectorPart) matches(qn queryNode) bool {
+	if p.kind != "*" && p.kind != qn.kind {
+		return false
+	}
+	for _, attr := range p.attrs {
+		if !hasString(queryValues(qn)[attr.name], attr.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryKind 返回节点在选择器中的类型，path 为节点的父节点链，不能被选择的节点返回空
+func queryKind(node ast.Node, path []ast.Node) string {
+	switch node.(type) {
+	case *ast.ImportSpec:
+		return "import"
+	case *ast.TypeSpec:
+		return "type"
+	case *ast.FuncDecl:
+		return "func"
+	case *ast.ValueSpec:
+		if gen, ok := path[len(path)-1].(*ast.GenDecl); ok && gen.Tok == token.CONST {
+			return "const"
+		}
+		return "var"
+	case *ast.AssignStmt:
+		return "assign"
+	case *ast.CallExpr:
+		return "call"
+	case *ast.KeyValueExpr:
+		return "kv"
+	case *ast.ReturnStmt:
+		return "return"
+	case *ast.IfStmt:
+		return "if"
+	case *ast.ForStmt:
+		return "for"
+	case *ast.RangeStmt:
+		return "range"
+	case *ast.Field:
+		if len(path) < 2 {
+			return ""
+		}
+		list := path[len(path)-1]
+		switch owner := path[len(path)-2].(type) {
+		case *ast.StructType, *ast.InterfaceType:
+			return "field"
+		case *ast.FuncType:
+			if list == ast.Node(owner.Results) {
+				return "result"
+			}
+			if list == ast.Node(owner.Params) {
+				return "param"
+			}
+		}
+	}
+	return ""
+}
+
+// queryValues 返回节点属性 => 属性的所有取值，如多个名称的成员每个名称都是 name 的取值
+func queryValues(qn queryNode) map[string][]string {
+	switch n := qn.node.(type) {
+	case *ast.ImportSpec:
+		info := importInfo(n)
+		return map[string][]string{"name": []string{info.Name}, "path": []string{info.Path}}
+	case *ast.TypeSpec:
+		kind := "type"
+		switch n.Type.(type) {
+		case *ast.StructType:
+			kind = "struct"
+		case *ast.InterfaceType:
+			kind = "interface"
+		default:
+			if n.Assign.IsValid() {
+				kind = "alias"
+			}
+		}
+		return map[string][]string{"name": []string{n.Name.Name}, "kind": []string{kind}}
+	case *ast.FuncDecl:
+		recv, _ := funcRecv(n)
+		return map[string][]string{"name": []string{n.Name.Name}, "recv": []string{recv}}
+	case *ast.Field:
+		tag := ""
+		if n.Tag != nil {
+			tag = structFieldInfos(n)[0].Tag
+		}
+		names := identNames(n.Names)
+		if len(names) == 0 {
+			names = []string{typeName(n.Type)}
+		}
+		return map[string][]string{"name": names, "type": []string{exprString(n.Type)}, "tag": []string{tag}}
+	case *ast.ValueSpec:
+		values := make([]string, 0, len(n.Values))
+		for _, v := range n.Values {
+			values = append(values, exprValues(v)...)
+		}
+		typ := ""
+		if n.Type != nil {
+			typ = exprString(n.Type)
+		}
+		return map[string][]string{"name": identNames(n.Names), "type": []string{typ}, "value": values}
+	case *ast.AssignStmt:
+		lhs, rhs := make([]string, 0), make([]string, 0)
+		for _, x := range n.Lhs {
+			lhs = append(lhs, exprString(x))
+		}
+		for _, x := range n.Rhs {
+			rhs = append(rhs, exprValues(x)...)
+		}
+		return map[string][]string{"lhs": lhs, "rhs": rhs, "tok": []string{n.Tok.String()}}
+	case *ast.CallExpr:
+		name := ""
+		switch fun := n.Fun.(type) {
+		case *ast.Ident:
+			name = fun.Name
+		case *ast.SelectorExpr:
+			name = fun.Sel.Name
+		}
+		return map[string][]string{"fun": []string{exprString(n.Fun)}, "name": []string{name}}
+	case *ast.KeyValueExpr:
+		return map[string][]string{"key": exprValues(n.Key), "value": exprValues(n.Value)}
+	}
+	return nil
+}
+
+func identNames(idents []*ast.Ident) []string {
+	names := make([]string, 0, len(idents))
+	for _, id := range idents {
+		names = append(names, id.Name)
+	}
+	return names
+}
+
+// exprValues 返回表达式的源码，字符串字面量同时返回去掉引号后的值
+func exprValues(expr ast.Expr) []string {
+	values := []string{exprString(expr)}
+	if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		if v, err := strconv.Unquote(lit.Value); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// ReplaceNode 用源码替换查询到的表达式或语句，语句源码只能包含一条语句
+//  替换时重新输出节点所属的声明，在节点的位置拼接 src 后重新解析，新节点带有真实的位置信息，
+//  同一声明中此前查询到的其他节点仍然有效（见 graftDecl），被替换的节点不再属于文件。文件没有关联 FileSet 时无法输出原声明，返回 false
+//
+// 测试数据：var mapStr = map[string]string{"cc": "cc"}
+//
+// 执行：
+//
+// m, _ := Query(f, `var[name=mapStr] > kv[key="cc"]`)
+//
+// ReplaceNode(f, m[0], `"dd": "dd"`)
+//
+// 结果为：var mapStr = map[string]string{"dd": "dd"}
+func ReplaceNode(f *ast.File, m QueryMatch, src string) bool {
+	var node ast.Node
+	switch m.Node.(type) {
+	case ast.Expr:
+		expr, err := parseQueryExpr(m.Node, src)
+		if err != nil {
+			return false
+		}
+		node = expr
+		// 按源码拼接时保持原来的运算优先级
+		if needsParen(m.Parent(), m.Node, expr) {
+			src = "(" + src + ")"
+		}
+	case ast.Stmt:
+		stmts, err := parseStmts(src)
+		if err != nil || len(stmts) != 1 {
+			return false
+		}
+		node = stmts[0]
+	default:
+		return false
+	}
+	if skipApplied(f, sameNode(m.Node, node)) {
+		return true
+	}
+	di := ownerDecl(f, m.Node)
+	if di == -1 {
+		return false
+	}
+	path, ok := nodePath(f.Decls[di], m.Node)
+	if !ok {
+		return false
+	}
+	source, ok := declSource(f, f.Decls[di])
+	if !ok {
+		return false
+	}
+	tmpFset := token.NewFileSet()
+	tmpF, err := parser.ParseFile(tmpFset, "", source, parser.ParseComments)
+	if err != nil || len(tmpF.Decls) != 1 {
+		return false
+	}
+	old := followPath(tmpF.Decls[0], path)
+	if old == nil {
+		return false
+	}
+	from, to := tmpFset.Position(old.Pos()).Offset, tmpFset.Position(old.End()).Offset
+	return replaceDeclSource(f, di, source, source[:from]+src+source[to:])
+}
+
+// needsParen 判断替换 old 的表达式在原位置按源码拼接时是否需要加括号
+func needsParen(parent, old ast.Node, expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.BinaryExpr:
+		switch p := parent.(type) {
+		case *ast.BinaryExpr, *ast.UnaryExpr, *ast.StarExpr:
+			return true
+		case *ast.SelectorExpr, *ast.IndexExpr, *ast.SliceExpr, *ast.TypeAssertExpr:
+			return true
+		case *ast.CallExpr:
+			return p.Fun == old
+		}
+	case *ast.UnaryExpr, *ast.StarExpr:
+		switch p := parent.(type) {
+		case *ast.SelectorExpr:
+			return p.X == old
+		case *ast.IndexExpr:
+			return p.X == old
+		case *ast.SliceExpr:
+			return p.X == old
+		case *ast.TypeAssertExpr:
+			return p.X == old
+		case *ast.CallExpr:
+			return p.Fun == old
+		}
+	}
+	return false
+}
+
+// parseQueryExpr 解析替换用的表达式，键值对需要放在字面量中解析
+func parseQueryExpr(old ast.Node, src string) (ast.Expr, error) {
+	if _, ok := old.(*ast.KeyValueExpr); !ok {
+		return parser.ParseExpr(src)
+	}
+	expr, err := parser.ParseExpr("T{" + src + "}")
+	if err != nil {
+		return nil, err
+	}
+	elts := expr.(*ast.CompositeLit).Elts
+	if len(elts) != 1 {
+		return nil, fmt.Errorf("%s is not a key-value pair", src)
+	}
+	if _, ok := elts[0].(*ast.KeyValueExpr); !ok {
+		return nil, fmt.Errorf("%s is not a key-value pair", src)
+	}
+	return elts[0], nil
+}
+
+// parseStmts 解析语句源码
+func parseStmts(src string) ([]ast.Stmt, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package p\nfunc _() {\n"+src+"\n}", 0)
+	if err != nil {
+		return nil, err
+	}
+	return file.Decls[0].(*ast.FuncDecl).Body.List, nil
+}
+
+// DeleteNode 从所在的列表中删除查询到的节点，如语句、struct 成员、字面量元素、变量声明、函数，
+// 删除后 var ( ... ) 等声明为空时一并删除
+//
+// 执行：
+//
+// m, _ := Query(f, "func[name=Func1] > assign[lhs=ret]")
+//
+// DeleteNode(f, m[0])
+//
+// 结果为：Func1 中的 ret = b 被删除
+func DeleteNode(f *ast.File, m QueryMatch) bool {
+	// 调用等表达式作为语句时删除整个语句
+	if stmt, ok := m.Parent().(*ast.ExprStmt); ok {
+		return DeleteNode(f, QueryMatch{Node: stmt, Parents: m.Parents[:len(m.Parents)-1]})
+	}
+	// 删除最后一个 spec 时删除整个声明
+	if gen, ok := m.Parent().(*ast.GenDecl); ok && len(gen.Specs) == 1 && len(m.Parents) >= 2 {
+		parents := m.Parents[:len(m.Parents)-1]
+		if stmt, ok := parents[len(parents)-1].(*ast.DeclStmt); ok {
+			return DeleteNode(f, QueryMatch{Node: stmt, Parents: parents[:len(parents)-1]})
+		}
+		return DeleteNode(f, QueryMatch{Node: gen, Parents: parents})
+	}
+	from, to := nodeRange(m.Node)
+	if !removeChild(m.Parent(), m.Node) {
+		return false
+	}
+	// 删除代码块的第一条语句后，下一条语句与 { 之间会多出空行，将 { 移到被删除语句的位置
+	if block, ok := m.Parent().(*ast.BlockStmt); ok && from.IsValid() && block.Lbrace < from && !hasStmtBefore(block, from) {
+		block.Lbrace = from
+	}
+	if from.IsValid() {
+		removeCommentsIn(f, from, to)
+	}
+	if decl, ok := m.Node.(ast.Decl); ok {
+		releaseDecl(decl)
+	}
+	return true
+}
+
+// hasStmtBefore 判断代码块中是否有位于 pos 之前的语句
+func hasStmtBefore(block *ast.BlockStmt, pos token.Pos) bool {
+	for _, stmt := range block.List {
+		if stmt.Pos().IsValid() && stmt.Pos() < pos {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeRange 返回节点连同文档注释的范围
+func nodeRange(node ast.Node) (token.Pos, token.Pos) {
+	from := node.Pos()
+	var doc *ast.CommentGroup
+	switch n := node.(type) {
+	case *ast.Field:
+		doc = n.Doc
+	case *ast.ValueSpec:
+		doc = n.Doc
+	case *ast.TypeSpec:
+		doc = n.Doc
+	case *ast.ImportSpec:
+		doc = n.Doc
+	case *ast.GenDecl:
+		doc = n.Doc
+	case *ast.FuncDecl:
+		doc = n.Doc
+	}
+	if doc != nil && doc.Pos().IsValid() {
+		from = doc.Pos()
+	}
+	return from, node.End()
+}
+
+// removeChild 从父节点的列表中删除 node
+func removeChild(parent, node ast.Node) bool {
+	if parent == nil {
+		return false
+	}
+	v := reflect.ValueOf(parent).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		list := v.Field(i)
+		if list.Kind() != reflect.Slice {
+			continue
+		}
+		for j := 0; j < list.Len(); j++ {
+			if elem := list.Index(j); elem.CanInterface() && elem.Interface() == node {
+				list.Set(reflect.AppendSlice(list.Slice(0, j), list.Slice(j+1, list.Len())))
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eachChild 遍历父节点中的 ast.Node 成员及列表元素，fn 返回 true 时停止
+func eachChild(parent ast.Node, fn func(v reflect.Value) bool) {
+	if parent == nil {
+		return
+	}
+	v := reflect.ValueOf(parent).Elem()
+	nodeType := reflect.TypeOf((*ast.Node)(nil)).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				if elem := field.Index(j); elem.Type().Implements(nodeType) && !elem.IsNil() && fn(elem) {
+					return
+				}
+			}
+		case (field.Kind() == reflect.Interface || field.Kind() == reflect.Ptr) && field.Type().Implements(nodeType):
+			if !field.IsNil() && fn(field) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	fst, f := InitEnv("./test_demo/query_demo.go")
+
+	// 子节点只匹配函数体中直接的赋值语句，if 中的赋值不匹配
+	m, err := Query(f, "func[name=Func1] > assign[lhs=ret]")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+	assert.Equal(t, "ret = b", exprString(m[0].Node))
+	assert.Equal(t, f, m[0].Parents[0])
+	_, ok := m[0].Parents[1].(*ast.FuncDecl)
+	assert.True(t, ok)
+	_, ok = m[0].Parent().(*ast.BlockStmt)
+	assert.True(t, ok)
+
+	// 后代匹配所有的赋值语句
+	m, err = Query(f, "func[name=Func1] assign[lhs=ret]")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(m))
+
+	m, err = Query(f, "type[name=Stu] field[name=Name]")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+	m, err = Query(f, "type[kind=struct] > field[tag=`json:\"name\"`]")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+
+	m, err = Query(f, `var[name=mapStr] > kv[key="cc"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+	m, err = Query(f, `var[name=mapStr] > kv[key=dd]`)
+	assert.NoError(t, err)
+	assert.Equal(t, `"dd": "dd"`, exprString(m[0].Node))
+
+	m, err = Query(f, "func param[name=a][type=string]")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+	m, err = Query(f, "call[fun=fmt.Println]")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+	m, err = Query(f, "const[name=A]")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+	m, err = Query(f, "* > return")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m))
+
+	for _, selector := range []string{"", "> func", "func >", "unknown", "func[nmae=a]", "func[name=a", `kv[key="a]`} {
+		_, err = Query(f, selector)
+		assert.Error(t, err, selector)
+	}
+	PrintResult(fst, f)
+}
+
+func TestReplaceNode(t *testing.T) {
+	fst, f := InitEnv("./test_demo/query_demo.go")
+	m, _ := Query(f, `var[name=mapStr] > kv[key="cc"]`)
+	assert.True(t, ReplaceNode(f, m[0], `"ee": "ee"`))
+	m, _ = Query(f, "func[name=Func1] > assign[lhs=ret]")
+	assert.True(t, ReplaceNode(f, m[0], "ret = b + a"))
+	m, _ = Query(f, "func[name=Func1] > return")
+	assert.False(t, ReplaceNode(f, m[0], "a := 1\nb := 2"))
+
+	// 多行的语句使用重新解析得到的位置输出
+	m, _ = Query(f, "func[name=Func1] > if")
+	assert.True(t, ReplaceNode(f, m[0], "if a == \"\" {\nret = \"-\"\n} else {\nret = a\n}"))
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), `var mapStr = map[string]string{"ee": "ee", "dd": "dd"}`)
+	assert.Contains(t, string(src), "\tret = b + a\n\tif a == \"\" {\n\t\tret = \"-\"\n\t} else {\n\t\tret = a\n\t}\n\tfmt.Println(ret)\n")
+	PrintResult(fst, f)
+}
+
+func TestReplaceNodeParen(t *testing.T) {
+	fst, f := InitEnv("./test_demo/query_demo.go")
+
+	// 表达式按源码拼接时保持原来的优先级
+	m, _ := Query(f, "func[name=Func1] > if")
+	cond := m[0].Node.(*ast.IfStmt).Cond.(*ast.BinaryExpr)
+	assert.True(t, ReplaceNode(f, QueryMatch{Node: cond.X, Parents: append(m[0].Parents, m[0].Node, cond)}, `a + "x"`))
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "\tif (a + \"x\") != \"\" {\n")
+}
+
+func TestDeleteNode(t *testing.T) {
+	fst, f := InitEnv("./test_demo/query_demo.go")
+	m, _ := Query(f, "type[name=Stu] > field[name=Name]")
+	assert.True(t, DeleteNode(f, m[0]))
+	m, _ = Query(f, "func[name=Func1] > call")
+	assert.True(t, DeleteNode(f, m[0]))
+	m, _ = Query(f, "func[name=Func1] > var[name=b]")
+	assert.True(t, DeleteNode(f, m[0]))
+	// const ( ... ) 为空时删除整个声明
+	m, _ = Query(f, "const[name=A]")
+	assert.True(t, DeleteNode(f, m[0]))
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(src), "Name")
+	assert.NotContains(t, string(src), "fmt.Println")
+	assert.Contains(t, string(src), "func Func1(a string) (ret string) {\n\tret = b\n")
+	assert.NotContains(t, string(src), "const")
+	PrintResult(fst, f)
+}
@@ -0,0 +1,328 @@
+package ozastutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// Recipe 声明式的修改步骤，用 JSON 编写；yaml 标签供命令行 astutil recipe 解析 YAML 格式的 recipe，库本身只解析 JSON
+//
+// 例子：
+//
+//	{
+//	  "file": "router.go",
+//	  "idempotent": true,
+//	  "steps": [
+//	    {"op": "add_import", "path": "github.com/gin-gonic/gin"},
+//	    {"op": "add_call_block", "func": "Register", "calls": [{"fun": "r", "sel": "GET", "args": ["\"/demo\"", "demo.Get"]}]},
+//	    {"op": "add_struct_field", "file": "model.go", "struct": "Demo", "name": "Age", "type": "int"}
+//	  ]
+//	}
+type Recipe struct {
+	// File 步骤没有指定文件时使用的目标文件
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	// Idempotent 为 true 时以幂等模式执行，重复执行时已存在的修改记为 unchanged
+	Idempotent bool `json:"idempotent,omitempty" yaml:"idempotent,omitempty"`
+	// Steps 按顺序执行的步骤
+	Steps []RecipeStep `json:"steps" yaml:"steps"`
+}
+
+// RecipeStep 一个修改步骤，Op 为操作名称，各操作使用的参数见 recipeOps
+type RecipeStep struct {
+	Op   string `json:"op" yaml:"op"`
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+
+	Name    string       `json:"name,omitempty" yaml:"name,omitempty"`
+	NewName string       `json:"new_name,omitempty" yaml:"new_name,omitempty"`
+	Path    string       `json:"path,omitempty" yaml:"path,omitempty"`
+	Struct  string       `json:"struct,omitempty" yaml:"struct,omitempty"`
+	Func    string       `json:"func,omitempty" yaml:"func,omitempty"`
+	Var     string       `json:"var,omitempty" yaml:"var,omitempty"`
+	Key     string       `json:"key,omitempty" yaml:"key,omitempty"`
+	Value   string       `json:"value,omitempty" yaml:"value,omitempty"`
+	Type    string       `json:"type,omitempty" yaml:"type,omitempty"`
+	Tag     string       `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Recv    string       `json:"recv,omitempty" yaml:"recv,omitempty"`
+	Params  []RecipeKv   `json:"params,omitempty" yaml:"params,omitempty"`
+	Results []RecipeKv   `json:"results,omitempty" yaml:"results,omitempty"`
+	Body    string       `json:"body,omitempty" yaml:"body,omitempty"`
+	Doc     []string     `json:"doc,omitempty" yaml:"doc,omitempty"`
+	Calls   []RecipeCall `json:"calls,omitempty" yaml:"calls,omitempty"`
+	After   string       `json:"after,omitempty" yaml:"after,omitempty"`
+	Before  string       `json:"before,omitempty" yaml:"before,omitempty"`
+	Marker  string       `json:"marker,omitempty" yaml:"marker,omitempty"`
+}
+
+// RecipeKv 参数或返回值，name 可以为空
+type RecipeKv struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	Type string `json:"type" yaml:"type"`
+}
+
+// RecipeCall add_call_block 中的一个调用，如 r.GET("/demo", demo.Get)
+type RecipeCall struct {
+	Fun  string   `json:"fun" yaml:"fun"`
+	Sel  string   `json:"sel" yaml:"sel"`
+	Args []string `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// StepResult 步骤的执行结果
+type StepResult struct {
+	Index  int        `json:"index"`
+	Op     string     `json:"op"`
+	File   string     `json:"file"`
+	Result EditResult `json:"result"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// recipeOp 执行一个步骤，返回修改类 API 的结果
+type recipeOp func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool
+
+// recipeOps 操作名称 => 对应的修改类 API
+var recipeOps = map[string]recipeOp{
+	// add_import: name, path
+	"add_import": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddImport(fset, f, s.Name, s.Path)
+	},
+	// add_struct_field: struct, name, type, marker
+	"add_struct_field": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddKVToStruct(f, s.Struct, s.Name, s.Type, s.Marker)
+	},
+	// add_interface_method: struct, name, params, results, marker
+	"add_interface_method": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddFuncToInterface(f, s.Struct, s.astFunc(f), s.Marker)
+	},
+	// add_var: name, value, after
+	"add_var": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddVarAfterVar(f, s.Name, s.Value, s.After)
+	},
+	// define_var: name, type, after
+	"define_var": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return DefineVarAfterVar(f, s.Name, s.Type, s.After)
+	},
+	// add_value_to_map: var, key, value, marker
+	"add_value_to_map": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddValueToMap(f, s.Var, s.Key, s.Value, s.Marker)
+	},
+	// add_value_to_slice: var, value, marker
+	"add_value_to_slice": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddValueToSlice(f, s.Var, s.Value, s.Marker)
+	},
+	// add_value_to_caller: var, value, marker
+	"add_value_to_caller": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddValueToCaller(f, s.Var, s.Value, s.Marker)
+	},
+	// add_kv_to_struct_var: var, key, value, marker
+	"add_kv_to_struct_var": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddKVToUnaryStruct(f, s.Var, s.Key, s.Value, s.Marker)
+	},
+	// add_func: name, recv, params, results, body, doc, after/before/marker
+	"add_func": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		var pos *AstInsertPos
+		if s.After != "" || s.Before != "" || s.Marker != "" {
+			pos = &AstInsertPos{After: s.After, Before: s.Before, Marker: s.Marker}
+		}
+		return AddFuncAt(f, s.astFunc(f), pos)
+	},
+	// delete_func: name
+	"delete_func": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return DeleteFunc(f, s.Name)
+	},
+	// rename_func: name, new_name
+	"rename_func": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return RenameFunc(f, s.Name, s.NewName)
+	},
+	// replace_func: name, body（完整的函数源码）
+	"replace_func": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return ReplaceFunc(f, s.Name, s.Body)
+	},
+	// add_param: func, name, type
+	"add_param": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddParamToFunc(f, s.Func, s.Name, s.Type)
+	},
+	// add_var_to_func: func, name, value, after, tag（var、define 或 assign，默认 var）
+	"add_var_to_func": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		tag := s.Tag
+		if tag == "" {
+			tag = "var"
+		}
+		return AddVarToFunc(f, s.Func, s.Name, s.Value, s.After, tag)
+	},
+	// add_kv_to_func_struct: func, var, key, value, marker
+	"add_kv_to_func_struct": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		return AddKVToFuncUnaryStruct(f, s.Func, s.Var, s.Key, s.Value, s.Marker)
+	},
+	// add_call_block: func, calls, after
+	"add_call_block": func(fset *token.FileSet, f *ast.File, s *RecipeStep) bool {
+		calls := make([]AstCallExpr, 0, len(s.Calls))
+		for _, c := range s.Calls {
+			calls = append(calls, AstCallExpr{FunName: c.Fun, FunSel: c.Sel, Args: c.Args})
+		}
+		return AddCallBlockToFunc(f, s.Func, calls, s.After)
+	},
+}
+
+// RecipeOps 返回支持的操作名称
+func RecipeOps() []string {
+	ops := make([]string, 0, len(recipeOps))
+	for op := range recipeOps {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// astFunc 将步骤中的函数参数转换为 AstFunc，接收者名称与类型已有的方法保持一致
+func (s *RecipeStep) astFunc(f *ast.File) *AstFunc {
+	params := &AstFunc{Name: s.Name, Body: s.Body, Doc: s.Doc}
+	if s.Recv != "" {
+		recvType := s.Recv
+		if expr, err := parser.ParseExpr(s.Recv); err == nil {
+			recvType = typeName(expr)
+		}
+		params.Recv = &AstKv{Key: recvNameOf(typeMethodList([]*ast.File{f}, recvType), recvType), Value: s.Recv}
+	}
+	for _, kv := range s.Params {
+		params.Params = append(params.Params, AstKv{Key: kv.Name, Value: kv.Type})
+	}
+	for _, kv := range s.Results {
+		params.Results = append(params.Results, AstKv{Key: kv.Name, Value: kv.Type})
+	}
+	return params
+}
+
+// ParseRecipe 解析 JSON 格式的 recipe，未知的字段及操作视为错误
+func ParseRecipe(data []byte) (*Recipe, error) {
+	recipe := &Recipe{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(recipe); err != nil {
+		return nil, err
+	}
+	if err := recipe.Validate(); err != nil {
+		return nil, err
+	}
+	return recipe, nil
+}
+
+// Validate 检查步骤的操作是否存在，以及每个步骤是否都有目标文件
+func (r *Recipe) Validate() error {
+	for i, step := range r.Steps {
+		if _, ok := recipeOps[step.Op]; !ok {
+			return fmt.Errorf("step %d: unknown op %q", i, step.Op)
+		}
+		if step.File == "" && r.File == "" {
+			return fmt.Errorf("step %d: no target file", i)
+		}
+	}
+	return nil
+}
+
+// ApplyRecipe 在已加载的文件上按顺序执行 recipe 的步骤，files 为目标文件路径 => 文件
+//
+//	步骤失败时继续执行后续步骤，结果中记录每个步骤的执行情况
+func ApplyRecipe(fset *token.FileSet, files map[string]*ast.File, recipe *Recipe) []StepResult {
+	results := make([]StepResult, 0, len(recipe.Steps))
+	for i := range recipe.Steps {
+		step := &recipe.Steps[i]
+		path := step.File
+		if path == "" {
+			path = recipe.File
+		}
+		result := StepResult{Index: i, Op: step.Op, File: path}
+		f, ok := files[path]
+		op, known := recipeOps[step.Op]
+		switch {
+		case !known:
+			result.Error = fmt.Sprintf("unknown op %q", step.Op)
+		case !ok:
+			result.Error = fmt.Sprintf("file %s not loaded", path)
+		case recipe.Idempotent:
+			result.Result = Ensure(f, func() bool {
+				return op(fset, f, step)
+			})
+		default:
+			result.Result = runEdit(f, func() bool {
+				return op(fset, f, step)
+			})
+		}
+		if result.Error == "" && result.Result == EditFailed {
+			result.Error = fmt.Sprintf("%s failed", step.Op)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// RunRecipe 读取并执行 JSON 格式的 recipe 文件，目标文件的相对路径相对于 recipe 文件所在的目录
+//
+//	所有步骤都成功且 write 为 true 时将修改过的文件写回原处，有步骤失败时不写入任何文件并返回错误
+func RunRecipe(path string, write bool) ([]StepResult, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	recipe, err := ParseRecipe(data)
+	if err != nil {
+		return nil, err
+	}
+	return ExecRecipe(recipe, filepath.Dir(path), write)
+}
+
+// ExecRecipe 加载目标文件并执行已解析的 recipe，目标文件的相对路径相对于 dir，执行完后释放加载的文件
+//
+//	写入规则同 RunRecipe，用于执行由其他格式（如命令行解析的 YAML）得到的 recipe
+func ExecRecipe(recipe *Recipe, dir string, write bool) ([]StepResult, error) {
+	fset := token.NewFileSet()
+	files := make(map[string]*ast.File)
+	defer func() {
+		for _, f := range files {
+			ReleaseFile(f)
+		}
+	}()
+	for _, step := range recipe.Steps {
+		name := step.File
+		if name == "" {
+			name = recipe.File
+		}
+		if _, ok := files[name]; ok {
+			continue
+		}
+		target := name
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		f, err := parseFile(fset, target)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = f
+	}
+	results := ApplyRecipe(fset, files, recipe)
+	changed := make(map[string]bool)
+	for _, result := range results {
+		if result.Error != "" {
+			return results, fmt.Errorf("step %d (%s): %s", result.Index, result.Op, result.Error)
+		}
+		if result.Result == EditApplied {
+			changed[result.File] = true
+		}
+	}
+	if !write {
+		return results, nil
+	}
+	for name := range changed {
+		f := files[name]
+		if err := WriteToFile(fset, f, fset.Position(f.Package).Filename); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,123 @@
+package ozastutil
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const recipeJSON = `{
+	"file": "edit",
+	"idempotent": true,
+	"steps": [
+		{"op": "add_import", "path": "strings"},
+		{"op": "add_struct_field", "struct": "Stu", "name": "Age", "type": "int"},
+		{"op": "add_value_to_slice", "var": "routes", "value": "\"/a\""},
+		{"op": "add_value_to_map", "var": "handlers", "key": "\"b\"", "value": "2"},
+		{"op": "add_func", "name": "Hello", "recv": "*Stu", "results": [{"type": "string"}], "body": "return s.Name", "after": "Setup"},
+		{"op": "add_call_block", "func": "Setup", "calls": [{"fun": "fmt", "sel": "Println", "args": ["\"setup\""]}]},
+		{"op": "add_param", "func": "NotFound", "name": "n", "type": "int"}
+	]
+}`
+
+func TestApplyRecipe(t *testing.T) {
+	fst, f := InitEnv("./test_demo/edit_demo.go")
+	recipe, err := ParseRecipe([]byte(recipeJSON))
+	assert.NoError(t, err)
+
+	files := map[string]*ast.File{"edit": f}
+	results := ApplyRecipe(fst, files, recipe)
+	assert.Equal(t, 7, len(results))
+	for _, result := range results[:6] {
+		assert.Equal(t, EditApplied, result.Result)
+		assert.Equal(t, "", result.Error)
+	}
+	assert.Equal(t, EditFailed, results[6].Result)
+	assert.Equal(t, "add_param failed", results[6].Error)
+
+	// 再次执行时修改都已存在
+	results = ApplyRecipe(fst, files, recipe)
+	for _, result := range results[:6] {
+		assert.Equal(t, EditUnchanged, result.Result)
+	}
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "\t\"strings\"\n")
+	assert.Contains(t, string(src), "\tAge  int\n")
+	assert.Contains(t, string(src), `var routes = []string{"/", "/a"}`)
+	assert.Contains(t, string(src), `var handlers = map[string]int{"a": 1, "b": 2}`)
+	assert.Contains(t, string(src), "func (s *Stu) Hello() string {\n\treturn s.Name\n}")
+	assert.Contains(t, string(src), "\t\tfmt.Println(\"setup\")\n")
+
+	data, err := json.Marshal(results[6])
+	assert.NoError(t, err)
+	assert.Equal(t, `{"index":6,"op":"add_param","file":"edit","result":"failed","error":"add_param failed"}`, string(data))
+	PrintResult(fst, f)
+}
+
+func TestParseRecipe(t *testing.T) {
+	recipe, err := ParseRecipe([]byte(`{"file": "a.go", "steps": [{"op": "delete_func", "name": "Old"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "a.go", recipe.File)
+	assert.Equal(t, "delete_func", recipe.Steps[0].Op)
+
+	_, err = ParseRecipe([]byte(`{"file": "a.go", "steps": [{"op": "unknown"}]}`))
+	assert.Error(t, err)
+	_, err = ParseRecipe([]byte(`{"steps": [{"op": "delete_func", "name": "Old"}]}`))
+	assert.Error(t, err)
+	_, err = ParseRecipe([]byte(`{"file": "a.go", "steps": [{"op": "delete_func", "nmae": "Old"}]}`))
+	assert.Error(t, err)
+	// 库只解析 JSON，YAML 由命令行解析
+	_, err = ParseRecipe([]byte("file: a.go\nsteps:\n  - op: delete_func\n    name: Old\n"))
+	assert.Error(t, err)
+	assert.Contains(t, RecipeOps(), "add_call_block")
+}
+
+func TestRunRecipe(t *testing.T) {
+	target, err := filepath.Abs("./test_demo/edit_demo.go")
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "recipe.json")
+	recipe := `{"file": "` + target + `", "steps": [
+		{"op": "add_kv_to_struct_var", "var": "conf", "key": "Name", "value": "\"conf\""},
+		{"op": "rename_func", "name": "Rename", "new_name": "Renamed"}
+	]}`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(recipe), 0644))
+
+	// 不写入文件
+	results, err := RunRecipe(path, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, EditApplied, results[1].Result)
+	// 执行完后释放加载的文件
+	fileSets.Range(func(k, v interface{}) bool {
+		f, fset := k.(*ast.File), v.(*token.FileSet)
+		assert.NotEqual(t, target, fset.Position(f.Package).Filename)
+		return true
+	})
+
+	recipe = `{"file": "` + target + `", "steps": [{"op": "delete_func", "name": "NotFound"}]}`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(recipe), 0644))
+	_, err = RunRecipe(path, true)
+	assert.Error(t, err)
+}
+
+func TestApplyRecipeResetUnchanged(t *testing.T) {
+	fst, f := InitEnv("./test_demo/edit_demo.go")
+	SetIdempotent(f, true)
+
+	// 直接调用的修改已存在，没有通过 Result 取走结果
+	assert.True(t, AddImport(fst, f, "", "fmt"))
+	// 重命名不检查是否已存在，结果不能沿用上一次修改的 unchanged
+	recipe := &Recipe{File: "edit", Steps: []RecipeStep{{Op: "rename_func", Name: "Old", NewName: "New"}}}
+	results := ApplyRecipe(fst, map[string]*ast.File{"edit": f}, recipe)
+	assert.Equal(t, EditApplied, results[0].Result)
+
+	s := NewSession(fst, f)
+	assert.True(t, AddImport(fst, f, "", "fmt"))
+	assert.Equal(t, EditApplied, s.Apply(RecipeStep{Op: "rename_func", Name: "New", NewName: "Newer"}).Result)
+}
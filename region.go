@@ -0,0 +1,468 @@
+package ozastutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// 托管区域
+//
+// 手写文件中可以用下面两行注释圈出一段由工具维护的代码：
+//
+//	// Code generated by astutil BEGIN models checksum:0123456789abcdef
+//	...
+//	// END models
+//
+// 区域可以位于文件级别（内容为声明）或函数内（内容为语句）。替换时区域的内容整体更新，区域之外保持不变。
+// BEGIN 行记录区域内容的校验和（忽略空白），再次替换时校验和不一致说明区域被手动修改过。
+
+const (
+	regionBegin = "Code generated by astutil BEGIN"
+	regionEnd   = "END"
+)
+
+// ErrRegionModified 托管区域的内容与记录的校验和不一致
+var ErrRegionModified = errors.New("region modified manually")
+
+// AstRegionOption 托管区域的选项
+type AstRegionOption struct {
+	// Pos 文件级别的区域不存在时的创建位置，为 nil 时添加到文件末尾
+	Pos *AstInsertPos
+	// AfterVar 函数内的区域不存在时的创建位置，规则同 RenderStmts 的 afterVar
+	AfterVar string
+	// Force 区域被手动修改过时仍然替换
+	Force bool
+}
+
+// ReplaceRegion 将文件级别托管区域 name 的内容替换为源码 src 中的声明，区域不存在时按 opt.Pos 创建
+//  区域被手动修改过且没有设置 opt.Force 时返回 ErrRegionModified，src 不合法时返回解析错误。
+//  只重新输出区域内的声明及 BEGIN、END 注释，替换后区域的内容和这两行注释一起作为新声明插入原来的位置，
+//  区域之外的声明保持不变。src 中没有声明时区域的注释需要依附在相邻的声明上，该声明一并重新输出
+//
+// 测试数据：
+//
+// // Code generated by astutil BEGIN models
+// type Old struct{}
+// // END models
+//
+// 执行：ReplaceRegion(fset, f, "models", "type New struct{}", nil)
+//
+// 结果为：
+//
+// // Code generated by astutil BEGIN models checksum:...
+// type New struct{}
+// // END models
+func ReplaceRegion(fset *token.FileSet, f *ast.File, name, src string, opt *AstRegionOption) error {
+	if opt == nil {
+		opt = &AstRegionOption{}
+	}
+	tmpF, err := parser.ParseFile(token.NewFileSet(), "", "package p\n\n"+src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	items := regionItems(f)
+	u, hint := findFileRegion(f, items, name), token.NoPos
+	if u == nil {
+		// 区域不存在时在插入位置创建，参考位置为插入位置之后的声明或标记注释
+		index := getInsertIndex(f, opt.Pos, "", "")
+		if opt.Pos != nil && opt.Pos.Marker != "" {
+			var c *ast.Comment
+			if index, c = findDeclMarker(f, opt.Pos.Marker); c != nil {
+				hint = c.Pos()
+			}
+		}
+		if index == -1 {
+			return fmt.Errorf("anchor not found")
+		}
+		u = &regionUnit{lo: index, hi: index, first: len(items), last: -1}
+		for i, item := range items {
+			if item.decl >= index || item.slot > index {
+				u.first, u.last = i, i-1
+				break
+			}
+		}
+		if !hint.IsValid() && index < len(f.Decls) && !isNewDecl(f.Decls[index]) {
+			hint, _ = declRange(f.Decls[index])
+		}
+	}
+	if len(tmpF.Decls) == 0 && !u.extend(items, len(f.Decls)) {
+		return fmt.Errorf("region %s: no declaration to keep the region comments", name)
+	}
+	source, err := u.source(fset, f, items)
+	if err != nil {
+		return err
+	}
+	source, err = spliceRegion(source, name, src, "\n", opt.Force, func(tmpFset *token.FileSet, tmpF *ast.File) ([]*ast.CommentGroup, int, error) {
+		var comments []*ast.CommentGroup
+		for _, cg := range tmpF.Comments {
+			if !isInDecl(tmpF, cg.Pos()) {
+				comments = append(comments, cg)
+			}
+		}
+		return comments, int(tmpF.FileEnd - tmpF.FileStart), nil
+	})
+	if err != nil {
+		return err
+	}
+	decls, err := parseDecls(source)
+	if err != nil {
+		return err
+	}
+	if !hint.IsValid() {
+		hint = u.pos(f, items)
+	}
+	removed := make(map[*ast.CommentGroup]bool)
+	for i := u.first; i <= u.last; i++ {
+		if items[i].decl == -1 {
+			removed[items[i].cg] = true
+		}
+	}
+	for _, decl := range f.Decls[u.lo:u.hi] {
+		removeComments(f, decl)
+		releaseDecl(decl)
+	}
+	list := f.Comments[:0]
+	for _, cg := range f.Comments {
+		if !removed[cg] {
+			list = append(list, cg)
+		}
+	}
+	f.Comments = list
+	for _, decl := range decls {
+		if hint.IsValid() {
+			setDeclHint(decl, hint)
+		}
+	}
+	f.Decls = append(f.Decls[:u.lo], append(decls, f.Decls[u.hi:]...)...)
+	return nil
+}
+
+// regionItem 文件级别的注释，decl 为注释所属声明的下标，游离注释为 -1，slot 为注释之后第一个声明的下标
+type regionItem struct {
+	cg   *ast.CommentGroup
+	decl int
+	slot int
+}
+
+// regionItems 按输出顺序返回文件中 package 子句之后的注释，新声明的注释为其源码片段中的注释，
+// 游离注释与新声明的先后顺序同 formatFile
+func regionItems(f *ast.File) []regionItem {
+	var items []regionItem
+	comments, ci := f.Comments, 0
+	for ci < len(comments) && comments[ci].Pos() < f.Name.End() {
+		ci++
+	}
+	for i, decl := range f.Decls {
+		if !isNewDecl(decl) {
+			from, to := declRange(decl)
+			for ; ci < len(comments) && comments[ci].End() <= from; ci++ {
+				items = append(items, regionItem{cg: comments[ci], decl: -1, slot: i})
+			}
+			for ; ci < len(comments) && comments[ci].Pos() < to; ci++ {
+				items = append(items, regionItem{cg: comments[ci], decl: i, slot: i})
+			}
+			continue
+		}
+		if pos := declHint(decl); pos.IsValid() {
+			for ; ci < len(comments) && comments[ci].Pos() < pos; ci++ {
+				items = append(items, regionItem{cg: comments[ci], decl: -1, slot: i})
+			}
+		}
+		if s, ok := snippets.Load(decl); ok {
+			for _, cg := range s.(*snippet).comments {
+				items = append(items, regionItem{cg: cg, decl: i, slot: i})
+			}
+		}
+	}
+	for ; ci < len(comments); ci++ {
+		items = append(items, regionItem{cg: comments[ci], decl: -1, slot: len(f.Decls)})
+	}
+	return items
+}
+
+// regionUnit 重新输出的范围：下标 [lo, hi) 的声明及下标 [first, last] 的注释
+type regionUnit struct {
+	lo, hi      int
+	first, last int
+}
+
+// findFileRegion 查找文件级别的区域，区域注释不能位于声明内部
+func findFileRegion(f *ast.File, items []regionItem, name string) *regionUnit {
+	u := &regionUnit{first: -1, last: -1}
+	for i, item := range items {
+		if item.decl != -1 && !isDeclDoc(f.Decls[item.decl], item.cg) {
+			continue
+		}
+		for _, c := range item.cg.List {
+			text := markerText(c.Text)
+			switch {
+			case u.first == -1 && strings.HasPrefix(text, regionBegin+" "):
+				if fields := strings.Fields(strings.TrimPrefix(text, regionBegin)); len(fields) > 0 && fields[0] == name {
+					u.first, u.lo = i, item.slot
+				}
+			case u.first != -1 && text == regionEnd+" "+name:
+				u.last, u.hi = i, item.slot
+				if item.decl != -1 {
+					u.hi = item.decl + 1
+				}
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+// isDeclDoc 判断注释是否位于声明之前或之后，而不是声明内部
+func isDeclDoc(decl ast.Decl, cg *ast.CommentGroup) bool {
+	if _, ok := snippets.Load(decl); ok {
+		return cg.End() <= decl.Pos() || cg.Pos() >= decl.End()
+	}
+	return cg.End() <= decl.Pos()
+}
+
+// extend 区域中没有声明时将相邻的一个声明及其与区域之间的注释加入范围，没有其他声明时返回 false
+func (u *regionUnit) extend(items []regionItem, n int) bool {
+	switch {
+	case u.hi < n:
+		u.hi++
+		for i := u.last + 1; i < len(items) && (items[i].decl == u.hi-1 || items[i].decl == -1 && items[i].slot < u.hi); i++ {
+			u.last = i
+		}
+	case u.lo > 0:
+		u.lo--
+		for i := u.first - 1; i >= 0 && (items[i].decl == u.lo || items[i].decl == -1 && items[i].slot > u.lo); i-- {
+			u.first = i
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// source 输出范围内的声明及游离注释，源码以 package p 开头，原有声明之间保持原有的空行
+func (u *regionUnit) source(fset *token.FileSet, f *ast.File, items []regionItem) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString("package p\n")
+	last := token.NoPos
+	free := func(slot int) {
+		for i := u.first; i <= u.last; i++ {
+			if items[i].decl == -1 && items[i].slot == slot {
+				writeDeclSep(&buf, fset, last, items[i].cg.Pos())
+				writeComments(&buf, []*ast.CommentGroup{items[i].cg})
+				last = items[i].cg.End()
+			}
+		}
+	}
+	for i := u.lo; i < u.hi; i++ {
+		free(i)
+		decl := f.Decls[i]
+		if isNewDecl(decl) {
+			writeDeclSep(&buf, fset, last, token.NoPos)
+			if err := formatNewDecl(&buf, fset, decl); err != nil {
+				return "", err
+			}
+			last = token.NoPos
+		} else {
+			from, to := declRange(decl)
+			writeDeclSep(&buf, fset, last, from)
+			if err := format.Node(&buf, fset, &printer.CommentedNode{Node: decl, Comments: declComments(f, decl)}); err != nil {
+				return "", err
+			}
+			last = to
+		}
+		buf.WriteString("\n")
+	}
+	free(u.hi)
+	return buf.String(), nil
+}
+
+// pos 返回范围内第一个有位置信息的注释或声明的位置，作为新声明的参考位置
+func (u *regionUnit) pos(f *ast.File, items []regionItem) token.Pos {
+	for i := u.lo; i <= u.hi; i++ {
+		for j := u.first; j <= u.last; j++ {
+			if items[j].decl == -1 && items[j].slot == i {
+				return items[j].cg.Pos()
+			}
+		}
+		if i == u.hi {
+			break
+		}
+		if isNewDecl(f.Decls[i]) {
+			if pos := declHint(f.Decls[i]); pos.IsValid() {
+				return pos
+			}
+			continue
+		}
+		from, _ := declRange(f.Decls[i])
+		return from
+	}
+	return token.NoPos
+}
+
+// ReplaceFuncRegion 将函数 funcName 内托管区域 name 的内容替换为源码 src 中的语句，区域不存在时按 opt.AfterVar 创建
+//  区域被手动修改过且没有设置 opt.Force 时返回 ErrRegionModified，src 不合法时返回解析错误
+//
+// 测试数据：
+//
+// func t() {
+//	var a = 1
+//	return
+// }
+//
+// 执行：ReplaceFuncRegion(fset, f, "t", "print", "fmt.Println(a)", &AstRegionOption{AfterVar: "a"})
+//
+// 结果为：
+//
+// func t() {
+//	var a = 1
+//	// Code generated by astutil BEGIN print checksum:...
+//	fmt.Println(a)
+//	// END print
+//	return
+// }
+func ReplaceFuncRegion(fset *token.FileSet, f *ast.File, funcName, name, src string, opt *AstRegionOption) error {
+	if opt == nil {
+		opt = &AstRegionOption{}
+	}
+	index, fd := findFunc(f, funcName)
+	if fd == nil || fd.Body == nil {
+		return fmt.Errorf("func %s not found", funcName)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", "package p\n\nfunc _() {\n"+src+"\n}\n", parser.ParseComments); err != nil {
+		return err
+	}
+	BindFileSet(fset, f)
+	out, ok := declSource(f, fd)
+	if !ok {
+		return fmt.Errorf("func %s can not be printed", funcName)
+	}
+	source, err := spliceRegion(out, name, src, "", opt.Force, func(tmpFset *token.FileSet, tmpF *ast.File) ([]*ast.CommentGroup, int, error) {
+		body := tmpF.Decls[0].(*ast.FuncDecl).Body
+		var comments []*ast.CommentGroup
+		for _, cg := range tmpF.Comments {
+			if body.Lbrace < cg.Pos() && cg.End() < body.Rbrace {
+				comments = append(comments, cg)
+			}
+		}
+		pos := body.Rbrace
+		if isMarker(opt.AfterVar) {
+			c := findMarker(comments, body.Lbrace, body.Rbrace, opt.AfterVar)
+			if c == nil {
+				return nil, 0, fmt.Errorf("marker %s not found", opt.AfterVar)
+			}
+			pos = c.Pos()
+		} else if i := stmtInsertIndex(tmpF.Decls[0].(*ast.FuncDecl), opt.AfterVar); i < len(body.List) {
+			pos = body.List[i].Pos()
+		}
+		return comments, tmpFset.Position(pos).Offset, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !replaceDeclSource(f, index, out, source) {
+		return fmt.Errorf("func %s can not be replaced", funcName)
+	}
+	return nil
+}
+
+// regionScope 返回源码中可以包含区域的注释，以及区域不存在时的创建位置
+type regionScope func(fset *token.FileSet, f *ast.File) ([]*ast.CommentGroup, int, error)
+
+// spliceRegion 在以 package 子句开头的源码中替换或创建托管区域，返回格式化后的源码
+//  sep 为创建区域时区域前后的分隔，文件级别的区域与前后的声明之间空一行
+func spliceRegion(source, name, src, sep string, force bool, scope regionScope) (string, error) {
+	tmpFset := token.NewFileSet()
+	tmpF, err := parser.ParseFile(tmpFset, "", source, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	comments, insert, err := scope(tmpFset, tmpF)
+	if err != nil {
+		return "", err
+	}
+	src = strings.TrimSpace(src)
+	begin, end, sum := findRegion(comments, name)
+	if begin == nil {
+		start := lineStart(source, insert)
+		block := "// " + regionBegin + " " + name + "\n" + src + "\n// " + regionEnd + " " + name + "\n"
+		source = source[:start] + sep + block + sep + source[start:]
+	} else {
+		from := strings.Index(source[tmpFset.Position(begin.Pos()).Offset:], "\n") + tmpFset.Position(begin.Pos()).Offset + 1
+		to := lineStart(source, tmpFset.Position(end.Pos()).Offset)
+		if sum != "" && sum != regionSum(source[from:to]) && !force {
+			return "", fmt.Errorf("region %s: %w", name, ErrRegionModified)
+		}
+		if src != "" {
+			src += "\n"
+		}
+		source = source[:from] + src + source[to:]
+	}
+	out, err := format.Source([]byte(source))
+	if err != nil {
+		return "", err
+	}
+	return setRegionSum(string(out), name, scope)
+}
+
+// setRegionSum 计算格式化后区域内容的校验和，写入区域的 BEGIN 行
+func setRegionSum(source, name string, scope regionScope) (string, error) {
+	tmpFset := token.NewFileSet()
+	tmpF, err := parser.ParseFile(tmpFset, "", source, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	comments, _, err := scope(tmpFset, tmpF)
+	if err != nil {
+		return "", err
+	}
+	begin, end, _ := findRegion(comments, name)
+	if begin == nil {
+		return "", fmt.Errorf("region %s not found", name)
+	}
+	offset := tmpFset.Position(begin.Pos()).Offset
+	from := offset + len(begin.Text) + 1
+	to := lineStart(source, tmpFset.Position(end.Pos()).Offset)
+	text := fmt.Sprintf("// %s %s checksum:%s", regionBegin, name, regionSum(source[from:to]))
+	return source[:offset] + text + source[offset+len(begin.Text):], nil
+}
+
+// findRegion 查找名称为 name 的区域的 BEGIN 及 END 注释，sum 为 BEGIN 行记录的校验和
+func findRegion(comments []*ast.CommentGroup, name string) (begin, end *ast.Comment, sum string) {
+	for _, cg := range comments {
+		for _, c := range cg.List {
+			text := markerText(c.Text)
+			switch {
+			case begin == nil && strings.HasPrefix(text, regionBegin+" "):
+				fields := strings.Fields(strings.TrimPrefix(text, regionBegin))
+				if len(fields) > 0 && fields[0] == name {
+					begin = c
+					if len(fields) > 1 {
+						sum = strings.TrimPrefix(fields[1], "checksum:")
+					}
+				}
+			case begin != nil && text == regionEnd+" "+name:
+				return begin, c, sum
+			}
+		}
+	}
+	return nil, nil, ""
+}
+
+// regionSum 计算区域内容的校验和，忽略空白
+func regionSum(content string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(content), "")))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// lineStart 返回 offset 所在行的起始位置
+func lineStart(source string, offset int) int {
+	return strings.LastIndex(source[:offset], "\n") + 1
+}
@@ -0,0 +1,75 @@
+package ozastutil
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReplaceRegion(t *testing.T) {
+	fst, f := InitEnv("./test_demo/region_demo.go")
+	hand := f.Decls[1]
+
+	assert.NoError(t, ReplaceRegion(fst, f, "models", "type New struct {\n\tName string\n}", nil))
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	// 区域之外的声明不重新输出
+	assert.True(t, f.Decls[1] == hand)
+	assert.Contains(t, string(src), "var  spaced   = 1\n\n// Code generated by astutil BEGIN models checksum:")
+	assert.Contains(t, string(src), "type New struct {\n\tName string\n}\n\n// END models\n\nfunc Run() {")
+	assert.NotContains(t, string(src), "Old")
+
+	// 内容未被修改时可以再次替换
+	assert.NoError(t, ReplaceRegion(fst, f, "models", "type New struct {\n\tName string\n\tAge  int\n}", nil))
+
+	// 区域被手动修改过
+	assert.True(t, AddKVToStruct(f, "New", "Extra", "bool"))
+	err = ReplaceRegion(fst, f, "models", "type New struct{}", nil)
+	assert.True(t, errors.Is(err, ErrRegionModified))
+	assert.NoError(t, ReplaceRegion(fst, f, "models", "type New struct{}", &AstRegionOption{Force: true}))
+
+	// 区域不存在时创建
+	assert.NoError(t, ReplaceRegion(fst, f, "consts", "const Max = 10", &AstRegionOption{Pos: &AstInsertPos{After: "Hand"}}))
+	assert.Error(t, ReplaceRegion(fst, f, "vars", "var x = 1", &AstRegionOption{Pos: &AstInsertPos{After: "NotFound"}}))
+	assert.Error(t, ReplaceRegion(fst, f, "vars", "var x = ", nil))
+
+	src, err = formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "type Hand struct{}\n\n// Code generated by astutil BEGIN consts checksum:")
+	assert.Contains(t, string(src), "const Max = 10\n\n// END consts\n\n// spaced 没有 gofmt 的声明\n")
+	assert.Contains(t, string(src), "type New struct{}\n\n// END models")
+
+	// 清空区域时区域注释保留
+	assert.NoError(t, ReplaceRegion(fst, f, "consts", "", nil))
+	src, err = formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "// Code generated by astutil BEGIN consts checksum:")
+	assert.Contains(t, string(src), "// END consts\n\n// spaced 没有 gofmt 的声明\n")
+	assert.NotContains(t, string(src), "Max")
+	assert.NoError(t, ReplaceRegion(fst, f, "consts", "const Min = 0", nil))
+	src, err = formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "const Min = 0\n\n// END consts\n")
+	PrintResult(fst, f)
+}
+
+func TestReplaceFuncRegion(t *testing.T) {
+	fst, f := InitEnv("./test_demo/region_demo.go")
+
+	assert.NoError(t, ReplaceFuncRegion(fst, f, "Run", "print", "fmt.Println(a + 1)\nfmt.Println(a + 2)", nil))
+	assert.NoError(t, ReplaceFuncRegion(fst, f, "Other", "print", "fmt.Println(b * 2)", &AstRegionOption{AfterVar: "b"}))
+	assert.Error(t, ReplaceFuncRegion(fst, f, "NotFound", "print", "fmt.Println(1)", nil))
+
+	// 区域之外的修改不影响替换
+	assert.True(t, AddCallBlockToFunc(f, "Other", []AstCallExpr{{FunName: "fmt", FunSel: "Println", Args: []string{"b"}}}, ""))
+	assert.NoError(t, ReplaceFuncRegion(fst, f, "Other", "print", "fmt.Println(b * 3)", nil))
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "\tvar a = 1\n\t// Code generated by astutil BEGIN print checksum:")
+	assert.Contains(t, string(src), "\tfmt.Println(a + 1)\n\tfmt.Println(a + 2)\n\t// END print\n\treturn\n}")
+	assert.Contains(t, string(src), "\tvar b = 2\n\t// Code generated by astutil BEGIN print checksum:")
+	assert.Contains(t, string(src), "\tfmt.Println(b * 3)\n\t// END print\n\tfmt.Println(b)\n")
+	assert.Contains(t, string(src), "// Code generated by astutil BEGIN models\ntype Old struct{}\n\n// END models")
+	PrintResult(fst, f)
+}
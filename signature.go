@@ -0,0 +1,647 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// InsertParamToFunc 在函数的第 index 个参数之前插入参数，index 小于 0 或超出参数个数时追加到末尾
+//
+// 参数名称已存在或原参数为匿名参数时返回 false，需要同步修改调用处时配合 AddArgToCalls 使用
+//
+// 测试数据：func Func1(a string) (ret string) {}
+//
+// 执行：InsertParamToFunc(f, "Func1", 0, "ctx", "context.Context")
+//
+// 结果为：func Func1(ctx context.Context, a string) (ret string) {}
+func InsertParamToFunc(f *ast.File, funcName string, index int, paramName, paramType string) bool {
+	if funcName == "" || paramName == "" || paramType == "" {
+		return false
+	}
+	_, fd := findFunc(f, funcName)
+	if fd == nil {
+		return false
+	}
+	params := fd.Type.Params
+	if skipApplied(f, hasParam(params, paramName, paramType)) {
+		return true
+	}
+	names, named := fieldNames(params)
+	if !named || isNameUsed(fd, paramName) {
+		return false
+	}
+	if index < 0 || index >= len(names) {
+		params.List = append(params.List, getField(paramName, paramType))
+		return true
+	}
+	at := splitField(params, index)
+	params.List = append(params.List, nil)
+	copy(params.List[at+1:], params.List[at:])
+	params.List[at] = getField(paramName, paramType)
+	return true
+}
+
+// RemoveParamFromFunc 删除函数的参数，需要同步修改调用处时配合 RemoveArgFromCalls 使用
+//
+// 函数体中仍然使用该参数时返回 false
+//
+// 测试数据：func Func1(a, b string) {}
+//
+// 执行：RemoveParamFromFunc(f, "Func1", "a")
+//
+// 结果为：func Func1(b string) {}
+func RemoveParamFromFunc(f *ast.File, funcName, paramName string) bool {
+	_, fd := findFunc(f, funcName)
+	if fd == nil || paramName == "" {
+		return false
+	}
+	index := fieldIndex(fd.Type.Params, paramName)
+	if index == -1 {
+		// 幂等模式下参数已经不存在视为已删除
+		return skipApplied(f, true)
+	}
+	// 函数体中仍然使用该参数时不能删除
+	if len(paramRefs(fd.Body, paramName)) > 0 {
+		return false
+	}
+	skipApplied(f, false)
+	params := fd.Type.Params
+	at := splitField(params, index)
+	params.List = append(params.List[:at], params.List[at+1:]...)
+	return true
+}
+
+// RenameParamInFunc 重命名函数的参数，并替换函数体中对该参数的引用
+//
+// 被局部的同名声明遮蔽的引用不替换；新名称已被参数、返回值使用，或者在函数体中声明、引用时返回 false
+//
+// 测试数据：
+//
+// func Func1(a string) (ret string) {
+//	var b = a
+//	ret = b
+//	return ret
+// }
+//
+// 执行：RenameParamInFunc(f, "Func1", "a", "name")
+//
+// 结果为：
+//
+// func Func1(name string) (ret string) {
+//	var b = name
+//	ret = b
+//	return ret
+// }
+func RenameParamInFunc(f *ast.File, funcName, oldName, newName string) bool {
+	if !token.IsIdentifier(newName) {
+		return false
+	}
+	_, fd := findFunc(f, funcName)
+	if fd == nil {
+		return false
+	}
+	// 幂等模式下原参数不存在且新参数存在视为已重命名
+	if fieldIndex(fd.Type.Params, oldName) == -1 && fieldIndex(fd.Type.Params, newName) != -1 {
+		return skipApplied(f, true)
+	}
+	if isNameTaken(fd, newName) {
+		return false
+	}
+	skipApplied(f, false)
+	for _, field := range fd.Type.Params.List {
+		for _, id := range field.Names {
+			if id.Name == oldName {
+				id.Name = newName
+				renameLocal(fd.Body, oldName, newName)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ChangeParamType 修改函数参数的类型
+//
+// 测试数据：func Func1(a, b string) {}
+//
+// 执行：ChangeParamType(f, "Func1", "b", "int")
+//
+// 结果为：func Func1(a string, b int) {}
+func ChangeParamType(f *ast.File, funcName, paramName, paramType string) bool {
+	_, fd := findFunc(f, funcName)
+	if fd == nil || paramType == "" {
+		return false
+	}
+	index := fieldIndex(fd.Type.Params, paramName)
+	if index == -1 {
+		return false
+	}
+	params := fd.Type.Params
+	if skipApplied(f, exprString(flattenFields(params)[index].Type) == paramType) {
+		return true
+	}
+	at := splitField(params, index)
+	params.List[at].Type = ast.NewIdent(paramType)
+	return true
+}
+
+// AddResultToFunc 给函数添加返回值，name 为空时添加匿名返回值
+//
+// 已有返回值为具名时 name 不能为空，为匿名时 name 必须为空。value 不为空时追加到函数中每个带返回值的 return 语句
+//
+// 测试数据：
+//
+// func Func1(a string) string {
+//	return a
+// }
+//
+// 执行：AddResultToFunc(f, "Func1", "", "error", "nil")
+//
+// 结果为：
+//
+// func Func1(a string) (string, error) {
+//	return a, nil
+// }
+func AddResultToFunc(f *ast.File, funcName, name, typ, value string) bool {
+	_, fd := findFunc(f, funcName)
+	if fd == nil || typ == "" {
+		return false
+	}
+	if fd.Type.Results == nil {
+		fd.Type.Results = &ast.FieldList{}
+	}
+	results := fd.Type.Results
+	names, named := fieldNames(results)
+	// 幂等模式下最后一个返回值与要添加的相同视为已添加
+	if list := flattenFields(results); len(list) > 0 && fieldString(list[len(list)-1]) == fieldString(getField(name, typ)) {
+		if skipApplied(f, true) {
+			return true
+		}
+	}
+	if len(names) > 0 && named != (name != "") {
+		return false
+	}
+	if name != "" && isNameUsed(fd, name) {
+		return false
+	}
+	count := len(names)
+	results.List = append(results.List, getField(name, typ))
+	if value == "" {
+		return true
+	}
+	for _, ret := range funcReturns(fd) {
+		if len(ret.Results) == count && (count > 0 || !named || name == "") {
+			ret.Results = append(ret.Results, &ast.BasicLit{Value: value})
+		}
+	}
+	return true
+}
+
+// RemoveResultFromFunc 删除函数的第 index 个返回值，并删除 return 语句中对应的表达式
+//  return 语句的值与返回值个数不同（如 return f()），或者不带值的 return 返回的具名返回值在函数体中被引用时，
+//  无法确定如何修改，返回 false 且不做任何修改
+//
+// 测试数据：
+//
+// func Func1(a string) (string, error) {
+//	return a, nil
+// }
+//
+// 执行：RemoveResultFromFunc(f, "Func1", 1)
+//
+// 结果为：
+//
+// func Func1(a string) string {
+//	return a
+// }
+func RemoveResultFromFunc(f *ast.File, funcName string, index int) bool {
+	_, fd := findFunc(f, funcName)
+	if fd == nil || fd.Type.Results == nil {
+		return false
+	}
+	results := fd.Type.Results
+	names, named := fieldNames(results)
+	if index < 0 || index >= len(names) {
+		return false
+	}
+	rets := funcReturns(fd)
+	for _, ret := range rets {
+		switch {
+		case len(ret.Results) == len(names):
+		case len(ret.Results) == 0 && named:
+			// 不带值的 return 返回剩余的具名返回值，被删除的返回值不能再被引用
+			if names[index] != "_" && len(paramRefs(fd.Body, names[index])) > 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	for _, ret := range rets {
+		if len(ret.Results) == len(names) {
+			ret.Results = append(ret.Results[:index], ret.Results[index+1:]...)
+		}
+	}
+	at := splitField(results, index)
+	results.List = append(results.List[:at], results.List[at+1:]...)
+	if len(results.List) == 0 {
+		fd.Type.Results = nil
+	}
+	return true
+}
+
+// ChangeResultType 修改函数第 index 个返回值的类型
+//
+// 测试数据：func Func1(a string) (ret string) {}
+//
+// 执行：ChangeResultType(f, "Func1", 0, "int")
+//
+// 结果为：func Func1(a string) (ret int) {}
+func ChangeResultType(f *ast.File, funcName string, index int, typ string) bool {
+	_, fd := findFunc(f, funcName)
+	if fd == nil || fd.Type.Results == nil || typ == "" {
+		return false
+	}
+	results := fd.Type.Results
+	names, _ := fieldNames(results)
+	if index < 0 || index >= len(names) {
+		return false
+	}
+	if skipApplied(f, exprString(flattenFields(results)[index].Type) == typ) {
+		return true
+	}
+	at := splitField(results, index)
+	results.List[at].Type = ast.NewIdent(typ)
+	return true
+}
+
+// SetResultNames 设置函数返回值的名称，names 为空时改为匿名返回值
+//
+// 改为匿名返回值时，函数体中用到的返回值变量改为在函数开头声明，不带值的 return 语句补全返回的变量
+//
+// 测试数据：
+//
+// func Func1(a string) (ret string) {
+//	ret = a
+//	return
+// }
+//
+// 执行：SetResultNames(f, "Func1")
+//
+// 结果为：
+//
+// func Func1(a string) string {
+//	var ret string
+//	ret = a
+//	return ret
+// }
+func SetResultNames(f *ast.File, funcName string, names ...string) bool {
+	_, fd := findFunc(f, funcName)
+	if fd == nil || fd.Type.Results == nil {
+		return false
+	}
+	results := fd.Type.Results
+	oldNames, named := fieldNames(results)
+	if skipApplied(f, (len(names) == 0 && !named) || (named && strings.Join(oldNames, ",") == strings.Join(names, ","))) {
+		return true
+	}
+	if len(names) == 0 {
+		if !named {
+			return true
+		}
+		unnameResults(fd, oldNames)
+		return true
+	}
+	if len(names) != len(oldNames) {
+		return false
+	}
+	seen := make(map[string]bool)
+	for i, name := range names {
+		if !token.IsIdentifier(name) || seen[name] {
+			return false
+		}
+		seen[name] = true
+		if (!named || name != oldNames[i]) && isNameTaken(fd, name) {
+			return false
+		}
+	}
+	if named {
+		for i, name := range oldNames {
+			renameLocal(fd.Body, name, names[i])
+		}
+	}
+	list := make([]*ast.Field, 0, len(names))
+	for i, field := range flattenFields(results) {
+		list = append(list, &ast.Field{Names: []*ast.Ident{ast.NewIdent(names[i])}, Type: field.Type})
+	}
+	results.List = list
+	return true
+}
+
+// AddArgToCalls 在文件中所有对函数 funcName 的调用处插入参数 arg，index 小于 0 或超出参数个数时追加到末尾
+//
+// funcName 的格式见 findFunc，方法调用的识别规则见 findFuncRefs，返回修改的调用个数
+//
+// 测试数据：Func1("a")
+//
+// 执行：AddArgToCalls(files, "Func1", 0, "context.TODO()")
+//
+// 结果为：Func1(context.TODO(), "a")
+func AddArgToCalls(files []*ast.File, funcName string, index int, arg string) int {
+	if arg == "" {
+		return 0
+	}
+	count := 0
+	for _, f := range files {
+		for _, call := range findCalls(f, funcName) {
+			at := index
+			if at >= 0 && call.methodExpr {
+				at++
+			}
+			args := call.expr.Args
+			if at < 0 || at >= len(args) {
+				at = len(args)
+			}
+			if call.expr.Ellipsis.IsValid() && at == len(args) {
+				// f(a...) 之后不能再追加参数
+				continue
+			}
+			args = append(args, nil)
+			copy(args[at+1:], args[at:])
+			args[at] = &ast.BasicLit{Value: arg}
+			call.expr.Args = args
+			count++
+		}
+	}
+	return count
+}
+
+// RemoveArgFromCalls 删除文件中所有对函数 funcName 的调用处的第 index 个参数，返回修改的调用个数
+//
+// 测试数据：Func1("a", "b")
+//
+// 执行：RemoveArgFromCalls(files, "Func1", 0)
+//
+// 结果为：Func1("b")
+func RemoveArgFromCalls(files []*ast.File, funcName string, index int) int {
+	if index < 0 {
+		return 0
+	}
+	count := 0
+	for _, f := range files {
+		for _, call := range findCalls(f, funcName) {
+			at := index
+			if call.methodExpr {
+				at++
+			}
+			if at >= len(call.expr.Args) {
+				continue
+			}
+			call.expr.Args = append(call.expr.Args[:at], call.expr.Args[at+1:]...)
+			count++
+		}
+	}
+	return count
+}
+
+// funcCall 对函数的一次调用
+type funcCall struct {
+	expr *ast.CallExpr
+	// methodExpr 表示通过方法表达式调用，第一个参数为接收者
+	methodExpr bool
+}
+
+// findCalls 查找文件中对函数 funcName 的调用
+func findCalls(f *ast.File, funcName string) []funcCall {
+	recv, _, name := parseFuncName(funcName)
+	refs := make(map[ast.Expr]bool)
+	for _, ref := range findFuncRefs(f, recv, name) {
+		refs[ref.expr] = ref.methodExpr
+	}
+	calls := make([]funcCall, 0)
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fun := call.Fun
+		for {
+			p, ok := fun.(*ast.ParenExpr)
+			if !ok {
+				break
+			}
+			fun = p.X
+		}
+		if methodExpr, ok := refs[fun]; ok {
+			calls = append(calls, funcCall{expr: call, methodExpr: methodExpr})
+		}
+		return true
+	})
+	return calls
+}
+
+// fieldNames 返回参数列表中的名称，匿名参数的名称为空，named 表示参数是否具名
+//  列表为空时 named 为 true
+func fieldNames(list *ast.FieldList) (names []string, named bool) {
+	named = true
+	if list == nil {
+		return
+	}
+	for _, field := range list.List {
+		if len(field.Names) == 0 {
+			named = false
+			names = append(names, "")
+			continue
+		}
+		for _, id := range field.Names {
+			names = append(names, id.Name)
+		}
+	}
+	return
+}
+
+// fieldIndex 返回参数在参数列表中的下标，没有找到时返回 -1
+func fieldIndex(list *ast.FieldList, name string) int {
+	names, _ := fieldNames(list)
+	for i, n := range names {
+		if n != "" && n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitField 将第 index 个参数所在的 a, b string 形式的参数拆分为单个参数，返回其在 list.List 中的下标
+func splitField(list *ast.FieldList, index int) int {
+	i := 0
+	for at, field := range list.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		if index >= i+n {
+			i += n
+			continue
+		}
+		if n == 1 {
+			return at
+		}
+		fields := make([]*ast.Field, 0, len(list.List)+n-1)
+		fields = append(fields, list.List[:at]...)
+		for _, id := range field.Names {
+			fields = append(fields, &ast.Field{Names: []*ast.Ident{id}, Type: field.Type})
+		}
+		list.List = append(fields, list.List[at+1:]...)
+		return at + index - i
+	}
+	return -1
+}
+
+// flattenFields 返回拆分后的参数，每个参数只有一个名称
+func flattenFields(list *ast.FieldList) []*ast.Field {
+	fields := make([]*ast.Field, 0)
+	if list == nil {
+		return fields
+	}
+	for _, field := range list.List {
+		if len(field.Names) <= 1 {
+			fields = append(fields, field)
+			continue
+		}
+		for _, id := range field.Names {
+			fields = append(fields, &ast.Field{Names: []*ast.Ident{id}, Type: field.Type})
+		}
+	}
+	return fields
+}
+
+// hasParam 判断参数列表中是否存在名称及类型都相同的参数
+func hasParam(params *ast.FieldList, name, typ string) bool {
+	for _, field := range flattenFields(params) {
+		if len(field.Names) == 1 && field.Names[0].Name == name && exprString(field.Type) == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// isNameUsed 判断名称是否已被函数的接收者、参数或返回值使用
+func isNameUsed(fd *ast.FuncDecl, name string) bool {
+	for _, list := range []*ast.FieldList{fd.Recv, fd.Type.Params, fd.Type.Results} {
+		names, _ := fieldNames(list)
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renameLocal 替换节点中对参数或返回值 oldName 的引用，被局部的同名声明遮蔽的引用不处理
+func renameLocal(node ast.Node, oldName, newName string) {
+	for _, id := range paramRefs(node, oldName) {
+		id.Name = newName
+	}
+}
+
+// paramRefs 返回节点中对参数或返回值 name 的引用，被局部的同名声明遮蔽的引用不包括在内
+func paramRefs(node ast.Node, name string) []*ast.Ident {
+	refs := make([]*ast.Ident, 0)
+	walkScopes(node, func(id *ast.Ident, local func(string) bool) {
+		if id.Name == name && !local(name) {
+			refs = append(refs, id)
+		}
+	})
+	return refs
+}
+
+// isNameTaken 判断名称是否已被函数的接收者、参数、返回值使用，或者在函数体中声明、引用
+//  新名称与函数体中的名称相同时，重命名会产生重复声明或改变引用的对象
+func isNameTaken(fd *ast.FuncDecl, name string) bool {
+	return isNameUsed(fd, name) || (fd.Body != nil && isIdentUsed(fd.Body, name))
+}
+
+// funcReturns 返回函数体中属于该函数的 return 语句，不包括函数字面量中的 return
+func funcReturns(fd *ast.FuncDecl) []*ast.ReturnStmt {
+	rets := make([]*ast.ReturnStmt, 0)
+	if fd.Body == nil {
+		return rets
+	}
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			rets = append(rets, x)
+		}
+		return true
+	})
+	return rets
+}
+
+// unnameResults 将具名返回值改为匿名返回值
+func unnameResults(fd *ast.FuncDecl, names []string) {
+	results := flattenFields(fd.Type.Results)
+	list := make([]*ast.Field, 0, len(results))
+	for _, field := range results {
+		list = append(list, &ast.Field{Type: field.Type})
+	}
+	fd.Type.Results.List = list
+	if fd.Body == nil {
+		return
+	}
+	bare := make([]*ast.ReturnStmt, 0)
+	for _, ret := range funcReturns(fd) {
+		if len(ret.Results) == 0 {
+			bare = append(bare, ret)
+		}
+	}
+	decls := make([]ast.Stmt, 0)
+	for i, name := range names {
+		if name == "_" {
+			// 名称为 _ 的返回值只有不带值的 return 会用到，改用新的变量
+			if len(bare) == 0 {
+				continue
+			}
+			name = fmt.Sprintf("r%d", i)
+			for isNameUsed(fd, name) || isIdentUsed(fd.Body, name) {
+				name = "_" + name
+			}
+			names[i] = name
+		} else if !isIdentUsed(fd.Body, name) && len(bare) == 0 {
+			continue
+		}
+		decls = append(decls, &ast.DeclStmt{Decl: &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{&ast.ValueSpec{
+				Names: []*ast.Ident{ast.NewIdent(name)},
+				Type:  results[i].Type,
+			}},
+		}})
+	}
+	for _, ret := range bare {
+		for _, name := range names {
+			ret.Results = append(ret.Results, ast.NewIdent(name))
+		}
+	}
+	fd.Body.List = append(decls, fd.Body.List...)
+}
+
+// isIdentUsed 判断节点中是否使用了标识符 name
+func isIdentUsed(node ast.Node, name string) bool {
+	used := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			used = used || isIdentUsed(sel.X, name)
+			return false
+		}
+		if id, ok := n.(*ast.Ident); ok && id.Name == name {
+			used = true
+		}
+		return !used
+	})
+	return used
+}
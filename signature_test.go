@@ -0,0 +1,190 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"testing"
+)
+
+func TestInsertParamToFunc(t *testing.T) {
+	fst, f := InitEnv("./test_demo/signature_demo.go")
+
+	ret := InsertParamToFunc(f, "Func1", 1, "ctx", "context.Context")
+	assert.True(t, ret)
+
+	// 参数已存在
+	ret = InsertParamToFunc(f, "Func1", 0, "a", "int")
+	assert.False(t, ret)
+
+	// 匿名参数
+	ret = InsertParamToFunc(f, "Func3", 0, "a", "int")
+	assert.False(t, ret)
+
+	ret = AddParamToFunc(f, "Func3", "a", "int")
+	assert.False(t, ret)
+
+	ret = InsertParamToFunc(f, "Stu.Method", -1, "b", "int")
+	assert.True(t, ret)
+
+	count := AddArgToCalls([]*ast.File{f}, "Func1", 1, "context.TODO()")
+	assert.Equal(t, 1, count)
+
+	count = AddArgToCalls([]*ast.File{f}, "Stu.Method", -1, "1")
+	assert.Equal(t, 2, count)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "func Func1(a string, ctx context.Context, b string) (ret string)")
+	assert.Contains(t, string(src), "func (s *Stu) Method(a string, b int")
+	assert.Contains(t, string(src), `Func1("a", context.TODO(), "b")`)
+	assert.Contains(t, string(src), `stu.Method("a", 1), (*Stu).Method(stu, "b", 1)`)
+	// 局部变量不受影响
+	assert.Contains(t, string(src), "fmt.Println(Func1)")
+	PrintResult(fst, f)
+}
+
+func TestRemoveParamFromFunc(t *testing.T) {
+	fst, f := InitEnv("./test_demo/signature_demo.go")
+
+	// 函数体中仍然使用该参数
+	ret := RemoveParamFromFunc(f, "Func1", "a")
+	assert.False(t, ret)
+
+	ret = RemoveParamFromFunc(f, "(*Stu).Method", "a")
+	assert.True(t, ret)
+
+	ret = RemoveParamFromFunc(f, "(*Stu).Method", "a")
+	assert.False(t, ret)
+
+	count := RemoveArgFromCalls([]*ast.File{f}, "(*Stu).Method", 0)
+	assert.Equal(t, 2, count)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "func Func1(a, b string) (ret string)")
+	assert.Contains(t, string(src), "func (s *Stu) Method() error")
+	assert.Contains(t, string(src), `fmt.Println(stu.Method(), (*Stu).Method(stu))`)
+	PrintResult(fst, f)
+}
+
+func TestRenameParamInFunc(t *testing.T) {
+	fst, f := InitEnv("./test_demo/signature_demo.go")
+
+	ret := RenameParamInFunc(f, "Func1", "a", "name")
+	assert.True(t, ret)
+
+	// 与返回值同名
+	ret = RenameParamInFunc(f, "Func1", "b", "ret")
+	assert.False(t, ret)
+
+	// 新名称已在函数体中声明
+	ret = RenameParamInFunc(f, "Func4", "a", "n")
+	assert.False(t, ret)
+
+	// 重新声明了原名称的作用域不替换
+	ret = RenameParamInFunc(f, "Func4", "a", "x")
+	assert.True(t, ret)
+
+	ret = ChangeParamType(f, "Func1", "b", "int")
+	assert.True(t, ret)
+
+	ret = ChangeParamType(f, "Func1", "c", "int")
+	assert.False(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "func Func1(name string, b int")
+	assert.Contains(t, string(src), "var c = name\n")
+	assert.Contains(t, string(src), "func Func4(x int) int {\n\tfor a := 0; a < 1; a++ {\n\t\t_ = a\n\t}")
+	assert.Contains(t, string(src), "return x + n")
+	PrintResult(fst, f)
+}
+
+func TestChangeResults(t *testing.T) {
+	fst, f := InitEnv("./test_demo/signature_demo.go")
+
+	ret := AddResultToFunc(f, "Func2", "", "error", "nil")
+	assert.True(t, ret)
+
+	// 匿名返回值不能添加具名返回值
+	ret = AddResultToFunc(f, "Func2", "err", "error", "nil")
+	assert.False(t, ret)
+
+	ret = ChangeResultType(f, "Func2", 0, "[]byte")
+	assert.True(t, ret)
+
+	ret = RemoveResultFromFunc(f, "Stu.Method", 0)
+	assert.True(t, ret)
+
+	ret = RemoveResultFromFunc(f, "Stu.Method", 0)
+	assert.False(t, ret)
+
+	// return 语句返回函数调用的结果，无法删除其中一个值
+	ret = RemoveResultFromFunc(f, "Func5", 1)
+	assert.False(t, ret)
+
+	// 不带值的 return 返回的具名返回值在函数体中被引用
+	ret = RemoveResultFromFunc(f, "Func1", 0)
+	assert.False(t, ret)
+
+	// 未被引用的具名返回值可以删除，不带值的 return 不变
+	ret = RemoveResultFromFunc(f, "Func3", 0)
+	assert.True(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "func Func2(a string) ([]byte, error) {")
+	assert.Contains(t, string(src), "return \"empty\", nil")
+	assert.Contains(t, string(src), "return a, nil")
+	assert.Contains(t, string(src), "func (s *Stu) Method(a string) {\n\treturn\n}")
+	assert.Contains(t, string(src), "func Func5() (string, error) {\n\treturn Func6()\n}")
+	assert.Contains(t, string(src), "func Func1(a, b string) (ret string) {")
+	assert.Contains(t, string(src), "func Func3(string, int) (err error) {\n\treturn\n}")
+	PrintResult(fst, f)
+}
+
+func TestSetResultNames(t *testing.T) {
+	fst, f := InitEnv("./test_demo/signature_demo.go")
+
+	ret := SetResultNames(f, "Func1")
+	assert.True(t, ret)
+
+	ret = SetResultNames(f, "Func2", "ret")
+	assert.True(t, ret)
+
+	// 与参数同名
+	ret = SetResultNames(f, "Stu.Method", "a")
+	assert.False(t, ret)
+
+	ret = SetResultNames(f, "Func3", "n", "e")
+	assert.True(t, ret)
+
+	ret = SetResultNames(f, "Func3")
+	assert.True(t, ret)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "func Func1(a, b string) string {\n\tvar ret string\n\tvar c = a\n\tret = c + b\n\treturn ret\n}")
+	assert.Contains(t, string(src), "func Func2(a string) (ret string) {")
+	assert.Contains(t, string(src), "func Func3(string, int) (int, error) {\n\tvar n int\n\tvar e error\n\treturn n, e\n}")
+	PrintResult(fst, f)
+}
+
+func TestAddArgToCalls(t *testing.T) {
+	fst, files := InitEnvs("./test_demo/signature_demo.go", "./test_demo/signature_call_demo.go")
+
+	ret := InsertParamToFunc(files[0], "Func1", 0, "ctx", "context.Context")
+	assert.True(t, ret)
+
+	count := AddArgToCalls(files, "Func1", 0, "ctx")
+	assert.Equal(t, 2, count)
+
+	count = AddArgToCalls(files, "(*Stu).Method", 0, "ctx")
+	assert.Equal(t, 3, count)
+
+	src, err := formatFile(fst, files[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), `_ = stu.Method(ctx, "x")`)
+	assert.Contains(t, string(src), `return Func1(ctx, "x", "y")`)
+	PrintResult(fst, files[1])
+}
@@ -0,0 +1,332 @@
+package ozastutil
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+)
+
+// 快照及事务
+//
+// 修改类 API 直接修改 *ast.File，一组修改中间失败时前面的修改已经生效。
+// Snapshot 复制文件当前的语法树（包括注释及新声明的排版信息），Restore 将文件恢复到快照时的状态；
+// Begin 对多个文件开始事务，Rollback 恢复所有文件，Commit 保留修改。
+// 文件恢复后，快照之后取得的节点（如 Query 的结果）不再属于文件。
+
+// FileSnapshot 文件的快照
+type FileSnapshot struct {
+	f     *ast.File
+	saved *ast.File
+	// decls 快照中新声明的片段信息及参考位置，保存在快照自己的表中，快照不再使用时随之释放
+	decls map[ast.Decl]declInfo
+}
+
+// declInfo 新声明的片段信息及参考位置
+type declInfo struct {
+	snippet *snippet
+	hint    token.Pos
+	hasHint bool
+}
+
+// Snapshot 保存文件当前的状态
+func Snapshot(f *ast.File) *FileSnapshot {
+	saved, decls := cloneFile(f, loadDeclInfo)
+	return &FileSnapshot{f: f, saved: saved, decls: decls}
+}
+
+// Restore 将文件恢复到快照时的状态，可以多次恢复
+//  文件当前声明的片段信息及参考位置被释放，恢复后的声明使用快照中的副本
+func (s *FileSnapshot) Restore() {
+	clone, decls := cloneFile(s.saved, func(decl ast.Decl) declInfo {
+		return s.decls[decl]
+	})
+	for _, decl := range s.f.Decls {
+		releaseDecl(decl)
+	}
+	for decl, info := range decls {
+		if info.snippet != nil {
+			snippets.Store(decl, info.snippet)
+		}
+		if info.hasHint {
+			declHints.Store(decl, info.hint)
+		}
+	}
+	*s.f = *clone
+}
+
+// loadDeclInfo 返回全局表中声明的片段信息及参考位置
+func loadDeclInfo(decl ast.Decl) declInfo {
+	var info declInfo
+	if s, ok := snippets.Load(decl); ok {
+		info.snippet = s.(*snippet)
+	}
+	if pos, ok := declHints.Load(decl); ok {
+		info.hint, info.hasHint = pos.(token.Pos), true
+	}
+	return info
+}
+
+// cloneFile 深度复制文件，节点之间的共享关系（如 Doc 与 Comments 中的同一个注释）保持不变，
+// 新声明的片段信息及参考位置由 load 取得，复制后对应到新节点上返回，不写入全局的表
+func cloneFile(f *ast.File, load func(ast.Decl) declInfo) (*ast.File, map[ast.Decl]declInfo) {
+	memo := make(map[interface{}]reflect.Value)
+	clone := cloneValue(reflect.ValueOf(f), memo).Interface().(*ast.File)
+	decls := make(map[ast.Decl]declInfo)
+	for i, decl := range f.Decls {
+		info := load(decl)
+		if info.snippet != nil {
+			comments := make([]*ast.CommentGroup, 0, len(info.snippet.comments))
+			for _, c := range info.snippet.comments {
+				comments = append(comments, cloneValue(reflect.ValueOf(c), memo).Interface().(*ast.CommentGroup))
+			}
+			info.snippet = &snippet{fset: info.snippet.fset, comments: comments}
+		}
+		if info.snippet != nil || info.hasHint {
+			decls[clone.Decls[i]] = info
+		}
+	}
+	return clone, decls
+}
+
+var (
+	objectType = reflect.TypeOf((*ast.Object)(nil))
+	scopeType  = reflect.TypeOf((*ast.Scope)(nil))
+)
+
+// cloneValue 深度复制 ast 节点，memo 记录已复制的指针
+//  ast.Object 及 ast.Scope 只用于旧的标识符解析，可能循环引用，不复制
+func cloneValue(v reflect.Value, memo map[interface{}]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == objectType || v.Type() == scopeType {
+			return v
+		}
+		if c, ok := memo[v.Interface()]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		memo[v.Interface()] = c
+		c.Elem().Set(cloneValue(v.Elem(), memo))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(cloneValue(v.Elem(), memo))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if field := c.Field(i); field.CanSet() {
+				field.Set(cloneValue(v.Field(i), memo))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(cloneValue(v.Index(i), memo))
+		}
+		return c
+	}
+	return v
+}
+
+// ErrTxClosed 事务已经提交或回滚
+var ErrTxClosed = errors.New("transaction already committed or rolled back")
+
+// Tx 多个文件的事务
+type Tx struct {
+	snaps  []*FileSnapshot
+	closed bool
+}
+
+// Begin 对文件开始事务，保存所有文件当前的状态
+func Begin(files ...*ast.File) *Tx {
+	tx := &Tx{}
+	for _, f := range files {
+		tx.snaps = append(tx.snaps, Snapshot(f))
+	}
+	return tx
+}
+
+// Commit 保留事务中的修改
+func (tx *Tx) Commit() error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	tx.closed = true
+	tx.snaps = nil
+	return nil
+}
+
+// Rollback 将所有文件恢复到事务开始时的状态
+func (tx *Tx) Rollback() error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	for _, s := range tx.snaps {
+		s.Restore()
+	}
+	tx.closed = true
+	tx.snaps = nil
+	return nil
+}
+
+// Atomic 依次执行修改，某个修改返回 false 时将文件恢复到执行前的状态并返回错误
+//
+// 例子：
+//
+// err := Atomic([]*ast.File{f}, func() bool {
+//   return AddKVToStruct(f, "Stu", "Age", "int")
+// }, func() bool {
+//   return AddFunc(f, &AstFunc{Name: "Hello"})
+// })
+func Atomic(files []*ast.File, edits ...func() bool) error {
+	tx := Begin(files...)
+	for i, edit := range edits {
+		if !edit() {
+			tx.Rollback()
+			return fmt.Errorf("edit %d failed, all edits rolled back", i)
+		}
+	}
+	return tx.Commit()
+}
+
+// Session 同一个包中的多个文件，文件共用一个 FileSet，事务作用于所有文件
+type Session struct {
+	fset  *token.FileSet
+	files []*ast.File
+	tx    *Tx
+
+	// log 生效的修改记录，undone 已撤销可以重做的修改，txLog、txUndone 为事务开始时的记录
+	log      []*LogEntry
+	undone   []*LogEntry
+	txLog    []*LogEntry
+	txUndone []*LogEntry
+}
+
+// NewSession 使用已加载的文件创建会话
+func NewSession(fset *token.FileSet, files ...*ast.File) *Session {
+	BindFileSet(fset, files...)
+	return &Session{fset: fset, files: files}
+}
+
+// LoadSession 加载多个文件并创建会话，使用完后调用 Close 释放文件的状态
+//  某个文件加载失败时已加载的文件随之释放
+func LoadSession(paths ...string) (*Session, error) {
+	fset := token.NewFileSet()
+	files := make([]*ast.File, 0, len(paths))
+	for _, path := range paths {
+		f, err := parseFile(fset, path)
+		if err != nil {
+			ReleaseFile(files...)
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return NewSession(fset, files...), nil
+}
+
+// FileSet 返回会话的 FileSet
+func (s *Session) FileSet() *token.FileSet {
+	return s.fset
+}
+
+// Files 返回会话中的所有文件
+func (s *Session) Files() []*ast.File {
+	return s.files
+}
+
+// File 按加载时的路径返回文件，不存在时返回 nil
+func (s *Session) File(path string) *ast.File {
+	for _, f := range s.files {
+		if s.fset.Position(f.Package).Filename == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// Begin 对会话中的所有文件开始事务，已有事务未结束时返回错误
+func (s *Session) Begin() error {
+	if s.tx != nil {
+		return errors.New("transaction already in progress")
+	}
+	s.tx = Begin(s.files...)
+	s.txLog = append([]*LogEntry(nil), s.log...)
+	s.txUndone = append([]*LogEntry(nil), s.undone...)
+	return nil
+}
+
+// Commit 提交会话的事务
+func (s *Session) Commit() error {
+	if s.tx == nil {
+		return ErrTxClosed
+	}
+	defer func() { s.tx = nil }()
+	return s.tx.Commit()
+}
+
+// Rollback 将会话中的所有文件及修改记录恢复到事务开始时的状态
+func (s *Session) Rollback() error {
+	if s.tx == nil {
+		return ErrTxClosed
+	}
+	defer func() { s.tx = nil }()
+	s.log, s.undone = s.txLog, s.txUndone
+	return s.tx.Rollback()
+}
+
+// Do 在事务中执行 fn，fn 返回错误或 panic 时回滚所有文件，否则提交
+func (s *Session) Do(fn func(s *Session) error) (err error) {
+	if err := s.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			s.Rollback()
+			panic(r)
+		}
+	}()
+	if err := fn(s); err != nil {
+		s.Rollback()
+		return err
+	}
+	return s.Commit()
+}
+
+// Atomic 在事务中依次执行修改，某个修改返回 false 时回滚所有文件
+func (s *Session) Atomic(edits ...func() bool) error {
+	return s.Do(func(*Session) error {
+		for i, edit := range edits {
+			if !edit() {
+				return fmt.Errorf("edit %d failed, all edits rolled back", i)
+			}
+		}
+		return nil
+	})
+}
+
+// Close 释放会话中所有文件的状态（见 ReleaseFile）及修改记录，关闭后不能再使用会话
+func (s *Session) Close() {
+	ReleaseFile(s.files...)
+	s.tx, s.log, s.undone, s.txLog, s.txUndone = nil, nil, nil, nil, nil
+}
+
+// Save 将所有文件写回原处
+func (s *Session) Save() error {
+	for _, f := range s.files {
+		if err := WriteToFile(s.fset, f, s.fset.Position(f.Package).Filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
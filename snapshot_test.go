@@ -0,0 +1,164 @@
+package ozastutil
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	fst, f := InitEnv("./test_demo/edit_demo.go")
+	before, err := formatFile(fst, f)
+	assert.NoError(t, err)
+
+	s := Snapshot(f)
+	assert.True(t, AddKVToStruct(f, "Stu", "Age", "int"))
+	assert.True(t, AddFunc(f, &AstFunc{Name: "Hello", Doc: []string{"Hello 打招呼"}}))
+	assert.True(t, DeleteFunc(f, "Old"))
+	assert.NoError(t, ReplaceRegion(fst, f, "models", "type Model struct{}", nil))
+	s.Restore()
+	after, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	// 快照中包含新生成的声明
+	assert.True(t, AddFunc(f, &AstFunc{Name: "Hello", Doc: []string{"Hello 打招呼"}}))
+	mid, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	s = Snapshot(f)
+	assert.True(t, AddValueToSlice(f, "routes", AddQuote("/a")))
+	assert.True(t, RenameFunc(f, "Hello", "Hi"))
+	s.Restore()
+	after, err = formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(mid), string(after))
+
+	// 可以多次恢复
+	assert.True(t, DeleteFunc(f, "Hello"))
+	s.Restore()
+	after, err = formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(mid), string(after))
+	PrintResult(fst, f)
+}
+
+func TestAtomic(t *testing.T) {
+	fst, f := InitEnv("./test_demo/edit_demo.go")
+	before, err := formatFile(fst, f)
+	assert.NoError(t, err)
+
+	err = Atomic([]*ast.File{f}, func() bool {
+		return AddKVToStruct(f, "Stu", "Age", "int")
+	}, func() bool {
+		return DeleteFunc(f, "NotFound")
+	})
+	assert.Equal(t, "edit 1 failed, all edits rolled back", err.Error())
+	after, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	tx := Begin(f)
+	assert.True(t, AddKVToStruct(f, "Stu", "Age", "int"))
+	assert.NoError(t, tx.Commit())
+	assert.Equal(t, ErrTxClosed, tx.Rollback())
+	after, err = formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(after), "\tAge  int\n")
+}
+
+func TestSession(t *testing.T) {
+	s, err := LoadSession("./test_demo/edit_demo.go", "./test_demo/query_demo.go")
+	assert.NoError(t, err)
+	edit, query := s.File("./test_demo/edit_demo.go"), s.File("./test_demo/query_demo.go")
+	assert.NotNil(t, edit)
+	assert.NotNil(t, query)
+	editSrc, _ := formatFile(s.FileSet(), edit)
+	querySrc, _ := formatFile(s.FileSet(), query)
+
+	// 任何一个文件的修改失败时所有文件都恢复
+	err = s.Atomic(func() bool {
+		return AddKVToStruct(edit, "Stu", "Age", "int")
+	}, func() bool {
+		return AddValueToMap(query, "mapStr", AddQuote("ee"), AddQuote("ee"))
+	}, func() bool {
+		return AddKVToStruct(query, "NotFound", "Age", "int")
+	})
+	assert.Error(t, err)
+	src, _ := formatFile(s.FileSet(), edit)
+	assert.Equal(t, string(editSrc), string(src))
+	src, _ = formatFile(s.FileSet(), query)
+	assert.Equal(t, string(querySrc), string(src))
+
+	err = s.Do(func(s *Session) error {
+		if !AddKVToStruct(edit, "Stu", "Age", "int") {
+			return errors.New("add field failed")
+		}
+		return ReplaceRegion(s.FileSet(), query, "models", "type Model struct{}", nil)
+	})
+	assert.NoError(t, err)
+	src, _ = formatFile(s.FileSet(), query)
+	assert.Contains(t, string(src), "type Model struct{}")
+
+	assert.NoError(t, s.Begin())
+	assert.Error(t, s.Begin())
+	assert.NoError(t, s.Rollback())
+	assert.Equal(t, ErrTxClosed, s.Commit())
+
+	// 关闭会话时释放文件的状态
+	s.Close()
+	_, ok := fileSets.Load(edit)
+	assert.False(t, ok)
+
+	// 加载失败时释放已加载的文件
+	n := 0
+	fileSets.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	_, err = LoadSession("./test_demo/edit_demo.go", "./test_demo/notfound.go")
+	assert.Error(t, err)
+	fileSets.Range(func(_, _ interface{}) bool {
+		n--
+		return true
+	})
+	assert.Equal(t, 0, n)
+}
+
+func TestReleaseFile(t *testing.T) {
+	count := func(m *sync.Map) int {
+		n := 0
+		m.Range(func(_, _ interface{}) bool {
+			n++
+			return true
+		})
+		return n
+	}
+	fst, f := InitEnv("./test_demo/edit_demo.go")
+	assert.NoError(t, ReplaceRegion(fst, f, "models", "type Model struct{}", nil))
+	assert.True(t, RenameFunc(f, "Old", "Older"))
+	snippetCount, hintCount := count(&snippets), count(&declHints)
+
+	// 快照中的声明信息不写入全局的表，恢复时替换文件当前声明的信息
+	s := Snapshot(f)
+	assert.Equal(t, snippetCount, count(&snippets))
+	assert.Equal(t, hintCount, count(&declHints))
+	assert.True(t, AddFunc(f, &AstFunc{Name: "Hello"}))
+	s.Restore()
+	s.Restore()
+	assert.Equal(t, snippetCount, count(&snippets))
+	assert.Equal(t, hintCount, count(&declHints))
+
+	ReleaseFile(f)
+	_, ok := fileSets.Load(f)
+	assert.False(t, ok)
+	_, ok = sources.Load(f)
+	assert.False(t, ok)
+	for _, decl := range f.Decls {
+		_, ok = snippets.Load(decl)
+		assert.False(t, ok)
+		_, ok = declHints.Load(decl)
+		assert.False(t, ok)
+	}
+}
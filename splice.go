@@ -0,0 +1,423 @@
+package ozastutil
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// 按原始源码拼接输出
+//
+// 整个文件交给 format.Node 时，未修改的代码也会重新排版，原来没有 gofmt 的文件会产生大量无关的差异。
+// 文件关联了解析时的源码后，formatFile 只重新输出修改过的顶层声明并替换原来的字节，
+// 未修改的声明、声明之间的空行及注释原样保留；新声明插入到参考位置所在的行，没有参考位置时放在前一个声明之后，
+// 删除的声明连同其后的空行一起删除。无法拼接时（如声明顺序改变、package 子句被修改）仍然格式化整个文件。
+
+// sources 保存 *ast.File => 解析时的源码
+var sources sync.Map
+
+// BindSource 关联文件及解析时的源码，InitEnv 等从磁盘加载的文件已经自动关联
+//  源码与 FileSet 中记录的文件大小不一致时忽略
+func BindSource(fset *token.FileSet, f *ast.File, src []byte) {
+	if tf := fset.File(f.Package); tf != nil && tf.Size() == len(src) {
+		sources.Store(f, src)
+	}
+}
+
+// spliceDecl 原始源码中的顶层声明
+type spliceDecl struct {
+	decl     ast.Decl
+	from, to int // 包括文档注释的范围
+	pos, end int
+	matched  bool
+	replace  []string
+}
+
+// spliceEdit 对原始源码的一处修改，将 [from, to) 替换为 text
+type spliceEdit struct {
+	from, to int
+	text     string
+}
+
+// spliceFile 将修改过的声明拼接到原始源码中，文件没有关联源码或无法拼接时返回 false
+func spliceFile(fset *token.FileSet, f *ast.File) ([]byte, bool) {
+	v, ok := sources.Load(f)
+	if !ok {
+		return nil, false
+	}
+	src := v.([]byte)
+	tf := fset.File(f.Package)
+	if tf == nil || tf.Size() != len(src) {
+		return nil, false
+	}
+	pfset := token.NewFileSet()
+	pf, err := parser.ParseFile(pfset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, false
+	}
+	off := func(pos token.Pos) int {
+		if !pos.IsValid() || int(pos) < tf.Base() || int(pos) > tf.Base()+tf.Size() {
+			return -1
+		}
+		return tf.Offset(pos)
+	}
+	poff := func(pos token.Pos) int {
+		if !pos.IsValid() {
+			return -1
+		}
+		return pfset.File(pos).Offset(pos)
+	}
+	// package 子句及文件注释不变
+	if off(f.Package) != poff(pf.Package) || !sameSource(f.Name, off, pf.Name, poff) || !sameSource(f.Doc, off, pf.Doc, poff) {
+		return nil, false
+	}
+	header := poff(pf.Name.End())
+
+	pdecls := make([]*spliceDecl, 0, len(pf.Decls))
+	for _, decl := range pf.Decls {
+		from, to := declRange(decl)
+		pdecls = append(pdecls, &spliceDecl{decl: decl, from: poff(from), to: poff(to), pos: poff(decl.Pos()), end: poff(decl.End())})
+	}
+	// 原有的声明按位置对应到原始源码中的声明，import 添加成员后位置可能移到了声明末尾
+	matches := make([]*spliceDecl, len(f.Decls))
+	for i, decl := range f.Decls {
+		if _, ok := snippets.Load(decl); ok || isNewDecl(decl) {
+			continue
+		}
+		pos, end := off(decl.Pos()), off(decl.End())
+		for _, p := range pdecls {
+			if !p.matched && pos != -1 && (p.pos == pos || p.end == end) {
+				p.matched, matches[i] = true, p
+				break
+			}
+		}
+	}
+	nextFrom := func(i int) int {
+		for ; i < len(matches); i++ {
+			if matches[i] != nil {
+				return matches[i].from
+			}
+		}
+		return len(src)
+	}
+
+	used := make(map[*ast.CommentGroup]bool)
+	edits := make([]spliceEdit, 0)
+	prevEnd, cursor, lineMode, lineSep := header, header, false, false
+	for i, decl := range f.Decls {
+		if p := matches[i]; p != nil {
+			if p.from < prevEnd {
+				return nil, false
+			}
+			if !sameDecl(f, decl, off, p, pf, poff, used) {
+				text, ok := renderDecl(fset, f, decl, used)
+				if !ok {
+					return nil, false
+				}
+				edits = append(edits, spliceEdit{from: p.from, to: p.to, text: text})
+			}
+			prevEnd, cursor, lineMode = p.to, p.to, false
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := formatNewDecl(&buf, fset, decl); err != nil {
+			return nil, false
+		}
+		text := tidyDecl(buf.Bytes())
+		limit := nextFrom(i + 1)
+		hint := -1
+		if pos := declHint(decl); pos.IsValid() {
+			hint = off(pos)
+		}
+		if hint < prevEnd || hint > limit {
+			hint = -1
+		}
+		// 参考位置位于被替换的声明中时输出在原声明的位置
+		if replaced := replacedDecl(pdecls, hint); replaced != nil && replaced.from >= cursor {
+			replaced.replace = append(replaced.replace, text)
+			cursor, lineMode = replaced.to, false
+			continue
+		}
+		if hint != -1 {
+			if line := lineStart(string(src), hint); line >= cursor && !inMatched(pdecls, line) {
+				cursor, lineMode, lineSep = line, true, needsSep(src, line)
+			}
+		}
+		if lineMode {
+			if lineSep {
+				text = "\n" + text
+				lineSep = false
+			}
+			if cursor == len(src) {
+				edits = append(edits, spliceEdit{from: cursor, to: cursor, text: text + "\n"})
+				continue
+			}
+			edits = append(edits, spliceEdit{from: cursor, to: cursor, text: text + "\n\n"})
+		} else {
+			edits = append(edits, spliceEdit{from: cursor, to: cursor, text: "\n\n" + text})
+		}
+	}
+	// 没有对应的原声明被删除或替换
+	for _, p := range pdecls {
+		switch {
+		case p.matched:
+		case len(p.replace) > 0:
+			edits = append(edits, spliceEdit{from: p.from, to: p.to, text: joinDecls(p.replace)})
+		default:
+			from, to := deleteRange(src, p.from, p.to)
+			edits = append(edits, spliceEdit{from: from, to: to})
+		}
+	}
+	// 声明之间的游离注释：被删除的注释从源码中删除，新增的注释无法确定位置，交给 format 处理
+	kept := make(map[int]string)
+	for _, c := range f.Comments {
+		// package 子句之前的注释不会修改，原样保留
+		if from := off(c.Pos()); !used[c] && (from == -1 || from >= header) {
+			kept[from] = commentText(c)
+		}
+	}
+	for _, c := range pf.Comments {
+		from := poff(c.Pos())
+		if from < header || inDecl(pdecls, from) {
+			continue
+		}
+		if text, ok := kept[from]; ok && text == commentText(c) {
+			delete(kept, from)
+			continue
+		}
+		from, to := deleteRange(src, from, poff(c.End()))
+		edits = append(edits, spliceEdit{from: from, to: to})
+	}
+	for from := range kept {
+		if from < header || !inDecl(pdecls, from) {
+			return nil, false
+		}
+	}
+
+	out, ok := applyEdits(src, edits)
+	if !ok {
+		return nil, false
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", out, parser.ParseComments); err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// sameDecl 判断声明及其范围内的注释与原始源码中的声明是否完全相同，相同时将注释标记为已输出
+func sameDecl(f *ast.File, decl ast.Decl, off func(token.Pos) int, p *spliceDecl, pf *ast.File, poff func(token.Pos) int, used map[*ast.CommentGroup]bool) bool {
+	if !sameSource(decl, off, p.decl, poff) {
+		return false
+	}
+	var cur, orig []*ast.CommentGroup
+	for _, c := range f.Comments {
+		if pos := off(c.Pos()); pos >= p.from && pos < p.to {
+			cur = append(cur, c)
+		}
+	}
+	for _, c := range pf.Comments {
+		if pos := poff(c.Pos()); pos >= p.from && pos < p.to {
+			orig = append(orig, c)
+		}
+	}
+	if !sameSource(cur, off, orig, poff) {
+		return false
+	}
+	for _, c := range cur {
+		used[c] = true
+	}
+	return true
+}
+
+// renderDecl 输出修改过的原有声明及其范围内的注释
+func renderDecl(fset *token.FileSet, f *ast.File, decl ast.Decl, used map[*ast.CommentGroup]bool) (string, bool) {
+	from, to := declRange(decl)
+	var comments []*ast.CommentGroup
+	for _, c := range f.Comments {
+		if c.Pos() >= from && c.End() <= to {
+			comments = append(comments, c)
+			used[c] = true
+		}
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, &printer.CommentedNode{Node: decl, Comments: comments}); err != nil {
+		return "", false
+	}
+	return tidyDecl(buf.Bytes()), true
+}
+
+// tidyDecl 对单独输出的声明再格式化一次，去掉 printer 对没有位置信息的节点输出的多余逗号和换行，
+// 加上 package 子句作为完整的文件格式化，import 才会排序
+func tidyDecl(src []byte) string {
+	const pkg = "package p\n\n"
+	if out, err := format.Source(append([]byte(pkg), src...)); err == nil {
+		src = bytes.TrimPrefix(out, []byte(pkg))
+	}
+	return string(bytes.TrimRight(src, "\n"))
+}
+
+// replacedDecl 返回范围包含 offset 且已被删除的原声明
+func replacedDecl(pdecls []*spliceDecl, offset int) *spliceDecl {
+	if offset == -1 {
+		return nil
+	}
+	for _, p := range pdecls {
+		if !p.matched && offset >= p.from && offset <= p.to {
+			return p
+		}
+	}
+	return nil
+}
+
+// inMatched 判断 offset 是否位于保留的原声明中
+func inMatched(pdecls []*spliceDecl, offset int) bool {
+	for _, p := range pdecls {
+		if p.matched && offset > p.from && offset < p.to {
+			return true
+		}
+	}
+	return false
+}
+
+// inDecl 判断 offset 是否位于某个原声明中
+func inDecl(pdecls []*spliceDecl, offset int) bool {
+	for _, p := range pdecls {
+		if offset >= p.from && offset < p.to {
+			return true
+		}
+	}
+	return false
+}
+
+// joinDecls 拼接替换同一个原声明的多个新声明
+func joinDecls(list []string) string {
+	var buf bytes.Buffer
+	for i, text := range list {
+		if i > 0 {
+			buf.WriteString("\n\n")
+		}
+		buf.WriteString(text)
+	}
+	return buf.String()
+}
+
+// commentText 返回注释组的原文
+func commentText(c *ast.CommentGroup) string {
+	var buf bytes.Buffer
+	writeComments(&buf, []*ast.CommentGroup{c})
+	return buf.String()
+}
+
+// needsSep 判断在 line 行之前插入声明时是否需要补一个空行：上一行是代码而不是空行或注释
+func needsSep(src []byte, line int) bool {
+	if line == 0 || line == 1 || src[line-2] == '\n' {
+		return false
+	}
+	prev := bytes.TrimSpace(src[lineStart(string(src), line-1) : line-1])
+	return !bytes.HasPrefix(prev, []byte("//")) && !bytes.HasPrefix(prev, []byte("/*"))
+}
+
+// deleteRange 扩展删除范围：包括行尾的换行，前面是空行时同时删除后面的空行，删除到文件末尾时删除前面的空行
+func deleteRange(src []byte, from, to int) (int, int) {
+	for to < len(src) && (src[to] == ' ' || src[to] == '\t') {
+		to++
+	}
+	if to < len(src) && src[to] == '\n' {
+		to++
+	}
+	if from >= 2 && src[from-1] == '\n' && src[from-2] == '\n' {
+		for to < len(src) && src[to] == '\n' {
+			to++
+		}
+	}
+	if to == len(src) {
+		for from >= 2 && src[from-1] == '\n' && src[from-2] == '\n' {
+			from--
+		}
+	}
+	return from, to
+}
+
+// applyEdits 按位置依次修改原始源码，同一位置的插入保持添加的顺序
+func applyEdits(src []byte, edits []spliceEdit) ([]byte, bool) {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].from < edits[j].from
+	})
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		if e.from < last {
+			return nil, false
+		}
+		buf.Write(src[last:e.from])
+		buf.WriteString(e.text)
+		last = e.to
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), true
+}
+
+var posType = reflect.TypeOf(token.NoPos)
+
+// sameSource 判断两个语法树是否完全相同，位置按各自文件中的偏移量比较
+func sameSource(x interface{}, xoff func(token.Pos) int, y interface{}, yoff func(token.Pos) int) bool {
+	return sameValue(reflect.ValueOf(x), xoff, reflect.ValueOf(y), yoff)
+}
+
+func sameValue(x reflect.Value, xoff func(token.Pos) int, y reflect.Value, yoff func(token.Pos) int) bool {
+	if x.IsValid() != y.IsValid() {
+		return false
+	}
+	if !x.IsValid() {
+		return true
+	}
+	if x.Type() != y.Type() {
+		return false
+	}
+	if x.Type() == posType {
+		return xoff(token.Pos(x.Int())) == yoff(token.Pos(y.Int()))
+	}
+	switch x.Kind() {
+	case reflect.Ptr:
+		if x.Type() == objectType || x.Type() == scopeType {
+			return true
+		}
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return sameValue(x.Elem(), xoff, y.Elem(), yoff)
+	case reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return sameValue(x.Elem(), xoff, y.Elem(), yoff)
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if x.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if !sameValue(x.Field(i), xoff, y.Field(i), yoff) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if x.Len() != y.Len() {
+			return false
+		}
+		for i := 0; i < x.Len(); i++ {
+			if !sameValue(x.Index(i), xoff, y.Index(i), yoff) {
+				return false
+			}
+		}
+		return true
+	}
+	return x.Interface() == y.Interface()
+}
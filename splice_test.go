@@ -0,0 +1,59 @@
+package ozastutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSpliceFile(t *testing.T) {
+	fst, f := InitEnv("./test_demo/splice_demo.go")
+	origin, err := ioutil.ReadFile("./test_demo/splice_demo.go")
+	assert.NoError(t, err)
+
+	// 没有修改时原样输出
+	src, err := FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(origin), string(src))
+
+	// 只有修改过的声明重新排版
+	assert.True(t, AddValueToMap(f, "handlers", AddQuote("b"), "2"))
+	src, err = FormatFile(fst, f)
+	assert.NoError(t, err)
+	expected := strings.Replace(string(origin), `var handlers = map[string]int{"a":1}`, `var handlers = map[string]int{"a": 1, "b": 2}`, 1)
+	assert.Equal(t, expected, string(src))
+
+	// 新声明插入到标记之前，删除的声明连同空行一起删除
+	assert.True(t, AddFuncAt(f, &AstFunc{Name: "World"}, &AstInsertPos{Marker: "// astutil:funcs"}))
+	matches, err := Query(f, "func[name=Old]")
+	assert.NoError(t, err)
+	assert.True(t, DeleteNode(f, matches[0]))
+	src, err = FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(src), "package test_demo\n\nimport \"fmt\"\n\n// 注释保持原样\nvar   name  =   \"splice\"\n\n\nvar handlers"))
+	assert.Contains(t, string(src), "type Stu struct {\n\tName    string\n}\n\nfunc  Hello()  {\n\tfmt.Println(name)\n}\n\nfunc World() {\n}\n\n// astutil:funcs\n")
+	assert.NotContains(t, string(src), "Old")
+	PrintResult(fst, f)
+}
+
+func TestBindSource(t *testing.T) {
+	origin, err := ioutil.ReadFile("./test_demo/splice_demo.go")
+	assert.NoError(t, err)
+	fst := token.NewFileSet()
+	f, err := parser.ParseFile(fst, "./test_demo/splice_demo.go", origin, parser.ParseComments)
+	assert.NoError(t, err)
+
+	// BindFileSet 不读取文件，没有源码时格式化整个文件
+	BindFileSet(fst, f)
+	src, err := FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.NotEqual(t, string(origin), string(src))
+
+	BindSource(fst, f, origin)
+	src, err = FormatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(origin), string(src))
+}
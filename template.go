@@ -0,0 +1,329 @@
+package ozastutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// TemplateError 模板渲染结果不是合法的 Go 代码
+type TemplateError struct {
+	// Line 渲染结果中出错的行号，从 1 开始
+	Line int
+	// Text 渲染结果中出错的行
+	Text string
+	// TemplateLine 出错的行在模板中的行号，该行不含模板动作时才能确定，无法确定时为 0
+	TemplateLine int
+	Err          error
+}
+
+func (e *TemplateError) Error() string {
+	if e.TemplateLine > 0 {
+		return fmt.Sprintf("line %d (template line %d): %v: %s", e.Line, e.TemplateLine, e.Err, e.Text)
+	}
+	return fmt.Sprintf("line %d: %v: %s", e.Line, e.Err, e.Text)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// RenderDecls 使用 data 渲染 text/template 模板，将得到的声明合并到文件中
+//
+// 渲染结果可以省略 package 子句，其中的 import 与文件已有的 import 去重后合并，
+// 其他声明按 pos 插入，pos 为 nil 时添加到文件末尾，pos.Marker 不为空时插入到标记注释之前。
+// 文件中已存在同名的声明时返回错误且不修改文件，pos.Replace 为 true 时原位替换。
+// 渲染结果不是合法的 Go 代码时返回 *TemplateError
+//
+// 测试数据：
+//
+// import "fmt"
+//
+// 执行：
+//
+// RenderDecls(fset, f, `import "strings"
+//
+// func {{.Name}}() string {
+//	return strings.ToUpper("{{.Name}}")
+// }`, map[string]string{"Name": "hello"}, nil)
+//
+// 结果为：
+//
+// import (
+//	"fmt"
+//	"strings"
+// )
+//
+// func hello() string {
+//	return strings.ToUpper("hello")
+// }
+func RenderDecls(fset *token.FileSet, f *ast.File, tmpl string, data interface{}, pos *AstInsertPos) error {
+	src, err := renderTemplate(tmpl, data)
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if !strings.HasPrefix(strings.TrimSpace(src), "package ") {
+		prefix = "package p\n\n"
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", prefix+src, parser.ParseComments); err != nil {
+		return templateError(tmpl, src, err, strings.Count(prefix, "\n"))
+	}
+	decls, err := parseDecls(src)
+	if err != nil {
+		return err
+	}
+	index, hint := getInsertIndex(f, pos, "", ""), token.NoPos
+	if pos != nil && pos.Marker != "" {
+		var c *ast.Comment
+		if index, c = findDeclMarker(f, pos.Marker); c != nil {
+			hint = c.Pos()
+		}
+	}
+	if index == -1 {
+		return fmt.Errorf("anchor not found")
+	}
+	// 修改文件之前检查同名的声明
+	if pos == nil || !pos.Replace {
+		for _, decl := range decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+				continue
+			}
+			if key := declKey(decl); findDeclKey(f, key) != -1 {
+				return fmt.Errorf("decl %s already exists", key)
+			}
+		}
+	}
+	for _, decl := range decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			mergeImports(fset, f, gen)
+			continue
+		}
+		if i := findDeclKey(f, declKey(decl)); i != -1 {
+			removeComments(f, f.Decls[i])
+			replaceDecl(f, i, decl)
+			continue
+		}
+		if hint.IsValid() {
+			setDeclHint(decl, hint)
+		}
+		insertDecls(f, index-1, decl)
+		index++
+	}
+	return nil
+}
+
+// RenderStmts 使用 data 渲染 text/template 模板，将得到的语句插入到函数中
+//
+// 渲染结果开头可以包含 import，与文件已有的 import 去重后合并。
+// 语句插入到 afterVar 变量的定义之后，afterVar 为空时插入到最后的 return 之前，没有 return 时添加到末尾，
+// afterVar 为标记注释时插入到标记之前。
+// 除插入到标记之前外，插入的语句不保留注释。渲染结果不是合法的 Go 代码时返回 *TemplateError
+//
+// 测试数据：
+//
+// func t() {
+//	var a = 1
+//	return
+// }
+//
+// 执行：RenderStmts(fset, f, "t", `fmt.Println({{.}})`, "a", "")
+//
+// 结果为：
+//
+// func t() {
+//	var a = 1
+//	fmt.Println(a)
+//	return
+// }
+func RenderStmts(fset *token.FileSet, f *ast.File, funcName, tmpl string, data interface{}, afterVar string) error {
+	_, fd := findFunc(f, funcName)
+	if fd == nil || fd.Body == nil {
+		return fmt.Errorf("func %s not found", funcName)
+	}
+	src, err := renderTemplate(tmpl, data)
+	if err != nil {
+		return err
+	}
+	imports, stmts := splitImports(src)
+	// 语句紧跟在 func _() { 之后，与渲染结果相比只多出 package 子句两行
+	wrapped := "package p\n\n" + imports + "func _() {" + stmts + "\n}\n"
+	tmpF, err := parser.ParseFile(token.NewFileSet(), "", wrapped, 0)
+	if err != nil {
+		return templateError(tmpl, src, err, 2)
+	}
+	for _, decl := range tmpF.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			clearPos(d)
+			mergeImports(fset, f, d)
+		case *ast.FuncDecl:
+			// 标记处直接插入渲染结果，模板中的注释一并保留
+			if isMarker(afterVar) {
+				if !insertSourceAtMarker(f, fd.Body, fd.Body.Lbrace, fd.Body.Rbrace, afterVar, strings.TrimSpace(stmts)) {
+					return fmt.Errorf("marker %s not found", afterVar)
+				}
+				continue
+			}
+			// 同样直接插入渲染结果，插入的语句使用重新解析得到的位置
+			if !insertNode(f, fd.Body, stmtInsertIndex(fd, afterVar), strings.TrimSpace(stmts)) {
+				return fmt.Errorf("insert into func %s failed", funcName)
+			}
+		}
+	}
+	return nil
+}
+
+// renderTemplate 渲染模板
+func renderTemplate(tmpl string, data interface{}) (string, error) {
+	t, err := template.New("astutil").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// templateError 将解析错误转换为 *TemplateError，offset 为渲染结果之前多出的行数
+func templateError(tmpl, src string, err error, offset int) error {
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return err
+	}
+	line := list[0].Pos.Line - offset
+	lines := strings.Split(src, "\n")
+	if line < 1 {
+		line = 1
+	}
+	if line > len(lines) {
+		line = len(lines)
+	}
+	e := &TemplateError{Line: line, Text: strings.TrimSpace(lines[line-1]), Err: errors.New(list[0].Msg)}
+	if e.Text != "" {
+		for i, tl := range strings.Split(tmpl, "\n") {
+			if strings.TrimSpace(tl) == e.Text {
+				if e.TemplateLine != 0 {
+					e.TemplateLine = 0
+					break
+				}
+				e.TemplateLine = i + 1
+			}
+		}
+	}
+	return e
+}
+
+// splitImports 将渲染结果开头的 import 与其余的语句分开
+func splitImports(src string) (imports, stmts string) {
+	lines := strings.Split(src, "\n")
+	i := 0
+	for i < len(lines) {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "import ("):
+			for i < len(lines) && strings.TrimSpace(lines[i]) != ")" {
+				i++
+			}
+		case strings.HasPrefix(line, "import "):
+		case i == 0:
+			return "", src
+		default:
+			return strings.Join(lines[:i], "\n") + "\n", strings.Join(lines[i:], "\n")
+		}
+		i++
+	}
+	return src, ""
+}
+
+// mergeImports 将 import 声明中文件未导入的包合并到文件中
+func mergeImports(fset *token.FileSet, f *ast.File, gen *ast.GenDecl) {
+	for _, spec := range gen.Specs {
+		s := spec.(*ast.ImportSpec)
+		if !hasImport(f, importPath(s)) {
+			AddImport(fset, f, importName(s), importPath(s))
+		}
+	}
+}
+
+// stmtInsertIndex 返回语句插入的下标，规则与 AddVarToFunc 一致
+func stmtInsertIndex(fd *ast.FuncDecl, afterVar string) int {
+	list := fd.Body.List
+	if afterVar == "" {
+		if len(list) > 0 {
+			if _, ok := list[len(list)-1].(*ast.ReturnStmt); ok {
+				return len(list) - 1
+			}
+		}
+		return len(list)
+	}
+	for i, stmt := range list {
+		switch s := stmt.(type) {
+		case *ast.DeclStmt:
+			if gen, ok := s.Decl.(*ast.GenDecl); ok {
+				for _, spec := range gen.Specs {
+					if vs, ok := spec.(*ast.ValueSpec); ok {
+						for _, id := range vs.Names {
+							if id.Name == afterVar {
+								return i + 1
+							}
+						}
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			for _, lhs := range s.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && id.Name == afterVar {
+					return i + 1
+				}
+			}
+		}
+	}
+	return len(list)
+}
+
+// clearPos 清除节点中的所有位置信息，使其可以插入到其他文件中
+func clearPos(node ast.Node) {
+	setPos(node, token.NoPos)
+}
+
+// setPos 将节点中的所有位置设置为 pos，替换原有节点时使用原节点的位置，避免输出时多出空行
+func setPos(node ast.Node, pos token.Pos) {
+	var clear func(v reflect.Value)
+	clear = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if !v.IsNil() {
+				clear(v.Elem())
+			}
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				field := v.Field(i)
+				if field.Type() == posType {
+					field.SetInt(int64(pos))
+					continue
+				}
+				if v.Type().Field(i).Name == "Obj" || v.Type().Field(i).Name == "Scope" {
+					// ast.Object 可能循环引用
+					continue
+				}
+				clear(field)
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				clear(v.Index(i))
+			}
+		}
+	}
+	clear(reflect.ValueOf(node))
+}
@@ -0,0 +1,90 @@
+package ozastutil
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRenderDecls(t *testing.T) {
+	fst, f := InitEnv("./test_demo/template_demo.go")
+
+	tmpl := `import (
+	"fmt"
+	"strings"
+)
+
+{{range .}}
+// {{.}} 返回名称
+func (h *Handler) {{.}}() string {
+	return strings.ToUpper("{{.}}")
+}
+{{end}}
+func Old() int {
+	return {{len .}}
+}`
+	// 已存在同名的声明时不修改文件
+	before, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	err = RenderDecls(fst, f, tmpl, []string{"Get", "Post"}, &AstInsertPos{After: "Handler"})
+	assert.Error(t, err)
+	after, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	err = RenderDecls(fst, f, tmpl, []string{"Get", "Post"}, &AstInsertPos{After: "Handler", Replace: true})
+	assert.NoError(t, err)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "import (\n\t\"fmt\"\n\t\"strings\"\n)\n")
+	assert.Contains(t, string(src), "type Handler struct {\n}\n\n// Get 返回名称\nfunc (h *Handler) Get() string {\n\treturn strings.ToUpper(\"Get\")\n}\n\n// Post 返回名称\nfunc (h *Handler) Post() string {\n\treturn strings.ToUpper(\"Post\")\n}\n\nfunc Setup() {")
+	// 同名声明原位替换
+	assert.Contains(t, string(src), "func Old() int {\n\treturn 2\n}\n")
+
+	// 渲染结果不合法时报告出错的行
+	err = RenderDecls(fst, f, "func New() {\n\treturn {{.}\n}", 1, nil)
+	assert.Error(t, err)
+	err = RenderDecls(fst, f, "func New() int {\n\treturn {{.}} +\n}", 1, nil)
+	var te *TemplateError
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, 3, te.Line)
+	assert.Equal(t, "}", te.Text)
+	assert.Equal(t, 3, te.TemplateLine)
+
+	err = RenderDecls(fst, f, "func New() {}", nil, &AstInsertPos{After: "NotFound"})
+	assert.Error(t, err)
+	PrintResult(fst, f)
+}
+
+func TestRenderStmts(t *testing.T) {
+	fst, f := InitEnv("./test_demo/template_demo.go")
+
+	tmpl := `import "strings"
+import "os"
+
+{{range .}}fmt.Println(strings.Repeat("{{.}}", r))
+{{end}}if r > 0 {
+	os.Exit(r)
+}`
+	err := RenderStmts(fst, f, "Setup", tmpl, []string{"a", "b"}, "r")
+	assert.NoError(t, err)
+	err = RenderStmts(fst, f, "Setup", "r++", nil, "")
+	assert.NoError(t, err)
+
+	src, err := formatFile(fst, f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "import (\n\t\"fmt\"\n\t\"os\"\n\t\"strings\"\n)\n")
+	assert.Contains(t, string(src), "func Setup() {\n\tvar r = 1\n\tfmt.Println(strings.Repeat(\"a\", r))\n\tfmt.Println(strings.Repeat(\"b\", r))\n\tif r > 0 {\n\t\tos.Exit(r)\n\t}\n\tfmt.Println(r)\n\tr++\n\treturn\n}")
+
+	var te *TemplateError
+	err = RenderStmts(fst, f, "Setup", "import \"os\"\n\nos.Exit(\n{{.}} :=", "x", "")
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, 4, te.Line)
+	assert.Equal(t, "x :=", te.Text)
+	assert.Equal(t, 0, te.TemplateLine)
+
+	err = RenderStmts(fst, f, "NotFound", "r++", nil, "")
+	assert.Error(t, err)
+	PrintResult(fst, f)
+}
@@ -0,0 +1,34 @@
+package test_demo
+
+import "time"
+
+type Node struct {
+	Name     string
+	Next     *Node
+	Children []*Node
+	Attrs    map[string][]string
+	Meta     Meta
+	Grid     [2][]int
+	Created  time.Time
+	Fn       func()
+	ptr      *int
+	Tags
+}
+
+type Meta struct {
+	Labels map[string]string
+	inline struct {
+		Values []int
+	}
+}
+
+type Tags []string
+
+type Plain struct {
+	ID   int
+	Name string
+}
+
+func (n *Node) String() string {
+	return n.Name
+}
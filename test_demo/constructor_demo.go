@@ -0,0 +1,22 @@
+package test_demo
+
+type Base struct {
+	ID int
+}
+
+type User struct {
+	*Base
+	name string
+	Age  int
+	tags []string
+	_    int
+	u    bool
+}
+
+func (u *User) String() string {
+	return u.name
+}
+
+func (u *User) GetAge() int {
+	return u.Age
+}
@@ -0,0 +1,37 @@
+package test_demo
+
+import "fmt"
+
+type Stu struct {
+	Name string
+}
+
+type Service interface {
+	Get() int
+}
+
+func NewSet(args ...interface{}) []interface{} {
+	return args
+}
+
+var routes = []string{"/"}
+
+var handlers = map[string]int{"a": 1}
+
+var set = NewSet(1)
+
+var conf = &Stu{}
+
+func Setup(a string) {
+	stu := &Stu{}
+	fmt.Println(a, stu)
+}
+
+func Old() {
+}
+
+func Rename() {
+}
+
+func Replace() {
+}
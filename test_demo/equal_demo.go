@@ -0,0 +1,22 @@
+package test_demo
+
+type Point struct {
+	X, Y  int
+	Label *string
+}
+
+type Shape struct {
+	Name   string
+	Center Point
+	Points []Point
+	Attrs  map[string][]int
+	Parent *Shape
+	Ratio  *float64
+	Grid   [2]int
+	Opt    struct {
+		On    bool
+		Cache []byte `astutil:"-"`
+	}
+	OnDraw func()
+	cache  map[string]int `json:"-" astutil:"-"`
+}
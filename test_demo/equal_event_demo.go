@@ -0,0 +1,16 @@
+package test_demo
+
+import "time"
+
+type Event struct {
+	Name     string
+	Handlers map[string]func()
+	Hooks    []func()
+	At       time.Time
+	Extra    Listener
+	Payload  interface{}
+}
+
+type Listener interface {
+	Get() string
+}
@@ -0,0 +1,41 @@
+package test_demo
+
+import "context"
+
+// Animal 动物
+type Animal struct {
+	name string
+}
+
+// AnimalService 动物服务
+type AnimalService interface {
+	// Name 旧的注释
+	Name() int
+	// Stale 类型中已不存在的方法
+	Stale()
+}
+
+// Name 返回名称
+func (a *Animal) Name() string {
+	return a.name
+}
+
+// Run 奔跑
+func (a Animal) Run(ctx context.Context, speed int) (err error) {
+	return nil
+}
+
+func (a *Animal) rest() {
+}
+
+func (a *Animal) Close() error {
+	return nil
+}
+
+type (
+	Other int
+
+	Grouped interface {
+		Close() error
+	}
+)
@@ -0,0 +1,6 @@
+package test_demo
+
+// Eat 进食
+func (a *Animal) Eat(food ...string) bool {
+	return true
+}
@@ -0,0 +1,56 @@
+package test_demo
+
+import "fmt"
+
+// TT 普通函数
+func TT(a string) string {
+	return a
+}
+
+// Stu 测试结构体
+type Stu struct {
+}
+
+// TT 与普通函数同名的方法
+func (s *Stu) TT() string {
+	// 调用普通函数
+	return TT("tt")
+}
+
+// PStuFunc 指针接收者方法
+func (s *Stu) PStuFunc(a string) (ret string) {
+	return s.TT() + a
+}
+
+// StuFunc 值接收者方法
+func (s Stu) StuFunc(a string) (ret string) {
+	return a
+}
+
+func useStu() {
+	stu := &Stu{}
+	var other Stu
+	fmt.Println(stu.PStuFunc("a"), other.StuFunc("b"), TT("c"))
+	f := (*Stu).PStuFunc
+	fmt.Println(f)
+}
+
+// shadow 局部变量与函数同名
+func shadow() {
+	TT := "local"
+	fmt.Println(TT)
+}
+
+// nested 内层作用域中的同名变量
+func nested() string {
+	if true {
+		TT := 2
+		_ = TT
+	}
+	value := 1
+	end()
+	return TT("n") + fmt.Sprint(value)
+}
+
+// end 最后一个函数
+func end() {}
@@ -0,0 +1,61 @@
+package test_demo
+
+import (
+	"fmt"
+	str "strings"
+)
+
+// Stu 学生
+type Stu struct {
+	Name string `json:"name"`
+	Age  int
+	*Base
+}
+
+type Base struct{}
+
+type Store interface {
+	fmt.Stringer
+	// Get 获取学生
+	Get(id int) (*Stu, error)
+}
+
+type Names = []string
+
+type Scores map[string]int
+
+const (
+	A = iota
+	B
+)
+
+var (
+	a, b    = pair()
+	stuName = str.ToUpper("stu")
+)
+
+var scores Scores
+
+// Hello 打招呼
+func (s *Stu) Hello(prefix string) string {
+	return prefix + s.Name
+}
+
+func pair() (int, int) {
+	return 1, 2
+}
+
+func Setup(a string, b, c int) (err error) {
+	stu := &Stu{}
+	var n int
+	for i, v := range []int{1} {
+		n += i + v
+	}
+	fn := func() {
+		inner := 1
+		fmt.Println(inner)
+	}
+	fn()
+	fmt.Println(a, b, c, stu, n)
+	return
+}
@@ -0,0 +1,42 @@
+package test_demo
+
+import (
+	"context"
+	"fmt"
+)
+
+type Base interface {
+	ID() int
+}
+
+type Service interface {
+	Base
+	error
+	Get(id int) (*Impl, error)
+	Names() []string
+	Count() (n int)
+	Save(Impl, map[string]int, ...string) (Impl, bool, Kind)
+	Close()
+}
+
+type Kind int
+
+type Impl struct {
+}
+
+func (i *Impl) ID() int {
+	return 1
+}
+
+type External interface {
+	fmt.Stringer
+}
+
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+type Pinger interface {
+	Runner
+	Ping() error
+}
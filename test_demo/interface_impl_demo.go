@@ -0,0 +1,9 @@
+package test_demo
+
+type Worker struct {
+}
+
+// Ping 与接口中的签名不同
+func (w *Worker) Ping() string {
+	return ""
+}
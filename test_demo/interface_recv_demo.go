@@ -0,0 +1,16 @@
+package test_demo
+
+type Saver interface {
+	Save(s string, store int) error
+}
+
+type Store struct {
+}
+
+// Open 第一个方法的接收者名称
+func (s *Store) Open() {
+}
+
+// Close 与 Open 的接收者名称不同
+func (st *Store) Close() {
+}
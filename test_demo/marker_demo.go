@@ -0,0 +1,52 @@
+package test_demo
+
+import "fmt"
+
+type Model struct {
+	ID int
+	// astutil:fields
+	Name string
+}
+
+type Service interface {
+	Get() int
+	// astutil:methods
+}
+
+var routes = []string{
+	"/",
+	// astutil:routes
+}
+
+var handlers = map[string]int{
+	"a": 1,
+	// astutil:handlers
+}
+
+var conf = &Model{
+	ID: 1,
+	// astutil:conf
+}
+
+// astutil:vars
+
+func Setup() {
+	var r = 1
+	// astutil:setup
+	fmt.Println(r)
+	switch r {
+	case 1:
+		fmt.Println(1)
+		// astutil:case
+	default:
+	}
+	m := &Model{
+		// astutil:model
+	}
+	fmt.Println(m)
+}
+
+// astutil:funcs
+
+func End() {
+}
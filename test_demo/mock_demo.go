@@ -0,0 +1,17 @@
+package test_demo
+
+import (
+	"context"
+	ctxio "io"
+)
+
+// Store 存储
+type Store interface {
+	Base
+	// Get 根据 id 获取数据
+	Get(ctx context.Context, id int) (*Impl, error)
+	Put(context.Context, Impl, ...string) (n int, err error)
+	Reader(m string) ctxio.Reader
+	Copy(a, A string)
+	Close()
+}
@@ -0,0 +1,37 @@
+package test_demo // 行尾注释
+
+// Model 模型
+type Model struct {
+	// ID 主键
+	ID int // 行尾注释
+	// Name 名称
+	Name string
+}
+
+// routes 路由
+var routes = []string{"/"}
+
+// handlers 处理函数
+var handlers = map[string]int{
+	// a 的说明
+	"a": 1, // 行尾注释
+}
+
+// conf 配置
+var conf = &Model{
+	ID: 1,
+}
+
+// Setup 初始化
+func Setup() {
+	// r 的说明
+	r := 1
+	fmt.Println(r) // 输出
+	// 返回前的注释
+	return
+}
+
+// Empty 空函数
+func Empty() {}
+
+// 文件末尾的注释
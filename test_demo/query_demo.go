@@ -0,0 +1,25 @@
+package test_demo
+
+import "fmt"
+
+type Stu struct {
+	// Name 名称
+	Name string `json:"name"`
+	Age  int
+}
+
+var mapStr = map[string]string{"cc": "cc", "dd": "dd"}
+
+const (
+	A = 1
+)
+
+func Func1(a string) (ret string) {
+	var b = a
+	ret = b
+	if a != "" {
+		ret = a
+	}
+	fmt.Println(ret)
+	return ret
+}
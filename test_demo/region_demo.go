@@ -0,0 +1,27 @@
+package test_demo
+
+import "fmt"
+
+// Hand 手写的类型
+type Hand struct{}
+
+// spaced 没有 gofmt 的声明
+var  spaced   = 1
+
+// Code generated by astutil BEGIN models
+type Old struct{}
+
+// END models
+
+func Run() {
+	var a = 1
+	// Code generated by astutil BEGIN print
+	fmt.Println(a)
+	// END print
+	return
+}
+
+func Other() {
+	var b = 2
+	fmt.Println(b)
+}
@@ -0,0 +1,7 @@
+package test_demo
+
+func callFunc1() string {
+	var stu Stu
+	_ = stu.Method("x")
+	return Func1("x", "y")
+}
@@ -0,0 +1,53 @@
+package test_demo
+
+import "fmt"
+
+type Stu struct {
+}
+
+func Func1(a, b string) (ret string) {
+	var c = a
+	ret = c + b
+	return
+}
+
+func Func2(a string) string {
+	if a == "" {
+		return "empty"
+	}
+	return a
+}
+
+func Func3(string, int) (_ int, err error) {
+	return
+}
+
+func Func4(a int) int {
+	for a := 0; a < 1; a++ {
+		_ = a
+	}
+	n := 1
+	return a + n
+}
+
+func Func5() (string, error) {
+	return Func6()
+}
+
+func Func6() (string, error) {
+	return "", nil
+}
+
+func (s *Stu) Method(a string) error {
+	return nil
+}
+
+func useFunc() {
+	stu := &Stu{}
+	fmt.Println(Func1("a", "b"), Func2("a"))
+	fmt.Println(stu.Method("a"), (*Stu).Method(stu, "b"))
+	f := func(Func1 string) {
+		fmt.Println(Func1)
+	}
+	f("c")
+}
@@ -0,0 +1,22 @@
+package test_demo
+
+import "fmt"
+
+// 注释保持原样
+var   name  =   "splice"
+
+
+var handlers = map[string]int{"a":1}
+
+type Stu struct {
+	Name    string
+}
+
+func  Hello()  {
+	fmt.Println(name)
+}
+
+// astutil:funcs
+
+func Old() {
+}
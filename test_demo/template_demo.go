@@ -0,0 +1,16 @@
+package test_demo
+
+import "fmt"
+
+type Handler struct {
+}
+
+func Setup() {
+	var r = 1
+	fmt.Println(r)
+	return
+}
+
+func Old() int {
+	return 0
+}
@@ -2,6 +2,7 @@ package test_demo
 
 type Struct1 struct {
 	Name string
+	Key  string
 }
 
 func NewSet(...interface{}) Struct1 {
@@ -12,4 +13,11 @@ var tt = NewSet(12,"cc")
 
 var xx = &Struct1{
 	Name: "str",
-}
\ No newline at end of file
+}
+
+// Struct2 不是直接以 struct 定义的类型
+type Struct2 Struct1
+
+var yy = &Struct2{
+	Name: "str",
+}
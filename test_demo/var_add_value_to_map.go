@@ -5,4 +5,5 @@ var mapInt = map[int]string{1:"cc"}
 
 var mapInf = map[string]interface{}{ "cc": 1}
 
-
+// aaa 作为变量添加到 mapInf 中
+var aaa = 1
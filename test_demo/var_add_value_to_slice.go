@@ -1,3 +1,6 @@
 package test_demo
 
 var sliceStr = []string{"1"}
+
+// hello 作为变量添加到 sliceStr 中
+var hello = "hello"
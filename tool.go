@@ -6,25 +6,81 @@ import (
 	"go/ast"
 	"go/format"
 	"go/parser"
+	"go/printer"
 	"go/token"
 	"io/ioutil"
+	"strings"
+	"sync"
 )
 
 func InitEnv(path string) (fset *token.FileSet, f *ast.File) {
 	fset = token.NewFileSet()
-	f, err := parser.ParseFile(fset, path, nil, 0)
+	f, err := parseFile(fset, path)
 	if err != nil {
 		panic(err)
 	}
 	return
 }
 
+// InitEnvs 加载同一个包中的多个文件，文件共用一个 FileSet，处理完后可以调用 ReleaseFile 释放文件的状态
+func InitEnvs(paths ...string) (fset *token.FileSet, files []*ast.File) {
+	fset = token.NewFileSet()
+	for _, path := range paths {
+		f, err := parseFile(fset, path)
+		if err != nil {
+			panic(err)
+		}
+		files = append(files, f)
+	}
+	return
+}
+
+// parseFile 读取并解析文件，关联 FileSet 及读取到的源码，源码只读取一次
+func parseFile(fset *token.FileSet, path string) (*ast.File, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	BindFileSet(fset, f)
+	BindSource(fset, f, src)
+	return f, nil
+}
+
+// fileSets 保存 *ast.File => *token.FileSet
+var fileSets sync.Map
+
+// BindFileSet 关联文件及解析文件时使用的 FileSet
+//  在函数、类型或字面量内部的标记注释处插入代码时需要用它重新输出所在的声明，
+//  InitEnv 及 InitEnvs 解析的文件已经自动关联。这里不读取文件，需要按原始源码拼接输出时另外调用 BindSource
+func BindFileSet(fset *token.FileSet, files ...*ast.File) {
+	for _, f := range files {
+		fileSets.Store(f, fset)
+	}
+}
+
+// ReleaseFile 释放文件关联的 FileSet、源码、幂等模式等状态以及新声明的排版信息
+//  这些状态按文件及声明保存在包级别的表中，长时间运行的程序处理完文件后应当调用，释放后不应再修改或输出文件
+func ReleaseFile(files ...*ast.File) {
+	for _, f := range files {
+		fileSets.Delete(f)
+		sources.Delete(f)
+		editStates.Delete(f)
+		for _, decl := range f.Decls {
+			releaseDecl(decl)
+		}
+	}
+}
+
 func PrintResult(fset *token.FileSet, f *ast.File) {
-	var buf bytes.Buffer
-	if err := format.Node(&buf, fset, f); err != nil {
+	src, err := formatFile(fset, f)
+	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("%s", buf.Bytes())
+	fmt.Printf("%s", src)
 }
 
 // AddQuote 给字符串添加双引号
@@ -42,10 +98,301 @@ func addTag(str,tag string) string {
 }
 
 
+// FormatFile 返回修改后的文件源码
+func FormatFile(fset *token.FileSet, f *ast.File) ([]byte, error) {
+	return formatFile(fset, f)
+}
+
+// WriteToFile 将修改后的文件写入 path，文件关联了原始源码时未修改的部分逐字节保持不变
 func WriteToFile(fset *token.FileSet, f *ast.File, path string) error {
-	var buf bytes.Buffer
-	if err := format.Node(&buf, fset, f); err != nil {
+	src, err := formatFile(fset, f)
+	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path, buf.Bytes(), 0755)
-}
\ No newline at end of file
+	return ioutil.WriteFile(path, src, 0755)
+}
+
+// exprString 返回节点的源码，不保留原有的换行
+func exprString(node ast.Node) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// snippet 记录由源码片段解析得到的声明
+//  这些声明的位置信息属于片段自己的 FileSet，输出时需要使用片段的 FileSet 和注释单独格式化
+type snippet struct {
+	fset     *token.FileSet
+	comments []*ast.CommentGroup
+}
+
+// snippets 保存 ast.Decl => *snippet
+var snippets sync.Map
+
+// declHints 保存新声明在目标文件中的参考位置 ast.Decl => token.Pos，
+// 用于判断目标文件中的游离注释应输出在声明之前还是之后
+var declHints sync.Map
+
+// parseDecls 将源码片段解析为声明，片段可以省略 package 子句
+func parseDecls(src string) ([]ast.Decl, error) {
+	if !strings.HasPrefix(strings.TrimSpace(src), "package ") {
+		src = "package p\n\n" + src
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	ci := 0
+	for i, decl := range f.Decls {
+		s := &snippet{fset: fset}
+		// 声明之前及内部的注释都归属于该声明，最后一个声明同时带上文件末尾的注释
+		for ci < len(f.Comments) && (i == len(f.Decls)-1 || f.Comments[ci].Pos() < decl.End()) {
+			s.comments = append(s.comments, f.Comments[ci])
+			ci++
+		}
+		snippets.Store(decl, s)
+	}
+	return f.Decls, nil
+}
+
+// releaseDecl 删除声明的片段信息及参考位置，声明从文件中删除或被替换时调用
+func releaseDecl(decl ast.Decl) {
+	snippets.Delete(decl)
+	declHints.Delete(decl)
+}
+
+// setDeclHint 设置新声明在目标文件中的参考位置
+func setDeclHint(decl ast.Decl, pos token.Pos) {
+	declHints.Store(decl, pos)
+}
+
+// declHint 返回新声明在目标文件中的参考位置，没有设置时为声明自身的位置
+func declHint(decl ast.Decl) token.Pos {
+	if pos, ok := declHints.Load(decl); ok {
+		return pos.(token.Pos)
+	}
+	if _, ok := snippets.Load(decl); ok {
+		return token.NoPos
+	}
+	return decl.Pos()
+}
+
+// declRange 返回声明在文件中的范围，包含其文档注释
+func declRange(decl ast.Decl) (from, to token.Pos) {
+	from, to = decl.Pos(), decl.End()
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			from = d.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			from = d.Doc.Pos()
+		}
+	}
+	return
+}
+
+// isNewDecl 判断声明是否为新生成的声明
+//  新生成的声明没有完整的位置信息，无法和文件中的注释一起交给 printer 排版
+func isNewDecl(decl ast.Decl) bool {
+	if _, ok := snippets.Load(decl); ok {
+		return true
+	}
+	return !decl.Pos().IsValid() || decl.End() <= decl.Pos()
+}
+
+// removeComments 删除文件中位于声明范围内的注释
+func removeComments(f *ast.File, decl ast.Decl) {
+	if isNewDecl(decl) {
+		return
+	}
+	from, to := declRange(decl)
+	removeCommentsIn(f, from, to)
+}
+
+// removeCommentsIn 移除文件中位于 from 与 to 之间的注释
+func removeCommentsIn(f *ast.File, from, to token.Pos) {
+	list := f.Comments[:0]
+	for _, c := range f.Comments {
+		if c.Pos() >= from && c.End() <= to {
+			continue
+		}
+		list = append(list, c)
+	}
+	f.Comments = list
+}
+
+// formatFile 格式化文件
+//
+// 文件中存在新生成的声明时，直接交给 format.Node 会让 printer 按估算的位置插入原有注释，
+// 导致注释跑到新声明中间，且新声明的文档注释不会输出。此时改为逐个声明格式化后再拼接。
+// 文件关联了解析时的源码时优先按原始源码拼接输出，见 spliceFile。
+func formatFile(fset *token.FileSet, f *ast.File) ([]byte, error) {
+	if src, ok := spliceFile(fset, f); ok {
+		return src, nil
+	}
+	var buf bytes.Buffer
+	hasNew := false
+	for _, decl := range f.Decls {
+		if isNewDecl(decl) {
+			hasNew = true
+			break
+		}
+	}
+	if !hasNew {
+		if err := format.Node(&buf, fset, f); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	comments := f.Comments
+	ci := 0
+	// package 子句及其之前的注释
+	for ci < len(comments) && comments[ci].Pos() < f.Name.End() {
+		ci++
+	}
+	header := &ast.File{Doc: f.Doc, Package: f.Package, Name: f.Name}
+	if err := format.Node(&buf, fset, &printer.CommentedNode{Node: header, Comments: comments[:ci]}); err != nil {
+		return nil, err
+	}
+	// package 子句同一行的注释，printer 不会输出节点范围之后的注释
+	pkgLine := fset.Position(f.Package).Line
+	buf.Truncate(len(bytes.TrimRight(buf.Bytes(), "\n")))
+	for ci < len(comments) && fset.Position(comments[ci].Pos()).Line == pkgLine {
+		for _, c := range comments[ci].List {
+			buf.WriteString(" " + c.Text)
+		}
+		ci++
+	}
+	buf.WriteString("\n")
+
+	last := f.Name.End()
+	for _, decl := range f.Decls {
+		if !isNewDecl(decl) {
+			from, to := declRange(decl)
+			// 声明之前的游离注释，printer 不会输出节点范围之前的注释
+			start := ci
+			for ci < len(comments) && comments[ci].End() <= from {
+				ci++
+			}
+			last = writeFreeComments(&buf, fset, last, comments[start:ci])
+			start = ci
+			for ci < len(comments) && comments[ci].Pos() < to {
+				ci++
+			}
+			writeDeclSep(&buf, fset, last, from)
+			if err := format.Node(&buf, fset, &printer.CommentedNode{Node: decl, Comments: comments[start:ci]}); err != nil {
+				return nil, err
+			}
+			buf.WriteString("\n")
+			last = to
+			continue
+		}
+
+		// 新声明之前的游离注释，紧挨着参考位置的注释不再空行
+		pos := declHint(decl)
+		next := token.NoPos
+		if pos.IsValid() {
+			start := ci
+			for ci < len(comments) && comments[ci].Pos() < pos {
+				ci++
+			}
+			if start < ci {
+				last, next = writeFreeComments(&buf, fset, last, comments[start:ci]), pos
+			}
+		}
+		writeDeclSep(&buf, fset, last, next)
+		if err := formatNewDecl(&buf, fset, decl); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+		last = token.NoPos
+	}
+	writeFreeComments(&buf, fset, last, comments[ci:])
+	return format.Source(buf.Bytes())
+}
+
+// writeDeclSep 输出两个声明之间的空行，原文件中相邻的声明保持原有的空行
+func writeDeclSep(buf *bytes.Buffer, fset *token.FileSet, prev, next token.Pos) {
+	if prev.IsValid() && next.IsValid() && fset.Position(next).Line-fset.Position(prev).Line <= 1 {
+		return
+	}
+	buf.WriteString("\n")
+}
+
+// writeFreeComments 原样输出声明之间的游离注释，保留注释之间原有的空行，返回最后一个注释的结束位置
+func writeFreeComments(buf *bytes.Buffer, fset *token.FileSet, last token.Pos, list []*ast.CommentGroup) token.Pos {
+	for _, c := range list {
+		writeDeclSep(buf, fset, last, c.Pos())
+		writeComments(buf, []*ast.CommentGroup{c})
+		last = c.End()
+	}
+	return last
+}
+
+// writeComments 原样输出注释
+func writeComments(buf *bytes.Buffer, list []*ast.CommentGroup) {
+	for _, c := range list {
+		for _, line := range c.List {
+			buf.WriteString(line.Text)
+			buf.WriteString("\n")
+		}
+	}
+}
+
+// formatNewDecl 格式化新生成的声明
+func formatNewDecl(buf *bytes.Buffer, fset *token.FileSet, decl ast.Decl) error {
+	if s, ok := snippets.Load(decl); ok {
+		s := s.(*snippet)
+		// printer 不会输出节点范围之外的注释，文档注释之前及声明之后的注释单独输出
+		from, _ := declRange(decl)
+		var leading, comments, trailing []*ast.CommentGroup
+		for _, c := range s.comments {
+			switch {
+			case c.End() <= from:
+				leading = append(leading, c)
+			case c.Pos() >= decl.End():
+				trailing = append(trailing, c)
+			default:
+				comments = append(comments, c)
+			}
+		}
+		if len(leading) > 0 {
+			var lead bytes.Buffer
+			writeDeclSep(&lead, s.fset, writeFreeComments(&lead, s.fset, token.NoPos, leading), from)
+			buf.Write(bytes.TrimLeft(lead.Bytes(), "\n"))
+		}
+		if err := format.Node(buf, s.fset, &printer.CommentedNode{Node: decl, Comments: comments}); err != nil {
+			return err
+		}
+		if len(trailing) > 0 {
+			buf.WriteString("\n")
+			writeFreeComments(buf, s.fset, decl.End(), trailing)
+			buf.Truncate(buf.Len() - 1)
+		}
+		return nil
+	}
+	// 没有位置信息的文档注释不能交给 printer 输出，这里手动输出
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			writeComments(buf, []*ast.CommentGroup{d.Doc})
+			nd := *d
+			nd.Doc = nil
+			decl = &nd
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			writeComments(buf, []*ast.CommentGroup{d.Doc})
+			nd := *d
+			nd.Doc = nil
+			decl = &nd
+		}
+	}
+	return format.Node(buf, fset, decl)
+}
@@ -18,26 +18,26 @@ import (
 // 	 age int
 //   TypeStruct
 //  }
-func AddKVToStruct(f *ast.File, name, key, value string) bool {
+//  可选参数 marker 为 struct 内的标记注释时，插入到标记之前
+func AddKVToStruct(f *ast.File, name, key, value string, marker ...string) bool {
 	if name == "" || value == "" {
 		return false
 	}
-	for _, decl := range f.Decls {
-		gen, ok := decl.(*ast.GenDecl)
-		if ok && gen.Tok == token.TYPE {
-			varSpec := gen.Specs[0].(*ast.TypeSpec)
-			if varSpec.Name.Name == name {
-				switch specType := varSpec.Type.(type) {
-				case *ast.StructType:
-					typeFields := specType.Fields
-					if typeFields.List == nil {
-						typeFields.List = []*ast.Field{}
-					}
-					typeFields.List = append(typeFields.List, getField(key, value))
-					return true
-				}
-			}
+	spec := findTypeSpec(f, name)
+	if spec == nil {
+		return false
+	}
+	switch specType := spec.Type.(type) {
+	case *ast.StructType:
+		typeFields := specType.Fields
+		if typeFields.List == nil {
+			typeFields.List = []*ast.Field{}
+		}
+		field := getField(key, value)
+		if skipApplied(f, hasField(typeFields, field)) {
+			return true
 		}
+		return insertFieldAtMarker(f, specType, typeFields, getMarker(marker), field)
 	}
 	return false
 }
@@ -67,31 +67,58 @@ func AddKVToStruct(f *ast.File, name, key, value string) bool {
 // type EmptyInf interface {
 //	test0(p1 string, p2 ...*AstKv) (ret1 string)
 // }
-func AddFuncToInterface(f *ast.File, name string, params *AstFunc) bool {
+//
+// 可选参数 marker 为 interface 内的标记注释时，插入到标记之前
+func AddFuncToInterface(f *ast.File, name string, params *AstFunc, marker ...string) bool {
 	if name == "" || params == nil {
 		return false
 	}
+	spec := findTypeSpec(f, name)
+	if spec == nil {
+		return false
+	}
+	switch specType := spec.Type.(type) {
+	case *ast.InterfaceType:
+		typeFields := specType.Methods
+		if typeFields.List == nil {
+			typeFields.List = []*ast.Field{}
+		}
+		field := &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(params.Name)},
+			Type:  getFuncType(params),
+		}
+		if skipApplied(f, hasField(typeFields, field)) {
+			return true
+		}
+		return insertFieldAtMarker(f, specType, typeFields, getMarker(marker), field)
+	}
+	return false
+}
+
+// findTypeSpec 查找类型声明，支持 type ( ... ) 形式的分组声明
+func findTypeSpec(f *ast.File, name string) *ast.TypeSpec {
 	for _, decl := range f.Decls {
 		gen, ok := decl.(*ast.GenDecl)
-		if ok && gen.Tok == token.TYPE {
-			varSpec := gen.Specs[0].(*ast.TypeSpec)
-			if varSpec.Name.Name == name {
-				switch specType := varSpec.Type.(type) {
-				case *ast.InterfaceType:
-					typeFields := specType.Methods
-					if typeFields.List == nil {
-						typeFields.List = []*ast.Field{}
-					}
-					typeFields.List = append(typeFields.List, &ast.Field{
-						Names: []*ast.Ident{ast.NewIdent(params.Name)},
-						Type: getFuncType(params),
-					})
-					return true
-				}
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			if ts := spec.(*ast.TypeSpec); ts.Name.Name == name {
+				return ts
 			}
 		}
 	}
-	return false
+	return nil
+}
+
+// findTypeSpecIn 在多个文件中查找类型声明，返回类型所在的文件
+func findTypeSpecIn(files []*ast.File, name string) (*ast.File, *ast.TypeSpec) {
+	for _, f := range files {
+		if spec := findTypeSpec(f, name); spec != nil {
+			return f, spec
+		}
+	}
+	return nil, nil
 }
 
 func getField(key, value string) *ast.Field {
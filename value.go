@@ -0,0 +1,261 @@
+package ozastutil
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 值类型校验
+//
+// AddValueToMap、AddValueToSlice、AddKVToUnaryStruct 添加前检查值能否赋给字面量声明的元素类型，
+// struct 字面量的 key 必须是 struct 的成员。
+// 类型和值在本文件的包作用域中求值，可以引用本文件中声明的类型、变量、常量和函数；
+// 引用 import 的包的类型和值无法在单个文件中确定，不做检查，交给 CheckFiles；
+// 本文件中找不到的标识符（包括同一个包其他文件中的声明）无法检查，视为不能添加。
+
+// SetAutoQuote 开启或关闭文件的自动加引号，开启后元素类型为 string 时，未加引号的原始字符串自动加上双引号
+//  只认识本文件中声明的顶层标识符及 import 的包名，引用同一个包其他文件中的常量或变量时会被当作原始字符串加上引号，
+//  这种情况下应当关闭自动加引号或者自己加上引号
+//
+// 测试数据：var sliceStr = []string{"1"}
+//
+// 执行：
+//
+// SetAutoQuote(f, true)
+//
+// AddValueToSlice(f, "sliceStr", "hello world")
+//
+// 结果为：var sliceStr = []string{"1", "hello world"}
+func SetAutoQuote(f *ast.File, on bool) {
+	getEditState(f).autoQuote = on
+}
+
+// IsAutoQuote 判断文件是否开启了自动加引号
+func IsAutoQuote(f *ast.File) bool {
+	return getEditState(f).autoQuote
+}
+
+// litType 返回字面量的类型，类型为本文件中声明的类型名称时返回声明的类型
+func litType(f *ast.File, typ ast.Expr) ast.Expr {
+	if ident, ok := typ.(*ast.Ident); ok {
+		if spec := findTypeSpec(f, ident.Name); spec != nil {
+			return spec.Type
+		}
+	}
+	return typ
+}
+
+// checkValue 检查值能否赋给 typ 类型，返回实际添加的值（自动加引号后的值）
+//  类型或值引用了 import 的包时不检查，值引用了本文件中未声明的标识符时返回 false
+func checkValue(f *ast.File, typ ast.Expr, value string) (string, bool) {
+	if typ == nil {
+		return value, true
+	}
+	fset, pkg := filePackage(f)
+	target, err := types.Eval(fset, pkg, token.NoPos, exprString(typ))
+	if err != nil || !target.IsType() || hasInvalid(target.Type) {
+		return value, true
+	}
+	if IsAutoQuote(f) && isStringType(target.Type) && needsQuote(f, value) {
+		value = strconv.Quote(value)
+	}
+	tv, err := types.Eval(fset, pkg, token.NoPos, value)
+	if err != nil {
+		return value, refsImport(f, value)
+	}
+	if tv.IsType() {
+		return value, false
+	}
+	if hasInvalid(tv.Type) {
+		return value, true
+	}
+	return value, types.AssignableTo(tv.Type, target.Type)
+}
+
+// filePackage 对文件的顶层声明做类型检查，返回包作用域中包含这些声明的包
+//  声明输出为源码后重新解析，只检查声明不检查函数体，import 的包不加载，引用它们的声明类型无效
+func filePackage(f *ast.File) (*token.FileSet, *types.Package) {
+	var buf strings.Builder
+	buf.WriteString("package " + f.Name.Name + "\n")
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			decl = &ast.FuncDecl{Recv: fd.Recv, Name: fd.Name, Type: fd.Type}
+		}
+		buf.WriteString(exprString(decl) + "\n")
+	}
+	fset := token.NewFileSet()
+	nf, err := parser.ParseFile(fset, "", buf.String(), parser.AllErrors)
+	if err != nil && nf == nil {
+		return fset, nil
+	}
+	conf := types.Config{
+		Importer: importerFunc(func(string) (*types.Package, error) {
+			return nil, fmt.Errorf("not loaded")
+		}),
+		Error: func(error) {},
+	}
+	pkg, _ := conf.Check(f.Name.Name, fset, []*ast.File{nf}, nil)
+	return fset, pkg
+}
+
+// importerFunc 将函数转换为 types.Importer
+type importerFunc func(path string) (*types.Package, error)
+
+func (fn importerFunc) Import(path string) (*types.Package, error) {
+	return fn(path)
+}
+
+// hasInvalid 判断类型中是否包含无法确定的类型
+func hasInvalid(t types.Type) bool {
+	return t == nil || strings.Contains(types.TypeString(t, nil), "invalid type")
+}
+
+// refsImport 判断值是否引用了 import 的包
+func refsImport(f *ast.File, value string) bool {
+	expr, err := parser.ParseExpr(value)
+	if err != nil {
+		return false
+	}
+	names := make(map[string]bool)
+	for _, imp := range f.Imports {
+		if imp.Name != nil {
+			names[imp.Name.Name] = true
+		} else if p, err := strconv.Unquote(imp.Path.Value); err == nil {
+			names[path.Base(p)] = true
+		}
+	}
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && names[ident.Name] {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// checkMapKV 检查 map 字面量的 key 和 value
+func checkMapKV(f *ast.File, cpl *ast.CompositeLit, key, value string) (string, string, bool) {
+	mt, ok := litType(f, cpl.Type).(*ast.MapType)
+	if !ok {
+		return key, value, true
+	}
+	key, ok = checkValue(f, mt.Key, key)
+	if !ok {
+		return key, value, false
+	}
+	value, ok = checkValue(f, mt.Value, value)
+	return key, value, ok
+}
+
+// checkSliceElt 检查 slice、数组字面量的元素
+func checkSliceElt(f *ast.File, cpl *ast.CompositeLit, value string) (string, bool) {
+	at, ok := litType(f, cpl.Type).(*ast.ArrayType)
+	if !ok {
+		return value, true
+	}
+	return checkValue(f, at.Elt, value)
+}
+
+// checkStructKV 检查 struct 字面量的 key 是否为成员，以及值能否赋给成员的类型
+//  struct 不在本文件中声明，或者本文件中的类型不是直接以 struct 定义（如 type A B、type A = pkg.B）时不检查
+func checkStructKV(f *ast.File, cpl *ast.CompositeLit, key, value string) (string, bool) {
+	spec := findTypeSpec(f, typeName(cpl.Type))
+	if spec == nil {
+		return value, true
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return value, true
+	}
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 && typeName(field.Type) == key {
+			return checkValue(f, field.Type, value)
+		}
+		for _, name := range field.Names {
+			if name.Name == key {
+				return checkValue(f, field.Type, value)
+			}
+		}
+	}
+	return value, false
+}
+
+// isStringType 判断类型的底层类型是否为 string
+func isStringType(t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsString != 0
+}
+
+// needsQuote 判断值是否为原始字符串：无法解析、非字符串的字面量，或者引用了本文件中未声明的标识符
+//  只知道本文件中的标识符，同一个包其他文件中声明的标识符也视为未声明
+func needsQuote(f *ast.File, value string) bool {
+	expr, err := parser.ParseExpr(value)
+	if err != nil {
+		return true
+	}
+	if lit, ok := expr.(*ast.BasicLit); ok {
+		return lit.Kind != token.STRING
+	}
+	declared := fileIdents(f)
+	quote := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok && !declared[ident.Name] {
+					quote = true
+				}
+				return !quote
+			})
+			return false
+		case *ast.Ident:
+			if !declared[n.Name] {
+				quote = true
+			}
+		}
+		return !quote
+	})
+	return quote
+}
+
+// fileIdents 返回文件中声明的顶层标识符及 import 的包名
+func fileIdents(f *ast.File) map[string]bool {
+	idents := make(map[string]bool)
+	for _, imp := range f.Imports {
+		if imp.Name != nil {
+			idents[imp.Name.Name] = true
+		} else if p, err := strconv.Unquote(imp.Path.Value); err == nil {
+			idents[path.Base(p)] = true
+		}
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				idents[decl.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					idents[spec.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						idents[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return idents
+}
+
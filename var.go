@@ -1,7 +1,6 @@
 package ozastutil
 
 import (
-	"fmt"
 	"go/ast"
 	"go/token"
 )
@@ -9,18 +8,23 @@ import (
 // DefineVarAfterVar 在某个变量后面新定义一个变量
 //  在test变量后面定义一个：var genExpr *ast.GenExpr
 //  使用例子：DefineVarAfterVar(f, "genExpr", "*ast.GenExpr", "test")
+//  afterVar 为标记注释（如 // astutil:vars）时插入到标记之前
 func DefineVarAfterVar(f *ast.File, name, kind, afterVar string) bool {
-	if name == "" || kind == "" || isVarExist(f, name) != -1 {
+	newVar := getDefineVar(name, kind)
+	if newVar == nil {
 		return false
 	}
+	if index := isVarExist(f, name); index != -1 {
+		return skipApplied(f, sameNode(f.Decls[index], newVar))
+	}
+	skipApplied(f, false)
+	if isMarker(afterVar) {
+		return insertDeclAtMarker(f, afterVar, newVar)
+	}
 	insertAt := isVarExist(f, afterVar)
 	if insertAt == -1 {
 		return false
 	}
-	newVar := getDefineVar(name, kind)
-	if newVar == nil {
-		return false
-	}
 	// 插入指定位置
 	insertDecls(f, insertAt, newVar)
 	return true
@@ -29,24 +33,29 @@ func DefineVarAfterVar(f *ast.File, name, kind, afterVar string) bool {
 // AddVarAfterVar 在某个变量后面新增一个变量
 //  在test变量后面新增一个：var genExpr = &ast.GenExpr
 //  使用例子：AddVarAfterVar(f, "genExpr", "&ast.GenExpr", "test")
+//  afterVar 为标记注释（如 // astutil:vars）时插入到标记之前
 func AddVarAfterVar(f *ast.File, name, value, afterVar string) bool {
-	if name == "" || value == "" || isVarExist(f, name) != -1 {
+	newVar := getVar(name, value)
+	if newVar == nil {
 		return false
 	}
+	if index := isVarExist(f, name); index != -1 {
+		return skipApplied(f, sameNode(f.Decls[index], newVar))
+	}
+	skipApplied(f, false)
+	if isMarker(afterVar) {
+		return insertDeclAtMarker(f, afterVar, newVar)
+	}
 	insertAt := isVarExist(f, afterVar)
 	if insertAt == -1 {
 		return false
 	}
-	newVar := getVar(name, value)
-	if newVar == nil {
-		return false
-	}
 	// 插入指定位置
 	insertDecls(f, insertAt, newVar)
 	return true
 }
 
-// AddValueToMap 给map变量添加数据，没有做map类型校验
+// AddValueToMap 给map变量添加数据，key、value 不能赋给 map 的 key、value 类型时返回 false
 //  测试数据：var mapStr = map[string]string{"cc": "cc"}
 //  执行：AddValueToMap(f, "mapStr", AddQuote("key"), AddQuote("test"))
 //  结果为：var mapStr = map[string]string{"cc": "cc", "key": "test"}
@@ -58,7 +67,12 @@ func AddVarAfterVar(f *ast.File, name, value, afterVar string) bool {
 //  测试数据：var mapInf = map[string]interface{}{"cc": 1}
 //  执行：AddValueToMap(f, "mapInf", AddQuote("hello"), "&aaa")
 //  结果为：var mapInf = map[string]interface{}{"cc": 1, "hello": &aaa}
-func AddValueToMap(f *ast.File, mapName, key, value string) bool {
+//
+//  执行：AddValueToMap(f, "mapInt", AddQuote("x"), AddQuote("test"))
+//  结果为：false，"x" 不能作为 int 类型的 key
+//
+//  可选参数 marker 为 map 字面量内的标记注释时，插入到标记之前
+func AddValueToMap(f *ast.File, mapName, key, value string, marker ...string) bool {
 	if mapName == "" || key == "" || value == "" {
 		return false
 	}
@@ -72,8 +86,15 @@ func AddValueToMap(f *ast.File, mapName, key, value string) bool {
 					if vsVal.Elts == nil {
 						vsVal.Elts = []ast.Expr{}
 					}
-					vsVal.Elts = append(vsVal.Elts, getKVExpr(key, value))
-					return true
+					key, value, ok := checkMapKV(f, vsVal, key, value)
+					if !ok {
+						return false
+					}
+					kv := getKVExpr(key, value)
+					if skipApplied(f, hasExpr(vsVal.Elts, kv)) {
+						return true
+					}
+					return insertExprAtMarker(f, vsVal, &vsVal.Elts, vsVal.Lbrace, vsVal.Rbrace, getMarker(marker), kv)
 				}
 			}
 		}
@@ -92,7 +113,9 @@ func AddValueToMap(f *ast.File, mapName, key, value string) bool {
 //  AddValueToCaller(f, "tt", "hello")
 //  结果为：
 //  var tt = NewSet(12, "cc", "hello", hello)
-func AddValueToCaller(f *ast.File, varName, value string) bool {
+//
+//  可选参数 marker 为调用参数内的标记注释时，插入到标记之前
+func AddValueToCaller(f *ast.File, varName, value string, marker ...string) bool {
 	if varName == "" || value == "" {
 		return false
 	}
@@ -106,12 +129,14 @@ func AddValueToCaller(f *ast.File, varName, value string) bool {
 					if vsVal.Args == nil {
 						vsVal.Args = []ast.Expr{}
 					}
-					vsVal.Args = append(vsVal.Args, &ast.BasicLit{
+					arg := &ast.BasicLit{
 						Kind:  token.STRING,
 						Value: value,
-						ValuePos: token.NoPos + 1,
-					})
-					return true
+					}
+					if skipApplied(f, hasExpr(vsVal.Args, arg)) {
+						return true
+					}
+					return insertExprAtMarker(f, vsVal, &vsVal.Args, vsVal.Lparen, vsVal.Rparen, getMarker(marker), arg)
 				}
 			}
 		}
@@ -119,14 +144,19 @@ func AddValueToCaller(f *ast.File, varName, value string) bool {
 	return false
 }
 
-// AddValueToSlice 给slice变量添加数据，没有做类型校验
+// AddValueToSlice 给slice变量添加数据，值不能赋给元素类型时返回 false
 //  例子：var sliceStr = []string{}
 //  执行：
 //  AddValueToSlice(f, "sliceStr", AddQuote("hello"))
 //  AddValueToSlice(f, "sliceStr", "hello")
 //  结果为：
 //  var sliceStr = []string{"hello", hello}
-func AddValueToSlice(f *ast.File, varName, value string) bool {
+//
+//  执行：AddValueToSlice(f, "sliceStr", "1")
+//  结果为：false，1 不能作为 string 类型的元素
+//
+//  可选参数 marker 为 slice 字面量内的标记注释时，插入到标记之前
+func AddValueToSlice(f *ast.File, varName, value string, marker ...string) bool {
 	if varName == "" || value == "" {
 		return false
 	}
@@ -140,12 +170,18 @@ func AddValueToSlice(f *ast.File, varName, value string) bool {
 					if vsVal.Elts == nil {
 						vsVal.Elts = []ast.Expr{}
 					}
-					vsVal.Elts = append(vsVal.Elts, &ast.BasicLit{
+					value, ok := checkSliceElt(f, vsVal, value)
+					if !ok {
+						return false
+					}
+					elt := &ast.BasicLit{
 						Kind:  token.STRING,
 						Value: value,
-						ValuePos: token.NoPos + 1,
-					})
-					return true
+					}
+					if skipApplied(f, hasExpr(vsVal.Elts, elt)) {
+						return true
+					}
+					return insertExprAtMarker(f, vsVal, &vsVal.Elts, vsVal.Lbrace, vsVal.Rbrace, getMarker(marker), elt)
 				}
 			}
 		}
@@ -167,7 +203,9 @@ func AddValueToSlice(f *ast.File, varName, value string) bool {
 //	 Name string
 //   Key  string
 //  }
-func AddKVToUnaryStruct(f *ast.File, varName, key, value string) bool {
+//  Struct1 在本文件中声明时，key 必须是 Struct1 的成员，value 必须能赋给成员的类型，否则返回 false
+//  可选参数 marker 为 struct 字面量内的标记注释时，插入到标记之前
+func AddKVToUnaryStruct(f *ast.File, varName, key, value string, marker ...string) bool {
 	if varName == "" || key == "" || value == "" {
 		return false
 	}
@@ -187,8 +225,15 @@ func AddKVToUnaryStruct(f *ast.File, varName, key, value string) bool {
 					if cpl.Elts == nil {
 						cpl.Elts = []ast.Expr{}
 					}
-					cpl.Elts = append(cpl.Elts, getKVExpr(key,value))
-					return true
+					value, ok := checkStructKV(f, cpl, key, value)
+					if !ok {
+						return false
+					}
+					kv := getKVExpr(key, value)
+					if skipApplied(f, hasExpr(cpl.Elts, kv)) {
+						return true
+					}
+					return insertExprAtMarker(f, cpl, &cpl.Elts, cpl.Lbrace, cpl.Rbrace, getMarker(marker), kv)
 				}
 			}
 		}
@@ -199,8 +244,8 @@ func AddKVToUnaryStruct(f *ast.File, varName, key, value string) bool {
 // getKVExpr 获取一个*ast.KeyValueExpr
 func getKVExpr(key, value string) *ast.KeyValueExpr {
 	return &ast.KeyValueExpr{
-		Key:   &ast.BasicLit{Kind: token.STRING, Value: key, ValuePos: token.NoPos + 1},
-		Value: &ast.BasicLit{Kind: token.STRING, Value: value, ValuePos: token.NoPos + 1},
+		Key:   &ast.BasicLit{Kind: token.STRING, Value: key},
+		Value: &ast.BasicLit{Kind: token.STRING, Value: value},
 	}
 }
 
@@ -239,7 +284,6 @@ func getVar(name, value string) *ast.GenDecl {
 				Names: []*ast.Ident{ast.NewIdent(name)},
 				Values: []ast.Expr{&ast.BasicLit{
 					Kind:     token.STRING,
-					ValuePos: token.NoPos + 1,
 					Value:    value,
 				}},
 			},
@@ -248,12 +292,12 @@ func getVar(name, value string) *ast.GenDecl {
 }
 
 // getAssignVar 获取一个用于生成<str1 := "string"> 格式的 AssignStmt，
-func getAssignVar(name, value string,afterLine token.Pos) *ast.AssignStmt {
+func getAssignVar(name, value string) *ast.AssignStmt {
 	if name == "" || value == "" {
 		return nil
 	}
 	return &ast.AssignStmt{
-		TokPos: afterLine + 1,
+		Tok: token.DEFINE,
 		Lhs: []ast.Expr{&ast.Ident{Name: name}},
 		Rhs: []ast.Expr{&ast.BasicLit{Value: value}},
 	}
@@ -279,21 +323,10 @@ func isVarExist(f *ast.File, name string) int {
 	return ret
 }
 
+// ParseVariable 判断文件级别的变量是否存在
+//
+// Deprecated: 使用 InspectVar 获取变量的类型及值
 func ParseVariable(f *ast.File, varName string) bool {
-	for _, decl := range f.Decls {
-		gen, ok := decl.(*ast.GenDecl)
-		if ok && gen.Tok == token.VAR {
-			vs := gen.Specs[0].(*ast.ValueSpec)
-			for k, varIdent := range vs.Names {
-				if varIdent.Name == varName {
-					varValue := vs.Values[k]
-					fmt.Printf("GenDecl=>%#v\n", gen)
-					fmt.Printf("ValueSpec=>%#v\n", vs)
-					fmt.Printf("Ident=>%#v\n", varIdent)
-					fmt.Printf("Expr=>%#v\n", varValue)
-				}
-			}
-		}
-	}
-	return true
+	_, ok := InspectVar(f, varName)
+	return ok
 }
@@ -92,7 +92,8 @@ func TestAddKVToUnaryStruct(t *testing.T) {
 	assert.True(t, res)
 	PrintResult(fst, f)
 	// 结果为：var xx = &Struct1{
-	//	Name: "str", Key: "value",
+	//	Name: "str",
+	//	Key:  "value",
 	//}
 }
 
@@ -125,4 +126,50 @@ func TestGinRoute(t *testing.T) {
 	// 加载测试文件
 	fst, f := InitEnv("./test_demo/route_demo.go")
 	ast.Print(fst,f)
-}
\ No newline at end of file
+}
+
+func TestAddValueTypeCheck(t *testing.T) {
+	fst, f := InitEnv("./test_demo/var_add_value_to_map.go")
+
+	// map[int]string 的 key 不能是字符串
+	assert.False(t, AddValueToMap(f, "mapInt", AddQuote("x"), AddQuote("test")))
+	// value 不能是数字
+	assert.False(t, AddValueToMap(f, "mapStr", AddQuote("key"), "1"))
+	// interface{} 可以接受任意值
+	assert.True(t, AddValueToMap(f, "mapInf", AddQuote("num"), "1.5"))
+	// 本文件中未声明的标识符无法检查
+	assert.False(t, AddValueToMap(f, "mapStr", AddQuote("var"), "name"))
+	// 本文件中的变量按声明的类型检查
+	assert.False(t, AddValueToMap(f, "mapStr", AddQuote("map"), "mapInt"))
+	assert.True(t, AddValueToMap(f, "mapInf", AddQuote("map"), "mapInt"))
+
+	// 自动加引号
+	SetAutoQuote(f, true)
+	assert.True(t, AddValueToMap(f, "mapInt", "2", "hello world"))
+	// 本文件中的标识符不加引号，map[string]string 不能作为 string 元素
+	assert.False(t, AddValueToMap(f, "mapStr", "user-list", "mapStr"))
+	assert.True(t, AddValueToMap(f, "mapStr", "user-list", "user list"))
+	PrintResult(fst, f)
+	src, _ := FormatFile(fst, f)
+	assert.Contains(t, string(src), `2: "hello world"`)
+	assert.Contains(t, string(src), `"user-list": "user list"`)
+	assert.Contains(t, string(src), `"map": mapInt`)
+
+	fst, f = InitEnv("./test_demo/var_add_value_to_slice.go")
+	assert.False(t, AddValueToSlice(f, "sliceStr", "1"))
+	SetAutoQuote(f, true)
+	assert.True(t, AddValueToSlice(f, "sliceStr", "1"))
+	// 已加引号的值不再重复添加引号
+	assert.True(t, AddValueToSlice(f, "sliceStr", AddQuote("2")))
+	src, _ = FormatFile(fst, f)
+	assert.Contains(t, string(src), `[]string{"1", "1", "2"}`)
+
+	_, f = InitEnv("./test_demo/var_add_value_to_caller.go")
+	// 不是 Struct1 的成员
+	assert.False(t, AddKVToUnaryStruct(f, "xx", "Age", "1"))
+	// 成员类型不匹配
+	assert.False(t, AddKVToUnaryStruct(f, "xx", "Key", "1"))
+	assert.True(t, AddKVToUnaryStruct(f, "xx", "Key", AddQuote("value")))
+	// 类型不是直接以 struct 定义，无法确定成员，不做检查
+	assert.True(t, AddKVToUnaryStruct(f, "yy", "Key", AddQuote("value")))
+}